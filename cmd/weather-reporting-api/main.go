@@ -2,7 +2,12 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
 
@@ -10,27 +15,166 @@ import (
 
 	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
 	"github.com/felipecurvelo/weather-reporting-api/pkg/api/resources"
+
+	_ "modernc.org/sqlite"
 )
 
 func main() {
-	serverOptions := &api.ServerOptions{
-		Port: 8080,
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		os.Exit(runSnapshot(os.Args[2:]))
+	}
+
+	serverOptions := &api.ServerOptions{}
+	flag.IntVar(&serverOptions.Port, "port", 8080, "port to listen on")
+	flag.StringVar(&serverOptions.CertFile, "tls-cert", "", "path to the TLS certificate (enables HTTPS)")
+	flag.StringVar(&serverOptions.KeyFile, "tls-key", "", "path to the TLS private key")
+	flag.StringVar(&serverOptions.ClientCAFile, "tls-client-ca", "", "path to the CA used to verify client certificates (enables mutual TLS)")
+	flag.BoolVar(&serverOptions.RequireClientCert, "tls-require-client-cert", false, "reject clients without a valid certificate")
+	var allowedIdentities stringList
+	flag.Var(&allowedIdentities, "tls-allowed-identity", "common name of a client certificate accepted in place of a token (repeatable)")
+	flag.Int64Var(&serverOptions.MaxBodyBytes, "max-body-bytes", api.DefaultMaxBodyBytes, "maximum accepted request body size in bytes")
+	flag.Int64Var(&serverOptions.MaxImportBytes, "max-import-bytes", api.DefaultMaxImportBytes, "maximum accepted bulk import body size in bytes")
+	flag.BoolVar(&serverOptions.StrictJSON, "strict-json", false, "reject request bodies with unknown fields")
+	flag.BoolVar(&serverOptions.RequireJSONContentType, "require-json-content-type", false, "reject request bodies without a JSON Content-Type")
+	managerOptions := weathermanager.DefaultOptions()
+	flag.DurationVar(&managerOptions.DeletionRetention, "deletion-retention", weathermanager.DefaultDeletionRetention, "how long deleted cities can be restored before they are purged")
+	flag.IntVar(&managerOptions.Retention.RawDays, "raw-retention-days", 0, "days observations are kept before being rolled up into monthly aggregates (0 keeps them forever)")
+	flag.IntVar(&managerOptions.Retention.AggregateDays, "aggregate-retention-days", 0, "days monthly aggregates are kept (0 keeps them forever)")
+	storage := flag.String("storage", "memory", "where reports are stored: memory, bolt or sql")
+	storagePath := flag.String("storage-path", "weather.db", "path to the database of the bolt or sql storage")
+	cacheBytes := flag.Int64("cache-bytes", 0, "memory in bytes of the cache of observation ranges (0 disables it)")
+	maintenanceInterval := flag.Duration("maintenance-interval", time.Hour, "how often expired data is purged and retention applied")
+	v1Sunset := flag.String("v1-sunset", "", "date (YYYY-MM-DD) advertised in the Sunset header of /v1 responses")
+	flag.Parse()
+
+	v1Options := api.VersionOptions{Deprecated: true}
+	if *v1Sunset != "" {
+		sunset, err := time.Parse("2006-01-02", *v1Sunset)
+		if err != nil {
+			fmt.Printf("Invalid -v1-sunset date (%s)\n", err.Error())
+			os.Exit(1)
+		}
+		v1Options.Sunset = sunset
+	}
+
+	if serverOptions.RequireClientCert && len(allowedIdentities) == 0 {
+		fmt.Println("-tls-require-client-cert needs at least one -tls-allowed-identity")
+		os.Exit(1)
+	}
+	auth := authorizer.NewAuth()
+	for _, identity := range allowedIdentities {
+		auth.AllowIdentity(identity)
 	}
 
 	ctx := context.Background()
-	ctx = authorizer.NewContext(ctx, authorizer.NewAuth())
-	ctx = weathermanager.NewContext(ctx, weathermanager.New())
+	ctx = authorizer.NewContext(ctx, auth)
+	weatherMgr, closeStorage, err := openWeatherManager(*storage, *storagePath, managerOptions)
+	if err != nil {
+		fmt.Printf("Error opening %s storage (%s)\n", *storage, err.Error())
+		os.Exit(1)
+	}
+	// The default retention stored by the bolt and sql storages is only
+	// overridden when the retention flags are given.
+	retentionFlags := false
+	flag.Visit(func(f *flag.Flag) {
+		retentionFlags = retentionFlags || f.Name == "raw-retention-days" || f.Name == "aggregate-retention-days"
+	})
+	if retentionFlags || *storage == "memory" {
+		if err := weatherMgr.SetDefaultRetention(managerOptions.Retention); err != nil {
+			fmt.Printf("Invalid retention (%s)\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if *cacheBytes > 0 {
+		weatherMgr = weathermanager.NewCached(weatherMgr, *cacheBytes)
+	}
+	stopMaintenance := weatherMgr.RunMaintenance(*maintenanceInterval)
+	ctx = weathermanager.NewContext(ctx, weatherMgr)
 
 	server := api.NewServer(ctx, serverOptions)
 
 	server.RegisterResource(&resources.Weather{}).
 		RegisterResource(&resources.Auth{}).
+		RegisterResource(&resources.Cities{}).
+		RegisterResource(&resources.Observations{}).
+		RegisterResource(&resources.Stations{}).
+		RegisterResource(&resources.Retention{}).
+		RegisterResource(&resources.Import{}).
+		RegisterResource(&resources.Snapshot{}).
+		RegisterResource(&resources.Cache{}).
+		RegisterVersion("v1", v1Options).
+		RegisterVersionedResource("v1", &resources.Auth{}).
+		RegisterVersionedResource("v1", &resources.Weather{}).
+		RegisterVersion("v2", api.VersionOptions{}).
+		RegisterVersionedResource("v2", &resources.Auth{}).
+		RegisterVersionedResource("v2", &resources.Cities{}).
+		RegisterVersionedResource("v2", &resources.Observations{}).
+		RegisterVersionedResource("v2", &resources.Stations{}).
+		RegisterVersionedResource("v2", &resources.Retention{}).
+		RegisterVersionedResource("v2", &resources.Import{}).
+		RegisterVersionedResource("v2", &resources.Snapshot{}).
+		RegisterVersionedResource("v2", &resources.Cache{}).
 		Start()
 
-	fmt.Printf("HTTP Server started on port: %d\n", serverOptions.Port)
+	if serverOptions.TLSEnabled() {
+		fmt.Printf("HTTPS Server started on port: %d\n", serverOptions.Port)
+	} else {
+		fmt.Printf("HTTP Server started on port: %d\n", serverOptions.Port)
+	}
 
 	server.WaitForShutdownSignal().
 		Close()
+	stopMaintenance()
+	closeStorage()
 
 	fmt.Println("HTTP Server stopped")
 }
+
+// stringList is a flag that can be given several times, collecting every
+// value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// maintainedWeatherManager is a WeatherManager running background jobs.
+type maintainedWeatherManager interface {
+	weathermanager.WeatherManager
+	RunMaintenance(time.Duration) func()
+}
+
+// openWeatherManager opens the manager of the given storage, returning the
+// function closing it.
+func openWeatherManager(storage string, path string, options weathermanager.Options) (maintainedWeatherManager, func(), error) {
+	switch storage {
+	case "memory":
+		return weathermanager.NewWithOptions(options), func() {}, nil
+	case "bolt":
+		weatherMgr, err := weathermanager.OpenBolt(path, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		return weatherMgr, func() { weatherMgr.Close() }, nil
+	case "sql":
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			return nil, nil, err
+		}
+		// SQLite allows a single writer, a single connection also avoids
+		// waiting on its locks.
+		db.SetMaxOpenConns(1)
+		weatherMgr, err := weathermanager.OpenSQL(db, options)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return weatherMgr, func() { weatherMgr.Close() }, nil
+	}
+	return nil, nil, fmt.Errorf("unknown storage %s, expected memory, bolt or sql", storage)
+}
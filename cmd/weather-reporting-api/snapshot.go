@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+)
+
+const snapshotUsage = `Usage: weather-reporting-api snapshot <command> [flags]
+
+Commands:
+  export   download a snapshot of every city from the server
+  restore  restore a snapshot into the server
+  inspect  check a snapshot file and summarize its content`
+
+// runSnapshot runs the snapshot subcommand, returning the exit code.
+func runSnapshot(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, snapshotUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = exportSnapshot(args[1:])
+	case "restore":
+		err = restoreSnapshot(args[1:])
+	case "inspect":
+		err = inspectSnapshot(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, snapshotUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "snapshot %s: %s\n", args[0], err.Error())
+		return 1
+	}
+	return 0
+}
+
+type snapshotClient struct {
+	server   string
+	token    string
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+func (c *snapshotClient) flags(set *flag.FlagSet) {
+	set.StringVar(&c.server, "server", "http://localhost:8080", "URL of the weather reporting API")
+	set.StringVar(&c.token, "token", os.Getenv("WEATHER_API_TOKEN"), "access token (defaults to $WEATHER_API_TOKEN)")
+	set.StringVar(&c.caFile, "ca", "", "path to the CA verifying the server certificate (defaults to the system CAs)")
+	set.StringVar(&c.certFile, "cert", "", "path to the client certificate, for servers using mutual TLS")
+	set.StringVar(&c.keyFile, "key", "", "path to the private key of the client certificate")
+}
+
+func (c *snapshotClient) httpClient() (*http.Client, error) {
+	if c.caFile == "" && c.certFile == "" && c.keyFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig, err := api.NewClientTLSConfig(c.caFile, c.certFile, c.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, nil
+}
+
+func (c *snapshotClient) do(method string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := strings.TrimSuffix(c.server, "/") + "/admin/snapshot"
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/gzip")
+	}
+
+	client, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		problem, _ := ioutil.ReadAll(res.Body)
+		return nil, fmt.Errorf("server responded %s: %s", res.Status, strings.TrimSpace(string(problem)))
+	}
+	return res, nil
+}
+
+func exportSnapshot(args []string) error {
+	set := flag.NewFlagSet("snapshot export", flag.ContinueOnError)
+	client := &snapshotClient{}
+	client.flags(set)
+	output := set.String("o", "", "file to write the snapshot to (defaults to stdout)")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+
+	res, err := client.do(http.MethodGet, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if *output == "" {
+		_, err = io.Copy(os.Stdout, res.Body)
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, res.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func restoreSnapshot(args []string) error {
+	set := flag.NewFlagSet("snapshot restore", flag.ContinueOnError)
+	client := &snapshotClient{}
+	client.flags(set)
+	input := set.String("i", "", "snapshot file to restore (required)")
+	mode := set.String("mode", string(weathermanager.RestoreMerge), "replace deletes the cities missing from the snapshot, merge keeps them")
+	dryRun := set.Bool("dry-run", false, "only print what restoring would change")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("missing -i snapshot file")
+	}
+
+	body, err := ioutil.ReadFile(*input)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"mode": {*mode}}
+	if *dryRun {
+		query.Set("dry_run", "true")
+	}
+	res, err := client.do(http.MethodPost, query, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var diff struct {
+		Mode    string `json:"mode"`
+		DryRun  bool   `json:"dry_run"`
+		Added   int    `json:"added"`
+		Changed int    `json:"changed"`
+		Removed int    `json:"removed"`
+		Cities  []struct {
+			City    string `json:"city"`
+			Status  string `json:"status"`
+			Added   int    `json:"added"`
+			Changed int    `json:"changed"`
+			Removed int    `json:"removed"`
+		} `json:"cities"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&diff)
+	if err != nil {
+		return err
+	}
+
+	for _, city := range diff.Cities {
+		if city.Status == weathermanager.CityUnchanged {
+			continue
+		}
+		fmt.Printf("%-9s %s (+%d ~%d -%d)\n", city.Status, city.City, city.Added, city.Changed, city.Removed)
+	}
+	verb := "Restored"
+	if diff.DryRun {
+		verb = "Would restore"
+	}
+	fmt.Printf("%s in %s mode: %d observations added, %d changed, %d removed\n", verb, diff.Mode, diff.Added, diff.Changed, diff.Removed)
+	return nil
+}
+
+func inspectSnapshot(args []string) error {
+	set := flag.NewFlagSet("snapshot inspect", flag.ContinueOnError)
+	input := set.String("i", "", "snapshot file to inspect (required)")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("missing -i snapshot file")
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// A local file is trusted, whatever its size.
+	snapshot, err := weathermanager.ReadSnapshot(file, 0)
+	if err != nil {
+		return err
+	}
+
+	observations := 0
+	stations := 0
+	for _, city := range snapshot.Cities {
+		observations += len(city.Observations)
+		stations += len(city.Stations)
+	}
+	fmt.Printf("Format:       %s v%d\n", weathermanager.SnapshotFormat, weathermanager.SnapshotVersion)
+	fmt.Printf("Created at:   %s\n", snapshot.CreatedAt.Format(time.RFC3339))
+	fmt.Printf("Cities:       %d\n", len(snapshot.Cities))
+	fmt.Printf("Observations: %d\n", observations)
+	fmt.Printf("Stations:     %d\n", stations)
+	return nil
+}
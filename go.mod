@@ -5,4 +5,7 @@ go 1.14
 require (
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/stretchr/testify v1.5.1
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/text v0.3.8
+	modernc.org/sqlite v1.14.0
 )
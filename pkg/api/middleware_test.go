@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+type panickingResource struct {
+	ResourceBase
+}
+
+func (p *panickingResource) Register(router *httprouter.Router) {
+	router.GET("/panic/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var weathers map[string]int
+		weathers["vancouver"] = 15
+	})
+	router.GET("/panic-after-write/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		p.SetResponse(http.StatusOK, map[string]string{"message": "ok"}, w)
+		panic("too late")
+	})
+	router.GET("/request-id/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		p.SetResponse(http.StatusOK, map[string]string{"request_id": RequestIDFromContext(r.Context())}, w)
+	})
+}
+
+func TestRecovery_WithPanickingHandler_ReturnInternalError(t *testing.T) {
+	testServer := NewTestServer(context.Background(), t).RegisterResource(&panickingResource{})
+
+	testServer.Test("GET", "/panic/").
+		WithHeader(RequestIDHeader, "abc123").
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusInternalServerError, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/internal_error\",\"title\":\"Internal Server Error\",\"status\":500,\"detail\":\"Internal Server Error\",\"code\":\"internal_error\",\"error\":\"Internal Server Error\",\"request_id\":\"abc123\"}", responseBody)
+	assert.Equal(t, "application/problem+json", testServer.GetResponseHeader("Content-Type"))
+}
+
+func TestRecovery_WithPanicAfterResponse_KeepResponse(t *testing.T) {
+	testServer := NewTestServer(context.Background(), t).RegisterResource(&panickingResource{})
+
+	testServer.Test("GET", "/panic-after-write/").Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"message\":\"ok\"}", responseBody)
+}
+
+func TestRequestID_WithoutHeader_GenerateRequestID(t *testing.T) {
+	testServer := NewTestServer(context.Background(), t).RegisterResource(&panickingResource{})
+
+	testServer.Test("GET", "/request-id/").Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	requestID := testServer.GetResponseHeader(RequestIDHeader)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.NotEmpty(t, requestID)
+	assert.Equal(t, "{\"request_id\":\""+requestID+"\"}", responseBody)
+}
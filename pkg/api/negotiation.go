@@ -0,0 +1,93 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	MediaTypeJSON   = "application/json"
+	MediaTypeCSV    = "text/csv"
+	MediaTypeNDJSON = "application/x-ndjson"
+)
+
+type acceptedRange struct {
+	mediaType string
+	quality   float64
+}
+
+func parseAccept(header string) []acceptedRange {
+	ranges := []acceptedRange{}
+	for _, accepted := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		// Structured JSON types (e.g. the versioned vendor types) are answered
+		// with plain JSON.
+		if strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json") {
+			mediaType = MediaTypeJSON
+		}
+
+		ranges = append(ranges, acceptedRange{mediaType, quality})
+	}
+	return ranges
+}
+
+func matchQuality(ranges []acceptedRange, offer string) (float64, int) {
+	quality, specificity := 0.0, -1
+	offerType := strings.SplitN(offer, "/", 2)[0]
+
+	for _, accepted := range ranges {
+		s := -1
+		switch {
+		case accepted.mediaType == offer:
+			s = 2
+		case accepted.mediaType == offerType+"/*":
+			s = 1
+		case accepted.mediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			quality, specificity = accepted.quality, s
+		}
+	}
+
+	return quality, specificity
+}
+
+// NegotiateContentType picks the offer that best matches the Accept header of
+// the request. The first offer is used when the header is missing; an empty
+// string is returned when none of the offers is acceptable.
+func NegotiateContentType(r *http.Request, offers ...string) string {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(header)
+	if len(ranges) == 0 {
+		return offers[0]
+	}
+
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality, specificity := matchQuality(ranges, offer)
+		if specificity >= 0 && quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{MediaTypeJSON, MediaTypeCSV, MediaTypeNDJSON}
+	cases := map[string]string{
+		"":                                      MediaTypeJSON,
+		"*/*":                                   MediaTypeJSON,
+		"application/json, text/plain, */*":     MediaTypeJSON,
+		"text/csv":                              MediaTypeCSV,
+		"text/*":                                MediaTypeCSV,
+		"application/x-ndjson":                  MediaTypeNDJSON,
+		"text/csv;q=0.5, application/x-ndjson":  MediaTypeNDJSON,
+		"application/vnd.weather.v2+json":       MediaTypeJSON,
+		"text/csv, */*;q=0.1":                   MediaTypeCSV,
+		"application/xml":                       "",
+		"application/json;q=0, text/csv;q=0.2":  MediaTypeCSV,
+		"text/csv;q=invalid, application/json":  MediaTypeJSON,
+		"image/png, application/x-ndjson;q=0.3": MediaTypeNDJSON,
+	}
+
+	for accept, expected := range cases {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		assert.Equal(t, expected, NegotiateContentType(r, offers...), accept)
+	}
+}
@@ -1,11 +1,15 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/felipecurvelo/weather-reporting-api/pkg/authorizer"
 	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
@@ -15,14 +19,95 @@ type ResourceBase struct {
 }
 
 func (b *ResourceBase) ParseFromBody(r *http.Request, requestModel interface{}) error {
-	body, err := ioutil.ReadAll(r.Body)
+	options := OptionsFromContext(r.Context())
+
+	err := b.validateContentType(r, options)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(body, requestModel)
+	maxBodyBytes := options.maxBodyBytes()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil {
+		return internalerror.New(internalerror.CodeInvalidRequestBody, err.Error())
+	}
+	if int64(len(body)) > maxBodyBytes {
+		message := fmt.Sprintf("Request body exceeds %d bytes", maxBodyBytes)
+		return internalerror.New(internalerror.CodeRequestBodyTooLarge, message)
+	}
+
+	if options.StrictJSON {
+		err = b.decodeStrict(body, requestModel)
+	} else {
+		err = json.Unmarshal(body, requestModel)
+	}
 	if err != nil {
-		return fmt.Errorf("Invalid request body (%s)", err.Error())
+		message := fmt.Sprintf("Invalid request body (%s)", err.Error())
+		e := internalerror.New(internalerror.CodeInvalidRequestBody, message)
+		if fieldError, ok := bodyFieldError(err); ok {
+			e = e.WithFieldErrors(fieldError)
+		}
+		return e
+	}
+
+	return nil
+}
+
+// bodyFieldError points at the offending member of the request body when the
+// decoder reports one.
+func bodyFieldError(err error) (internalerror.FieldError, bool) {
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+		return internalerror.FieldError{
+			Pointer: "/" + strings.Replace(typeErr.Field, ".", "/", -1),
+			Detail:  fmt.Sprintf("Expected %s, got %s", typeErr.Type.String(), typeErr.Value),
+		}, true
+	}
+
+	const unknownField = "json: unknown field "
+	if strings.HasPrefix(err.Error(), unknownField) {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), unknownField), `"`)
+		return internalerror.FieldError{
+			Pointer: "/" + field,
+			Detail:  "Unknown field",
+		}, true
+	}
+
+	return internalerror.FieldError{}, false
+}
+
+func (b *ResourceBase) decodeStrict(body []byte, requestModel interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(requestModel)
+	if err == io.EOF {
+		return fmt.Errorf("unexpected end of JSON input")
+	}
+	if err != nil {
+		return err
+	}
+
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after JSON value")
+	}
+
+	return nil
+}
+
+func (b *ResourceBase) validateContentType(r *http.Request, options *ServerOptions) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		if options.RequireJSONContentType {
+			message := "Missing Content-Type, expected application/json"
+			return internalerror.New(internalerror.CodeUnsupportedMediaType, message)
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		message := fmt.Sprintf("Unsupported Content-Type %s, expected application/json", contentType)
+		return internalerror.New(internalerror.CodeUnsupportedMediaType, message)
 	}
 
 	return nil
@@ -31,29 +116,72 @@ func (b *ResourceBase) ParseFromBody(r *http.Request, requestModel interface{})
 func (b *ResourceBase) ValidateAuthToken(ctx context.Context, r *http.Request) error {
 	auth := authorizer.FromContext(ctx)
 	if auth == nil {
-		return internalerror.New("Internal Server Error")
+		return internalerror.New(internalerror.CodeInternal, "Internal Server Error")
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		identity := r.TLS.PeerCertificates[0].Subject.CommonName
+		if auth.ValidateIdentity(identity) {
+			return nil
+		}
 	}
 
 	token := r.Header.Get("Authorization")
 	if token == "" {
-		return internalerror.New("Empty Token")
+		return internalerror.New(internalerror.CodeMissingToken, "Empty Token")
 	}
 	if !auth.ValidateToken(token) {
-		return internalerror.New("Invalid Token")
+		return internalerror.New(internalerror.CodeInvalidToken, "Invalid Token")
 	}
 
 	return nil
 }
 
+// Identity returns who authenticated the request: the common name of its
+// client certificate, or the identity its token was issued to.
+func (b *ResourceBase) Identity(ctx context.Context, r *http.Request) string {
+	auth := authorizer.FromContext(ctx)
+	if auth == nil {
+		return ""
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		identity := r.TLS.PeerCertificates[0].Subject.CommonName
+		if auth.ValidateIdentity(identity) {
+			return identity
+		}
+	}
+
+	return auth.TokenIdentity(r.Header.Get("Authorization"))
+}
+
 func (r *ResourceBase) SetResponse(status int, response interface{}, w http.ResponseWriter) {
 	b := response
 
+	contentType := "application/json"
+	if e, ok := response.(internalerror.InternalError); ok {
+		e.Status = status
+		response = e
+		contentType = internalerror.ContentType
+	}
+
 	_, ok := response.([]byte)
 	if !ok {
 		b, _ = json.Marshal(response)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
 	w.Write(b.([]byte))
 }
+
+// SetError responds with err as a problem document, using the status mapped
+// to its code. Errors that are not InternalError are reported as internal.
+func (r *ResourceBase) SetError(w http.ResponseWriter, req *http.Request, err error) {
+	e := internalerror.From(err, internalerror.CodeInternal)
+	if e.Instance == "" {
+		e.Instance = req.URL.Path
+	}
+
+	r.SetResponse(e.Status, e, w)
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+type echoRequestModel struct {
+	City    string `json:"city"`
+	EndDate string `json:"end_date"`
+}
+
+type echoResource struct {
+	ResourceBase
+}
+
+func (e *echoResource) Register(router *httprouter.Router) {
+	router.POST("/echo/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var requestModel echoRequestModel
+		err := e.ParseFromBody(r, &requestModel)
+		if err != nil {
+			e.SetError(w, r, err)
+			return
+		}
+		e.SetResponse(http.StatusOK, requestModel, w)
+	})
+}
+
+func TestParseFromBody_WithValidBody_ReturnOK(t *testing.T) {
+	testServer := NewTestServer(context.Background(), t).RegisterResource(&echoResource{})
+
+	testServer.Test("POST", "/echo/").
+		WithHeader("Content-Type", "application/json; charset=utf-8").
+		WithBody(`{"city": "vancouver", "end_date": "2020-04-30"}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"end_date\":\"2020-04-30\"}", responseBody)
+}
+
+func TestParseFromBody_WithBodyTooLarge_ReturnRequestEntityTooLarge(t *testing.T) {
+	testServer := NewTestServerWithOptions(context.Background(), t, &ServerOptions{MaxBodyBytes: 32}).
+		RegisterResource(&echoResource{})
+
+	testServer.Test("POST", "/echo/").
+		WithBody(`{"city": "` + strings.Repeat("a", 64) + `"}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/request_body_too_large\",\"title\":\"Request Entity Too Large\",\"status\":413,\"detail\":\"Request body exceeds 32 bytes\",\"instance\":\"/echo/\",\"code\":\"request_body_too_large\",\"error\":\"Request body exceeds 32 bytes\"}", responseBody)
+}
+
+func TestParseFromBody_WithUnknownFieldInLenientMode_ReturnOK(t *testing.T) {
+	testServer := NewTestServer(context.Background(), t).RegisterResource(&echoResource{})
+
+	testServer.Test("POST", "/echo/").
+		WithBody(`{"city": "vancouver", "end_dat": "2020-04-30"}`).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+}
+
+func TestParseFromBody_WithUnknownFieldInStrictMode_ReturnError(t *testing.T) {
+	testServer := NewTestServerWithOptions(context.Background(), t, &ServerOptions{StrictJSON: true}).
+		RegisterResource(&echoResource{})
+
+	testServer.Test("POST", "/echo/").
+		WithBody(`{"city": "vancouver", "end_dat": "2020-04-30"}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Contains(t, responseBody, "unknown field \\\"end_dat\\\"")
+}
+
+func TestParseFromBody_WithTrailingDataInStrictMode_ReturnError(t *testing.T) {
+	testServer := NewTestServerWithOptions(context.Background(), t, &ServerOptions{StrictJSON: true}).
+		RegisterResource(&echoResource{})
+
+	testServer.Test("POST", "/echo/").
+		WithBody(`{"city": "vancouver"} {"city": "toronto"}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Contains(t, responseBody, "unexpected data after JSON value")
+}
+
+func TestParseFromBody_WithUnsupportedContentType_ReturnUnsupportedMediaType(t *testing.T) {
+	testServer := NewTestServer(context.Background(), t).RegisterResource(&echoResource{})
+
+	testServer.Test("POST", "/echo/").
+		WithHeader("Content-Type", "text/plain").
+		WithBody(`{"city": "vancouver"}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/unsupported_media_type\",\"title\":\"Unsupported Media Type\",\"status\":415,\"detail\":\"Unsupported Content-Type text/plain, expected application/json\",\"instance\":\"/echo/\",\"code\":\"unsupported_media_type\",\"error\":\"Unsupported Content-Type text/plain, expected application/json\"}", responseBody)
+}
+
+func TestParseFromBody_WithMissingContentTypeWhenRequired_ReturnUnsupportedMediaType(t *testing.T) {
+	testServer := NewTestServerWithOptions(context.Background(), t, &ServerOptions{RequireJSONContentType: true}).
+		RegisterResource(&echoResource{})
+
+	testServer.Test("POST", "/echo/").
+		WithBody(`{"city": "vancouver"}`).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, statusCode)
+}
+
+func TestParseFromBody_WithWrongFieldType_ReturnFieldError(t *testing.T) {
+	testServer := NewTestServer(context.Background(), t).RegisterResource(&echoResource{})
+
+	testServer.Test("POST", "/echo/").
+		WithBody(`{"city": 10}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, "application/problem+json", testServer.GetResponseHeader("Content-Type"))
+	assert.Contains(t, responseBody, "\"code\":\"invalid_request_body\"")
+	assert.Contains(t, responseBody, "\"errors\":[{\"pointer\":\"/city\",\"detail\":\"Expected string, got number\"}]")
+}
@@ -27,24 +27,25 @@ func (a *Auth) Authorize(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	var requestModel authRequestModel
 	err := a.ParseFromBody(r, &requestModel)
 	if err != nil {
-		a.SetResponse(http.StatusInternalServerError, err, w)
+		e := internalerror.From(err, internalerror.CodeInvalidRequestBody)
+		a.SetResponse(e.Status, e, w)
 		return
 	}
 
 	if requestModel.Name != "kirang" {
-		e := internalerror.New("Invalid Name")
+		e := internalerror.New(internalerror.CodeInvalidCredentials, "Invalid Name")
 		a.SetResponse(http.StatusBadRequest, e, w)
 		return
 	}
 
 	auth := authorizer.FromContext(r.Context())
 	if auth == nil {
-		e := internalerror.New("Internal Server Error")
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
 		a.SetResponse(http.StatusInternalServerError, e, w)
 		return
 	}
 
-	token := auth.GenerateAccessToken()
+	token := auth.GenerateAccessToken(requestModel.Name)
 
 	a.SetResponse(http.StatusOK, authResponseModel{
 		Token: token,
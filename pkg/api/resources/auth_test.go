@@ -47,5 +47,5 @@ func TestAuthEndpoint_WithInvalidName_ReturnError(t *testing.T) {
 	statusCode, responseBody := testServer.GetResponse()
 
 	assert.Equal(t, http.StatusBadRequest, statusCode)
-	assert.Equal(t, "{\"error\":\"Invalid Name\"}", responseBody)
+	assert.Equal(t, "{\"type\":\"/problems/invalid_credentials\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"Invalid Name\",\"code\":\"invalid_credentials\",\"error\":\"Invalid Name\"}", responseBody)
 }
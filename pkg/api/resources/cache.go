@@ -0,0 +1,67 @@
+package resources
+
+import (
+	"net/http"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/julienschmidt/httprouter"
+)
+
+type Cache struct {
+	api.ResourceBase
+	router *httprouter.Router
+}
+
+type cacheStatsModel struct {
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	Evictions     uint64  `json:"evictions"`
+	Invalidations uint64  `json:"invalidations"`
+	Entries       int     `json:"entries"`
+	Bytes         int64   `json:"bytes"`
+	MaxBytes      int64   `json:"max_bytes"`
+}
+
+// cachedWeatherManager is implemented by managers caching the ranges they
+// read, such as weathermanager.CachedWeatherManager.
+type cachedWeatherManager interface {
+	CacheStats() weathermanager.CacheStats
+}
+
+// GetCacheStats responds with the hit and miss counts of the weather cache,
+// or not found when the API runs without it.
+func (c *Cache) GetCacheStats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	cached, ok := weatherMgr.(cachedWeatherManager)
+	if !ok {
+		c.SetResponse(http.StatusNotFound, internalerror.New(internalerror.CodeNotFound, "Cache is disabled"), w)
+		return
+	}
+
+	stats := cached.CacheStats()
+	response := cacheStatsModel{
+		Hits:          stats.Hits,
+		Misses:        stats.Misses,
+		Evictions:     stats.Evictions,
+		Invalidations: stats.Invalidations,
+		Entries:       stats.Entries,
+		Bytes:         stats.Bytes,
+		MaxBytes:      stats.MaxBytes,
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		response.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	c.SetResponse(http.StatusOK, response, w)
+}
+
+func (c *Cache) Register(router *httprouter.Router) {
+	c.router = router
+	c.router.GET("/admin/cache", c.GetCacheStats)
+}
@@ -0,0 +1,128 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestCacheStats(t *testing.T, testServer *api.TestServer, token string) cacheStatsModel {
+	testServer.Test("GET", "/admin/cache").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	require.Equal(t, http.StatusOK, statusCode)
+
+	var stats cacheStatsModel
+	require.NoError(t, json.Unmarshal([]byte(responseBody), &stats))
+	return stats
+}
+
+func getTestWeather(t *testing.T, testServer *api.TestServer, token string, path string) (int, string) {
+	testServer.Test("GET", path).
+		WithHeader("Authorization", token).
+		Now()
+	return testServer.GetResponse()
+}
+
+func TestCache_WithoutCache_ReturnNotFound(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("GET", "/admin/cache").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestCache_EquivalentRanges_ShareEntry(t *testing.T) {
+	weatherMgr := weathermanager.NewCached(weathermanager.New(), 1<<20)
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 14, "2020-04-18": 15, "2020-04-19": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	statusCode, first := getTestWeather(t, testServer, token, "/weather/vancouver?initial_date=2020-04-16&end_date=2020-04-20")
+	assert.Equal(t, http.StatusOK, statusCode)
+	statusCode, second := getTestWeather(t, testServer, token, "/weather/VANCOUVER?initial_date=2020-04-17&end_date=2020-04-19&inclusive=both")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, first, "[{\"date\":\"2020-04-17\",\"temperature\":14},{\"date\":\"2020-04-18\",\"temperature\":15},{\"date\":\"2020-04-19\",\"temperature\":16}]")
+	assert.Contains(t, second, "[{\"date\":\"2020-04-17\",\"temperature\":14},{\"date\":\"2020-04-18\",\"temperature\":15},{\"date\":\"2020-04-19\",\"temperature\":16}]")
+
+	stats := getTestCacheStats(t, testServer, token)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 0.5, stats.HitRatio)
+	assert.Equal(t, 1, stats.Entries)
+}
+
+func TestCache_WriteToCity_InvalidateOnlyThatCity(t *testing.T) {
+	weatherMgr := weathermanager.NewCached(weathermanager.New(), 1<<20)
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	weatherMgr.SaveWeather("toronto", map[string]int{"2020-04-18": 9})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	getTestWeather(t, testServer, token, "/weather/vancouver?initial_date=2020-04-01&end_date=2020-04-30")
+	getTestWeather(t, testServer, token, "/weather/toronto?initial_date=2020-04-01&end_date=2020-04-30")
+
+	testServer.Test("PUT", "/cities/vancouver/observations/2020-04-18").
+		WithHeader("Authorization", token).
+		WithBody(`{"temperature": 20}`).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	statusCode, responseBody := getTestWeather(t, testServer, token, "/weather/vancouver?initial_date=2020-04-01&end_date=2020-04-30")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-18\",\"temperature\":20}]}", responseBody)
+	getTestWeather(t, testServer, token, "/weather/toronto?initial_date=2020-04-01&end_date=2020-04-30")
+
+	stats := getTestCacheStats(t, testServer, token)
+	assert.Equal(t, uint64(1), stats.Hits, "toronto stays cached")
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Invalidations)
+}
+
+func TestCache_DeleteCity_ReturnNotFound(t *testing.T) {
+	weatherMgr := weathermanager.NewCached(weathermanager.New(), 1<<20)
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	statusCode, _ := getTestWeather(t, testServer, token, "/weather/vancouver?initial_date=2020-04-01&end_date=2020-04-30")
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	testServer.Test("DELETE", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	statusCode, _ = getTestWeather(t, testServer, token, "/weather/vancouver?initial_date=2020-04-01&end_date=2020-04-30")
+	assert.Equal(t, http.StatusNotFound, statusCode)
+	assert.Equal(t, 0, getTestCacheStats(t, testServer, token).Entries)
+}
+
+func TestCache_OverMaxBytes_EvictLeastRecentlyUsed(t *testing.T) {
+	weatherMgr := weathermanager.NewCached(weathermanager.New(), 1024)
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	for _, from := range []string{"2020-04-01", "2020-04-02", "2020-04-03", "2020-04-04", "2020-04-05"} {
+		statusCode, _ := getTestWeather(t, testServer, token, "/weather/vancouver?initial_date="+from+"&end_date=2020-04-30")
+		assert.Equal(t, http.StatusOK, statusCode)
+	}
+	stats := getTestCacheStats(t, testServer, token)
+	assert.True(t, stats.Bytes <= 1024)
+	assert.True(t, stats.Evictions > 0)
+	assert.Equal(t, 5, stats.Entries+int(stats.Evictions))
+
+	// The most recent range is still cached, the first one was evicted.
+	getTestWeather(t, testServer, token, "/weather/vancouver?initial_date=2020-04-05&end_date=2020-04-30")
+	getTestWeather(t, testServer, token, "/weather/vancouver?initial_date=2020-04-01&end_date=2020-04-30")
+	stats = getTestCacheStats(t, testServer, token)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(6), stats.Misses)
+}
@@ -0,0 +1,441 @@
+package resources
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/authorizer"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/julienschmidt/httprouter"
+)
+
+type Cities struct {
+	api.ResourceBase
+	router *httprouter.Router
+}
+
+type cityResponseModel struct {
+	City         string   `json:"city"`
+	Name         string   `json:"name"`
+	Country      string   `json:"country,omitempty"`
+	Region       string   `json:"region,omitempty"`
+	Aliases      []string `json:"aliases,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"`
+	Longitude    *float64 `json:"longitude,omitempty"`
+	Elevation    *float64 `json:"elevation,omitempty"`
+	Observations int      `json:"observations"`
+	FirstDate    string   `json:"first_date,omitempty"`
+	LastDate     string   `json:"last_date,omitempty"`
+}
+
+type deletedCityResponseModel struct {
+	cityResponseModel
+	DeletedAt string `json:"deleted_at"`
+	PurgeAt   string `json:"purge_at"`
+}
+
+type deletedCityListResponseModel struct {
+	Cities []deletedCityResponseModel `json:"cities"`
+}
+
+type cityListResponseModel struct {
+	Cities     []cityResponseModel `json:"cities"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+type observationsRequestModel struct {
+	Weather []weatherEntry `json:"weather"`
+}
+
+// cityRequestModel registers the city under its region and country (e.g. to
+// tell apart two cities named Springfield), with its aliases and location.
+type cityRequestModel struct {
+	Weather   []weatherEntry `json:"weather"`
+	Country   string         `json:"country"`
+	Region    string         `json:"region"`
+	Aliases   []string       `json:"aliases"`
+	Latitude  *float64       `json:"latitude"`
+	Longitude *float64       `json:"longitude"`
+	Elevation *float64       `json:"elevation"`
+}
+
+func (m cityRequestModel) qualified() bool {
+	return m.Country != "" || m.Region != "" || len(m.Aliases) > 0 || m.located()
+}
+
+func (m cityRequestModel) located() bool {
+	return m.Latitude != nil && m.Longitude != nil
+}
+
+func (m cityRequestModel) coordinates() *weathermanager.Coordinates {
+	return toCoordinates(m.Latitude, m.Longitude, m.Elevation)
+}
+
+// toCoordinates returns nil unless both latitude and longitude are given.
+func toCoordinates(latitude *float64, longitude *float64, elevation *float64) *weathermanager.Coordinates {
+	if latitude == nil || longitude == nil {
+		return nil
+	}
+
+	coordinates := weathermanager.Coordinates{Latitude: *latitude, Longitude: *longitude}
+	if elevation != nil {
+		coordinates.Elevation = *elevation
+	}
+	return &coordinates
+}
+
+// fromCoordinates returns the location members of a response, elevation
+// being left out when zero.
+func fromCoordinates(c *weathermanager.Coordinates) (latitude *float64, longitude *float64, elevation *float64) {
+	if c == nil {
+		return nil, nil, nil
+	}
+	if c.Elevation != 0 {
+		elevation = &c.Elevation
+	}
+	return &c.Latitude, &c.Longitude, elevation
+}
+
+// authorizeWeatherRequest runs the checks shared by every weather handler and
+// writes the error response itself when one of them fails. The returned
+// manager records the authenticated identity as the author of its changes.
+func authorizeWeatherRequest(base *api.ResourceBase, w http.ResponseWriter, r *http.Request) (weathermanager.WeatherManager, bool) {
+	ctx := r.Context()
+	auth := authorizer.FromContext(ctx)
+	if auth == nil {
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
+		base.SetResponse(http.StatusInternalServerError, e, w)
+		return nil, false
+	}
+
+	weatherMgr := weathermanager.FromContext(ctx)
+	if weatherMgr == nil {
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
+		base.SetResponse(http.StatusInternalServerError, e, w)
+		return nil, false
+	}
+
+	err := base.ValidateAuthToken(ctx, r)
+	if err != nil {
+		e := internalerror.Wrap(err, internalerror.CodeInvalidToken, "Error validating auth token")
+		base.SetResponse(http.StatusUnauthorized, e, w)
+		return nil, false
+	}
+
+	return weatherMgr.WithActor(base.Identity(ctx, r)), true
+}
+
+// parseBody reads the optional body of a request into requestModel and
+// validates it, writing the error response itself when either fails.
+func parseBody(base *api.ResourceBase, w http.ResponseWriter, r *http.Request, requestModel interface{}, validate func() error) bool {
+	if r.ContentLength != 0 {
+		err := base.ParseFromBody(r, requestModel)
+		if err != nil {
+			e := internalerror.Wrap(err, internalerror.CodeInvalidRequestBody, "Error parsing request body")
+			base.SetResponse(e.Status, e, w)
+			return false
+		}
+	}
+
+	err := validate()
+	if err != nil {
+		base.SetError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// parseObservations reads and validates the observations sent for city. An
+// empty body is read as no observations.
+func parseObservations(base *api.ResourceBase, w http.ResponseWriter, r *http.Request, city string) (map[string]int, bool) {
+	var requestModel observationsRequestModel
+	ok := parseBody(base, w, r, &requestModel, func() error {
+		return requestModel.validate(city)
+	})
+	if !ok {
+		return nil, false
+	}
+
+	return toWeatherReport(requestModel.Weather), true
+}
+
+// resolveCity finds the registered city a name refers to, writing the error
+// response itself when it is unknown or ambiguous.
+func resolveCity(base *api.ResourceBase, w http.ResponseWriter, weatherMgr weathermanager.WeatherManager, name string) (weathermanager.City, bool) {
+	city, err := weatherMgr.ResolveCity(name)
+	if errors.Is(err, weathermanager.ErrNotFound) {
+		base.SetResponse(http.StatusNotFound, internalerror.New(internalerror.CodeNotFound, "City not found"), w)
+		return city, false
+	}
+	if err != nil {
+		e := weatherManagerError(err, "")
+		base.SetResponse(e.Status, e, w)
+		return city, false
+	}
+
+	return city, true
+}
+
+func toCityResponseModel(summary weathermanager.CitySummary) cityResponseModel {
+	response := cityResponseModel{
+		City:         summary.City,
+		Name:         summary.Name,
+		Country:      summary.Country,
+		Region:       summary.Region,
+		Aliases:      summary.Aliases,
+		Observations: summary.Observations,
+		FirstDate:    summary.FirstDate,
+		LastDate:     summary.LastDate,
+	}
+	response.Latitude, response.Longitude, response.Elevation = fromCoordinates(summary.Coordinates)
+	return response
+}
+
+func (c *Cities) ListCities(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	options := weathermanager.ListCitiesOptions{
+		Prefix:     query.Get("prefix"),
+		SortBy:     query.Get("sort"),
+		Descending: query.Get("order") == "desc",
+		Cursor:     query.Get("cursor"),
+	}
+	if order := query.Get("order"); order != "" && order != "asc" && order != "desc" {
+		c.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, "Invalid order "+order), w)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		options.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			c.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, "Invalid limit "+limit), w)
+			return
+		}
+	}
+
+	page, err := weatherMgr.ListCities(options)
+	if errors.Is(err, weathermanager.ErrValidation) {
+		c.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+		return
+	}
+	if err != nil {
+		e := weatherManagerError(err, "Error listing cities")
+		c.SetResponse(e.Status, e, w)
+		return
+	}
+
+	response := cityListResponseModel{
+		Cities:     []cityResponseModel{},
+		NextCursor: page.NextCursor,
+	}
+	for _, summary := range page.Cities {
+		response.Cities = append(response.Cities, toCityResponseModel(summary))
+	}
+
+	c.SetResponse(http.StatusOK, response, w)
+}
+
+func (c *Cities) GetCity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&c.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	temperatures, _ := weatherMgr.GetAllWeather(city.ID)
+	c.SetResponse(http.StatusOK, toCityResponseModel(weathermanager.SummarizeCity(city, temperatures)), w)
+}
+
+func (c *Cities) PutCity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	name := ps.ByName("city")
+	var requestModel cityRequestModel
+	ok = parseBody(&c.ResourceBase, w, r, &requestModel, func() error {
+		return requestModel.validate(name)
+	})
+	if !ok {
+		return
+	}
+
+	// A qualified city is looked up by its canonical ID, so registering
+	// Springfield, IL does not overwrite another Springfield.
+	target := name
+	if requestModel.qualified() {
+		target = weathermanager.CityID(name, requestModel.Region, requestModel.Country)
+	}
+	_, exists := weatherMgr.GetAllWeather(target)
+
+	if requestModel.qualified() {
+		_, err := weatherMgr.RegisterCity(weathermanager.City{
+			Name:        name,
+			Country:     requestModel.Country,
+			Region:      requestModel.Region,
+			Aliases:     requestModel.Aliases,
+			Coordinates: requestModel.coordinates(),
+		})
+		if err != nil {
+			e := weatherManagerError(err, "Error registering city")
+			c.SetResponse(e.Status, e, w)
+			return
+		}
+	}
+
+	temperatures := toWeatherReport(requestModel.Weather)
+	err := weatherMgr.SaveWeather(target, temperatures)
+	if err != nil {
+		e := weatherManagerError(err, "Error saving weather")
+		c.SetResponse(e.Status, e, w)
+		return
+	}
+
+	city, err := weatherMgr.ResolveCity(target)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		c.SetResponse(e.Status, e, w)
+		return
+	}
+
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	c.SetResponse(status, toCityResponseModel(weathermanager.SummarizeCity(city, temperatures)), w)
+}
+
+func (c *Cities) PatchCity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&c.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	var requestModel cityRequestModel
+	ok = parseBody(&c.ResourceBase, w, r, &requestModel, func() error {
+		return requestModel.validatePatch(city)
+	})
+	if !ok {
+		return
+	}
+
+	if len(requestModel.Aliases) > 0 || requestModel.located() {
+		city.Aliases = requestModel.Aliases
+		city.Coordinates = requestModel.coordinates()
+		_, err := weatherMgr.RegisterCity(city)
+		if err != nil {
+			e := weatherManagerError(err, "Error registering city")
+			c.SetResponse(e.Status, e, w)
+			return
+		}
+	}
+
+	err := weatherMgr.MergeWeather(city.ID, toWeatherReport(requestModel.Weather))
+	if err != nil {
+		e := weatherManagerError(err, "Error saving weather")
+		c.SetResponse(e.Status, e, w)
+		return
+	}
+
+	city, _ = weatherMgr.ResolveCity(city.ID)
+	merged, _ := weatherMgr.GetAllWeather(city.ID)
+	c.SetResponse(http.StatusOK, toCityResponseModel(weathermanager.SummarizeCity(city, merged)), w)
+}
+
+func (c *Cities) DeleteCity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&c.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	err := weatherMgr.DeleteWeather(city.ID)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		c.SetResponse(e.Status, e, w)
+		return
+	}
+
+	c.SetResponse(http.StatusOK, messageResponseModel{
+		"The city was deleted succesfully!",
+	}, w)
+}
+
+// UndeleteCity restores a deleted city, with its observations and stations,
+// until it is purged.
+func (c *Cities) UndeleteCity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, err := weatherMgr.UndeleteWeather(ps.ByName("city"))
+	if err != nil {
+		e := weatherManagerError(err, "")
+		c.SetResponse(e.Status, e, w)
+		return
+	}
+
+	temperatures, _ := weatherMgr.GetAllWeather(city.ID)
+	c.SetResponse(http.StatusOK, toCityResponseModel(weathermanager.SummarizeCity(city, temperatures)), w)
+}
+
+func (c *Cities) ListDeletedCities(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := weatherMgr.ListDeleted()
+	if err != nil {
+		e := weatherManagerError(err, "")
+		c.SetResponse(e.Status, e, w)
+		return
+	}
+
+	response := deletedCityListResponseModel{Cities: []deletedCityResponseModel{}}
+	for _, d := range deleted {
+		summary := weathermanager.SummarizeCity(d.City, nil)
+		summary.Observations = d.Observations
+		response.Cities = append(response.Cities, deletedCityResponseModel{
+			cityResponseModel: toCityResponseModel(summary),
+			DeletedAt:         d.DeletedAt.Format(time.RFC3339),
+			PurgeAt:           d.PurgeAt.Format(time.RFC3339),
+		})
+	}
+	c.SetResponse(http.StatusOK, response, w)
+}
+
+func (c *Cities) Register(router *httprouter.Router) {
+	c.router = router
+	c.router.GET("/cities", c.ListCities)
+	c.router.GET("/cities/:city", c.GetCity)
+	c.router.PUT("/cities/:city", c.PutCity)
+	c.router.PATCH("/cities/:city", c.PatchCity)
+	c.router.DELETE("/cities/:city", c.DeleteCity)
+	c.router.GET("/geo/cities", c.NearbyCities)
+	c.router.POST("/cities/:city/undelete", c.UndeleteCity)
+	c.router.GET("/deleted/cities", c.ListDeletedCities)
+}
@@ -0,0 +1,483 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCitiesList_WithEmptyAuthHeader_ReturnUnauthorized(t *testing.T) {
+	testServer, _ := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("GET", "/cities").Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/missing_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Error validating auth token (Empty Token)\",\"code\":\"missing_token\",\"error\":\"Error validating auth token (Empty Token)\"}", responseBody)
+}
+
+func TestCitiesList_ReturnOK(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+	weatherMgr.SaveWeather("toronto", map[string]int{"2020-04-18": 10})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"cities\":["+
+		"{\"city\":\"toronto\",\"name\":\"toronto\",\"observations\":1,\"first_date\":\"2020-04-18\",\"last_date\":\"2020-04-18\"},"+
+		"{\"city\":\"vancouver\",\"name\":\"vancouver\",\"observations\":2,\"first_date\":\"2020-04-18\",\"last_date\":\"2020-04-19\"}]}", responseBody)
+}
+
+func TestCityGet_WithUnknownCity_ReturnNotFound(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("GET", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusNotFound, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/not_found\",\"title\":\"Not Found\",\"status\":404,\"detail\":\"City not found\",\"code\":\"not_found\",\"error\":\"City not found\"}", responseBody)
+}
+
+func TestCityPut_ReturnCreatedThenOK(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("PUT", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		WithBody(`{"weather": [{"date": "2020-04-18", "temperature": 15}]}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusCreated, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"name\":\"vancouver\",\"observations\":1,\"first_date\":\"2020-04-18\",\"last_date\":\"2020-04-18\"}", responseBody)
+
+	testServer.Test("PUT", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"name\":\"vancouver\",\"observations\":0}", responseBody)
+}
+
+func TestCityPatch_MergeObservations(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PATCH", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		WithBody(`{"weather": [{"date": "2020-04-19", "temperature": 16}]}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"name\":\"vancouver\",\"observations\":2,\"first_date\":\"2020-04-18\",\"last_date\":\"2020-04-19\"}", responseBody)
+}
+
+func TestCityDelete_ReturnOK(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("DELETE", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"message\":\"The city was deleted succesfully!\"}", responseBody)
+
+	_, ok := weatherMgr.GetAllWeather("vancouver")
+	assert.False(t, ok)
+}
+
+func TestCitiesList_WithPrefixAndSort_ReturnFilteredCities(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	weatherMgr.SaveWeather("valencia", map[string]int{"2020-04-18": 20, "2020-04-19": 21})
+	weatherMgr.SaveWeather("toronto", map[string]int{"2020-04-18": 10})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities?prefix=VA&sort=observations&order=desc").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	var response cityListResponseModel
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Len(t, response.Cities, 2)
+	assert.Equal(t, "valencia", response.Cities[0].City)
+	assert.Equal(t, "vancouver", response.Cities[1].City)
+	assert.Empty(t, response.NextCursor)
+}
+
+func TestCitiesList_WithLimit_ReturnPagesUntilExhausted(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	for _, city := range []string{"ottawa", "toronto", "vancouver", "calgary", "montreal"} {
+		weatherMgr.SaveWeather(city, map[string]int{"2020-04-18": 15})
+	}
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	cities := []string{}
+	url := "/cities?limit=2"
+	for pages := 0; pages < 5; pages++ {
+		testServer.Test("GET", url).
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, responseBody := testServer.GetResponse()
+		assert.Equal(t, http.StatusOK, statusCode)
+
+		var response cityListResponseModel
+		assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+		for _, c := range response.Cities {
+			cities = append(cities, c.City)
+		}
+
+		if response.NextCursor == "" {
+			break
+		}
+		url = "/cities?limit=2&cursor=" + response.NextCursor
+	}
+
+	assert.Equal(t, []string{"calgary", "montreal", "ottawa", "toronto", "vancouver"}, cities)
+}
+
+func TestCitiesList_WithInvalidParams_ReturnError(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	for _, url := range []string{"/cities?sort=population", "/cities?limit=abc", "/cities?cursor=%21%21", "/cities?order=up"} {
+		testServer.Test("GET", url).
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, _ := testServer.GetResponse()
+		assert.Equal(t, http.StatusBadRequest, statusCode, url)
+	}
+}
+
+// unavailableCitiesManager fails to list cities, as a storage that can not
+// be reached would.
+type unavailableCitiesManager struct {
+	weathermanager.WeatherManager
+}
+
+func (m unavailableCitiesManager) ListCities(weathermanager.ListCitiesOptions) (weathermanager.CityPage, error) {
+	return weathermanager.CityPage{}, weathermanager.StorageError(errors.New("database is closed"), "Error reading cities")
+}
+
+func (m unavailableCitiesManager) WithActor(string) weathermanager.WeatherManager {
+	return m
+}
+
+func TestCitiesList_WithStorageFailure_ReturnServiceUnavailable(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, unavailableCitiesManager{weathermanager.New()})
+
+	testServer.Test("GET", "/cities").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode)
+	assert.Contains(t, responseBody, "\"code\":\"storage_unavailable\"")
+}
+
+func TestCityGet_WithAccentAndSpacingVariants_ReturnSameCity(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("São Paulo", map[string]int{"2020-04-18": 25})
+	weatherMgr.MergeWeather("sao-paulo ", map[string]int{"2020-04-19": 26})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/Sao%20Paulo").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"sao-paulo\",\"name\":\"São Paulo\",\"observations\":2,\"first_date\":\"2020-04-18\",\"last_date\":\"2020-04-19\"}", responseBody)
+}
+
+func TestCityPut_WithCountryAndRegion_DisambiguateCities(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("PUT", "/cities/Springfield").
+		WithHeader("Authorization", token).
+		WithBody(`{"country": "us", "region": "IL", "weather": [{"date": "2020-04-18", "temperature": 15}]}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusCreated, statusCode)
+	assert.Equal(t, "{\"city\":\"springfield-il-us\",\"name\":\"Springfield\",\"country\":\"US\",\"region\":\"IL\",\"observations\":1,\"first_date\":\"2020-04-18\",\"last_date\":\"2020-04-18\"}", responseBody)
+
+	testServer.Test("PUT", "/cities/Springfield").
+		WithHeader("Authorization", token).
+		WithBody(`{"country": "US", "region": "MO", "aliases": ["Queen City of the Ozarks"]}`).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusCreated, statusCode)
+
+	testServer.Test("GET", "/cities/springfield").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+	assert.Equal(t, http.StatusConflict, statusCode)
+	assert.Contains(t, responseBody, "City springfield is ambiguous, use one of springfield-il-us, springfield-mo-us")
+
+	testServer.Test("GET", "/cities/Queen%20City%20of%20the%20Ozarks").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, responseBody, "\"city\":\"springfield-mo-us\"")
+
+	testServer.Test("GET", "/weather/springfield-il-us?date=2020-04-18").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, responseBody, "\"temperature\":15")
+}
+
+func TestCityPatch_WithAliasUsedByAnotherCity_ReturnConflict(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.RegisterCity(weathermanager.City{Name: "New York", Aliases: []string{"NYC"}})
+	weatherMgr.SaveWeather("Boston", map[string]int{})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PATCH", "/cities/boston").
+		WithHeader("Authorization", token).
+		WithBody(`{"aliases": ["nyc"]}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusConflict, statusCode)
+	assert.Contains(t, responseBody, "Alias nyc is already used by new-york")
+}
+
+func TestCityPut_WithAliasNamingAnotherCity_ReturnConflict(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.RegisterCity(weathermanager.City{Name: "Paris", Country: "FR"})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/cities/Paris").
+		WithHeader("Authorization", token).
+		WithBody(`{"country": "US", "region": "TX", "aliases": ["paris"]}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusConflict, statusCode)
+	assert.Contains(t, responseBody, "Alias paris is already used by paris-fr")
+}
+
+func TestCityDelete_WithAlias_DeleteCity(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.RegisterCity(weathermanager.City{Name: "New York", Aliases: []string{"NYC"}})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("DELETE", "/cities/nyc").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	_, err := weatherMgr.ResolveCity("New York")
+	assert.True(t, errors.Is(err, weathermanager.ErrNotFound))
+}
+
+func newLocatedCitiesManager() *weathermanager.MainWeatherManager {
+	weatherMgr := weathermanager.New()
+	weatherMgr.RegisterCity(weathermanager.City{Name: "Vancouver", Coordinates: &weathermanager.Coordinates{Latitude: 49.28, Longitude: -123.12}})
+	weatherMgr.RegisterCity(weathermanager.City{Name: "Seattle", Coordinates: &weathermanager.Coordinates{Latitude: 47.61, Longitude: -122.33, Elevation: 53}})
+	weatherMgr.RegisterCity(weathermanager.City{Name: "Toronto", Coordinates: &weathermanager.Coordinates{Latitude: 43.65, Longitude: -79.38}})
+	weatherMgr.RegisterCity(weathermanager.City{Name: "Suva", Coordinates: &weathermanager.Coordinates{Latitude: -18.14, Longitude: 178.44}})
+	weatherMgr.MergeWeather("Vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+	return weatherMgr
+}
+
+func TestNearbyCities_WithPoint_ReturnNearestFirst(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, newLocatedCitiesManager())
+
+	testServer.Test("GET", "/geo/cities?lat=49.2&lon=-123.1&limit=2").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	var response nearbyCitiesResponseModel
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Len(t, response.Cities, 2)
+	assert.Equal(t, "vancouver", response.Cities[0].City)
+	assert.Equal(t, &latestObservationModel{Date: "2020-04-19", Temperature: 16}, response.Cities[0].Latest)
+	assert.Equal(t, 2, response.Cities[0].Observations)
+	assert.Equal(t, "seattle", response.Cities[1].City)
+	assert.InDelta(t, 180, response.Cities[1].DistanceKm, 10)
+	assert.Nil(t, response.Cities[1].Latest)
+	assert.Equal(t, 53.0, *response.Cities[1].Elevation)
+}
+
+func TestNearbyCities_WithRadius_ReturnCitiesWithinRadius(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, newLocatedCitiesManager())
+
+	testServer.Test("GET", "/geo/cities?lat=49.2&lon=-123.1&radius=100").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	var response nearbyCitiesResponseModel
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Len(t, response.Cities, 1)
+	assert.Equal(t, "vancouver", response.Cities[0].City)
+}
+
+func TestNearbyCities_WithBoundingBoxAcrossAntimeridian_ReturnCitiesInside(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, newLocatedCitiesManager())
+
+	testServer.Test("GET", "/geo/cities?bbox=170,-30,-120,50").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	var response nearbyCitiesResponseModel
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Len(t, response.Cities, 3)
+	assert.Equal(t, "seattle", response.Cities[0].City)
+	assert.Equal(t, "suva", response.Cities[1].City)
+	assert.Equal(t, "vancouver", response.Cities[2].City)
+}
+
+func TestNearbyCities_WithInvalidParams_ReturnError(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, newLocatedCitiesManager())
+
+	for _, url := range []string{"/geo/cities", "/geo/cities?lat=49", "/geo/cities?lat=91&lon=0", "/geo/cities?lat=a&lon=0",
+		"/geo/cities?lat=0&lon=0&limit=0", "/geo/cities?lat=0&lon=0&radius=-1", "/geo/cities?bbox=1,2,3",
+		"/geo/cities?bbox=0,10,10,0", "/geo/cities?bbox=0,0,10,10&lat=1"} {
+		testServer.Test("GET", url).
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, responseBody := testServer.GetResponse()
+		assert.Equal(t, http.StatusBadRequest, statusCode, url)
+		assert.Contains(t, responseBody, "invalid_parameter", url)
+	}
+}
+
+func TestCityPut_WithCoordinates_ReturnLocatedCity(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("PUT", "/cities/Quito").
+		WithHeader("Authorization", token).
+		WithBody(`{"latitude": -0.18, "longitude": -78.47, "elevation": 2850}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusCreated, statusCode)
+	assert.Equal(t, "{\"city\":\"quito\",\"name\":\"Quito\",\"latitude\":-0.18,\"longitude\":-78.47,\"elevation\":2850,\"observations\":0}", responseBody)
+}
+
+func TestCityPut_WithInvalidCoordinates_ReturnAllViolations(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("PUT", "/cities/Quito").
+		WithHeader("Authorization", token).
+		WithBody(`{"latitude": 95, "elevation": 20000}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, responseBody, "{\"pointer\":\"/longitude\",\"detail\":\"Empty longitude\"}")
+	assert.Contains(t, responseBody, "{\"pointer\":\"/latitude\",\"detail\":\"Latitude 95 is out of range [-90, 90]\"}")
+	assert.Contains(t, responseBody, "{\"pointer\":\"/elevation\",\"detail\":\"Elevation requires latitude and longitude\"}")
+	assert.Contains(t, responseBody, "{\"pointer\":\"/elevation\",\"detail\":\"Elevation 20000 is out of range [-500, 9000]\"}")
+}
+
+func TestCityUndelete_RestoreObservationsAndStations(t *testing.T) {
+	weatherMgr := newStationsManager()
+	weatherMgr.MergeWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("DELETE", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	testServer.Test("GET", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusNotFound, statusCode)
+
+	testServer.Test("GET", "/deleted/cities").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	var deleted deletedCityListResponseModel
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &deleted))
+	assert.Equal(t, http.StatusOK, statusCode)
+	if assert.Len(t, deleted.Cities, 1) {
+		assert.Equal(t, "vancouver", deleted.Cities[0].City)
+		assert.Equal(t, 1, deleted.Cities[0].Observations)
+		assert.NotEmpty(t, deleted.Cities[0].PurgeAt)
+	}
+
+	testServer.Test("POST", "/cities/vancouver/undelete").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"name\":\"vancouver\",\"observations\":1,\"first_date\":\"2020-04-18\",\"last_date\":\"2020-04-18\"}", responseBody)
+
+	stations, err := weatherMgr.ListStations("vancouver")
+	assert.NoError(t, err)
+	assert.Len(t, stations, 3)
+
+	testServer.Test("POST", "/cities/vancouver/undelete").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestCityUndelete_WithCityCreatedAgain_ReturnConflict(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	weatherMgr.DeleteWeather("vancouver")
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-19": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("POST", "/cities/vancouver/undelete").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusConflict, statusCode)
+	assert.Contains(t, responseBody, "City vancouver was created again after it was deleted")
+}
+
+func TestCityUndelete_AfterRetention_ReturnNotFound(t *testing.T) {
+	weatherMgr := weathermanager.NewWithOptions(weathermanager.Options{DeletionRetention: 0})
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	weatherMgr.DeleteWeather("vancouver")
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/deleted/cities").
+		WithHeader("Authorization", token).
+		Now()
+	_, responseBody := testServer.GetResponse()
+	assert.Equal(t, "{\"cities\":[]}", responseBody)
+
+	testServer.Test("POST", "/cities/vancouver/undelete").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
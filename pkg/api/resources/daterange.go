@@ -0,0 +1,98 @@
+package resources
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+)
+
+const maxRelativeDays = 3660
+
+// dateRangeParameters select the observations of a report, as_of being the
+// point in time they are read at.
+var dateRangeParameters = []string{"date", "last", "initial_date", "end_date", "inclusive", "as_of"}
+
+func hasDateRange(query url.Values) bool {
+	for _, name := range dateRangeParameters {
+		if query.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRelativeDays reads ranges like 30d or 4w into a number of days.
+func parseRelativeDays(last string) (int, error) {
+	value, unit := last, 1
+	switch {
+	case strings.HasSuffix(last, "d"):
+		value = strings.TrimSuffix(last, "d")
+	case strings.HasSuffix(last, "w"):
+		value, unit = strings.TrimSuffix(last, "w"), 7
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 || n*unit > maxRelativeDays {
+		return 0, fmt.Errorf("Invalid last %s", last)
+	}
+	return n * unit, nil
+}
+
+// parseDateRange reads the range of dates a report is filtered by from the
+// query: a single date, the last days up to now, or initial_date and end_date,
+// either of which may be left out for an open-ended range. Both ends of the
+// latter are excluded unless set in inclusive (start, end, both or none).
+func parseDateRange(query url.Values, now time.Time) (weathermanager.DateRange, error) {
+	date, last := query.Get("date"), query.Get("last")
+	initialDate, endDate := query.Get("initial_date"), query.Get("end_date")
+	inclusive := query.Get("inclusive")
+
+	explicit := initialDate != "" || endDate != "" || inclusive != ""
+	switch {
+	case date != "" && (last != "" || explicit):
+		return weathermanager.DateRange{}, fmt.Errorf("Invalid date range, date can not be combined with other range parameters")
+	case last != "" && explicit:
+		return weathermanager.DateRange{}, fmt.Errorf("Invalid date range, last can not be combined with other range parameters")
+	case date != "":
+		return weathermanager.SingleDay(date), nil
+	case last != "":
+		days, err := parseRelativeDays(last)
+		if err != nil {
+			return weathermanager.DateRange{}, err
+		}
+		return weathermanager.LastDays(days, now), nil
+	}
+
+	dateRange := weathermanager.Between(initialDate, endDate)
+	switch inclusive {
+	case "", "none":
+	case "start":
+		dateRange.FromInclusive = true
+	case "end":
+		dateRange.ToInclusive = true
+	case "both":
+		dateRange.FromInclusive, dateRange.ToInclusive = true, true
+	default:
+		return weathermanager.DateRange{}, fmt.Errorf("Invalid inclusive %s", inclusive)
+	}
+	return dateRange, nil
+}
+
+// parseAsOf reads the RFC 3339 timestamp reports are read at, zero meaning
+// now.
+func parseAsOf(query url.Values) (time.Time, error) {
+	asOf := query.Get("as_of")
+	if asOf == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, asOf)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid as_of %s, expected an RFC 3339 timestamp", asOf)
+	}
+	return t, nil
+}
@@ -0,0 +1,36 @@
+package resources
+
+import (
+	"errors"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+)
+
+var weatherManagerCodes = []struct {
+	kind error
+	code internalerror.Code
+}{
+	{weathermanager.ErrNotFound, internalerror.CodeNotFound},
+	{weathermanager.ErrValidation, internalerror.CodeValidationFailed},
+	{weathermanager.ErrConflict, internalerror.CodeConflict},
+	{weathermanager.ErrStorage, internalerror.CodeStorageUnavailable},
+}
+
+// weatherManagerError maps an error returned by the weather manager to the
+// problem sent to the client, prefixing its message when one is given.
+// Errors of an unknown kind are reported as internal errors.
+func weatherManagerError(err error, message string) internalerror.InternalError {
+	code := internalerror.CodeInternal
+	for _, c := range weatherManagerCodes {
+		if errors.Is(err, c.kind) {
+			code = c.code
+			break
+		}
+	}
+
+	if message == "" {
+		return internalerror.New(code, err.Error())
+	}
+	return internalerror.Wrap(err, code, message)
+}
@@ -0,0 +1,36 @@
+package resources
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeatherManagerError_MapKindToStatus(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{weathermanager.NotFoundError("Weather report not found"), http.StatusNotFound},
+		{weathermanager.ValidationError("Invalid date range"), http.StatusUnprocessableEntity},
+		{weathermanager.ConflictError("City already exists"), http.StatusConflict},
+		{weathermanager.StorageError(fmt.Errorf("disk full"), "Error writing"), http.StatusServiceUnavailable},
+		{fmt.Errorf("Saving (%w)", weathermanager.NotFoundError("Weather report not found")), http.StatusNotFound},
+		{fmt.Errorf("unexpected"), http.StatusInternalServerError},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.status, weatherManagerError(c.err, "").Status, c.err.Error())
+	}
+}
+
+func TestWeatherManagerError_WithMessage_PrefixDetail(t *testing.T) {
+	e := weatherManagerError(weathermanager.ValidationError("Invalid date 2020-13-01"), "Error saving weather")
+
+	assert.Equal(t, internalerror.CodeValidationFailed, e.Code)
+	assert.Equal(t, "Error saving weather (Invalid date 2020-13-01)", e.Error())
+}
@@ -0,0 +1,274 @@
+package resources
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/validation"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	importModeAtomic     = "atomic"
+	importModeBestEffort = "best_effort"
+	maxImportRowErrors   = 1000
+)
+
+type Import struct {
+	api.ResourceBase
+	router *httprouter.Router
+}
+
+type importRow struct {
+	City        string `json:"city"`
+	Date        string `json:"date"`
+	Temperature *int   `json:"temperature"`
+}
+
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type importResponseModel struct {
+	Mode     string           `json:"mode"`
+	Rows     int              `json:"rows"`
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []importRowError `json:"errors"`
+}
+
+type importReader func(func(row int, entry importRow, err error)) error
+
+type importBatch struct {
+	weathers map[string]map[string]int
+	names    map[string]string
+	response importResponseModel
+}
+
+func (b *importBatch) fail(row int, err error) {
+	b.response.Failed++
+	if len(b.response.Errors) < maxImportRowErrors {
+		b.response.Errors = append(b.response.Errors, importRowError{
+			Row:   row,
+			Error: err.Error(),
+		})
+	}
+}
+
+func (b *importBatch) add(row int, entry importRow, err error) {
+	b.response.Rows++
+	if err != nil {
+		b.fail(row, err)
+		return
+	}
+
+	city := strings.TrimSpace(entry.City)
+	if err := validation.CheckCity(city); err != nil {
+		b.fail(row, err)
+		return
+	}
+	if entry.Temperature == nil {
+		b.fail(row, fmt.Errorf("Empty temperature"))
+		return
+	}
+	if err := validation.CheckTemperature(*entry.Temperature); err != nil {
+		b.fail(row, err)
+		return
+	}
+	if err := validation.CheckDate(entry.Date); err != nil {
+		b.fail(row, err)
+		return
+	}
+
+	// Rows naming the same city differently (e.g. São Paulo and sao paulo)
+	// are gathered under the name first seen.
+	key := weathermanager.CityKey(city)
+	if name, ok := b.names[key]; ok {
+		city = name
+	} else {
+		b.names[key] = city
+	}
+
+	temperatures, ok := b.weathers[city]
+	if !ok {
+		temperatures = map[string]int{}
+		b.weathers[city] = temperatures
+	}
+	if _, duplicated := temperatures[entry.Date]; duplicated {
+		b.fail(row, fmt.Errorf("Duplicated date %s for city %s", entry.Date, city))
+		return
+	}
+
+	temperatures[entry.Date] = *entry.Temperature
+	b.response.Imported++
+}
+
+func readCSVImport(body io.Reader) importReader {
+	return func(yield func(int, importRow, error)) error {
+		reader := csv.NewReader(body)
+		reader.FieldsPerRecord = -1
+
+		header, err := reader.Read()
+		if err != nil {
+			return fmt.Errorf("Invalid CSV header (%s)", err.Error())
+		}
+
+		columns := map[string]int{}
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		for _, name := range []string{"city", "date", "temperature"} {
+			if _, ok := columns[name]; !ok {
+				return fmt.Errorf("Missing CSV column %s", name)
+			}
+		}
+
+		field := func(record []string, name string) string {
+			if columns[name] >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[columns[name]])
+		}
+
+		for row := 1; ; row++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if _, ok := err.(*csv.ParseError); ok {
+				yield(row, importRow{}, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			entry := importRow{
+				City: field(record, "city"),
+				Date: field(record, "date"),
+			}
+			if value := field(record, "temperature"); value != "" {
+				temperature, err := strconv.Atoi(value)
+				if err != nil {
+					yield(row, entry, fmt.Errorf("Invalid temperature %s", value))
+					continue
+				}
+				entry.Temperature = &temperature
+			}
+			yield(row, entry, nil)
+		}
+	}
+}
+
+func readNDJSONImport(body io.Reader) importReader {
+	return func(yield func(int, importRow, error)) error {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		row := 0
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			row++
+			var entry importRow
+			err := json.Unmarshal([]byte(line), &entry)
+			if err != nil {
+				yield(row, entry, fmt.Errorf("Invalid JSON (%s)", err.Error()))
+				continue
+			}
+			yield(row, entry, nil)
+		}
+
+		return scanner.Err()
+	}
+}
+
+func (i *Import) ImportWeather(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&i.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = importModeAtomic
+	}
+	if mode != importModeAtomic && mode != importModeBestEffort {
+		i.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, "Invalid mode "+mode), w)
+		return
+	}
+
+	options := api.OptionsFromContext(r.Context())
+	body := http.MaxBytesReader(w, r.Body, options.ImportBytesLimit())
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var read importReader
+	switch mediaType {
+	case api.MediaTypeCSV:
+		read = readCSVImport(body)
+	case api.MediaTypeNDJSON:
+		read = readNDJSONImport(body)
+	default:
+		e := internalerror.New(internalerror.CodeUnsupportedMediaType, "Unsupported Content-Type, expected text/csv or application/x-ndjson")
+		i.SetResponse(http.StatusUnsupportedMediaType, e, w)
+		return
+	}
+
+	batch := &importBatch{
+		weathers: map[string]map[string]int{},
+		names:    map[string]string{},
+		response: importResponseModel{
+			Mode:   mode,
+			Errors: []importRowError{},
+		},
+	}
+	err := read(batch.add)
+	if err != nil {
+		code := internalerror.CodeImportFailed
+		// http.MaxBytesReader only reports the overflow through its message.
+		if strings.Contains(err.Error(), "request body too large") {
+			code = internalerror.CodeRequestBodyTooLarge
+		}
+		e := internalerror.Wrap(err, code, "Error reading import")
+		i.SetResponse(e.Status, e, w)
+		return
+	}
+
+	if mode == importModeAtomic && batch.response.Failed > 0 {
+		message := fmt.Sprintf("%d of %d rows are invalid, nothing was imported", batch.response.Failed, batch.response.Rows)
+		e := internalerror.New(internalerror.CodeValidationFailed, message)
+		for _, rowError := range batch.response.Errors {
+			e = e.WithFieldErrors(internalerror.FieldError{Row: rowError.Row, Detail: rowError.Error})
+		}
+		i.SetError(w, r, e)
+		return
+	}
+
+	err = weatherMgr.ImportWeather(batch.weathers)
+	if err != nil {
+		e := weatherManagerError(err, "Error saving weather")
+		i.SetResponse(e.Status, e, w)
+		return
+	}
+
+	i.SetResponse(http.StatusOK, batch.response, w)
+}
+
+func (i *Import) Register(router *httprouter.Router) {
+	i.router = router
+	i.router.POST("/import", i.ImportWeather)
+}
@@ -0,0 +1,132 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport_WithEmptyAuthHeader_ReturnUnauthorized(t *testing.T) {
+	testServer, _ := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("POST", "/import").Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/missing_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Error validating auth token (Empty Token)\",\"code\":\"missing_token\",\"error\":\"Error validating auth token (Empty Token)\"}", responseBody)
+}
+
+func TestImport_WithCSV_ReturnOK(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("POST", "/import").
+		WithHeader("Authorization", token).
+		WithHeader("Content-Type", "text/csv").
+		WithBody("date,city,temperature,station\n" +
+			"2020-04-17,Vancouver,17,north\n" +
+			"2020-04-18,vancouver,18,north\n" +
+			"2020-04-17,toronto,9,\n").
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"mode\":\"atomic\",\"rows\":3,\"imported\":3,\"failed\":0,\"errors\":[]}", responseBody)
+
+	vancouver, _ := weatherMgr.GetAllWeather("vancouver")
+	assert.Equal(t, map[string]int{"2020-04-17": 17, "2020-04-18": 18}, vancouver)
+	toronto, _ := weatherMgr.GetAllWeather("toronto")
+	assert.Equal(t, map[string]int{"2020-04-17": 9}, toronto)
+}
+
+func TestImport_WithInvalidRowsInAtomicMode_ImportNothing(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("POST", "/import").
+		WithHeader("Authorization", token).
+		WithHeader("Content-Type", "application/x-ndjson").
+		WithBody(`{"city": "vancouver", "date": "2020-04-17", "temperature": 17}
+{"city": "vancouver", "date": "2020-02-31", "temperature": 17}
+
+{"city": "", "date": "2020-04-18", "temperature": 17}
+{"city": "vancouver", "date": "2020-04-19"}
+not json
+{"city": "vancouver", "date": "2020-04-17", "temperature": 20}
+`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	var response struct {
+		Code   string                     `json:"code"`
+		Detail string                     `json:"detail"`
+		Errors []internalerror.FieldError `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Equal(t, internalerror.ContentType, testServer.GetResponseHeader("Content-Type"))
+	assert.Equal(t, "validation_failed", response.Code)
+	assert.Equal(t, "5 of 6 rows are invalid, nothing was imported", response.Detail)
+	assert.Len(t, response.Errors, 5)
+	assert.Equal(t, 2, response.Errors[0].Row)
+	assert.Contains(t, response.Errors[0].Detail, "Invalid date 2020-02-31")
+	assert.Equal(t, internalerror.FieldError{Row: 3, Detail: "Empty city"}, response.Errors[1])
+	assert.Equal(t, internalerror.FieldError{Row: 4, Detail: "Empty temperature"}, response.Errors[2])
+	assert.Equal(t, 5, response.Errors[3].Row)
+	assert.Equal(t, internalerror.FieldError{Row: 6, Detail: "Duplicated date 2020-04-17 for city vancouver"}, response.Errors[4])
+
+	_, ok := weatherMgr.GetAllWeather("vancouver")
+	assert.False(t, ok)
+}
+
+func TestImport_WithInvalidRowsInBestEffortMode_ImportValidRows(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("POST", "/import?mode=best_effort").
+		WithHeader("Authorization", token).
+		WithHeader("Content-Type", "text/csv").
+		WithBody("city,date,temperature\n" +
+			"vancouver,2020-04-17,17\n" +
+			"vancouver,2020-04-18,warm\n").
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"mode\":\"best_effort\",\"rows\":2,\"imported\":1,\"failed\":1,"+
+		"\"errors\":[{\"row\":2,\"error\":\"Invalid temperature warm\"}]}", responseBody)
+
+	vancouver, _ := weatherMgr.GetAllWeather("vancouver")
+	assert.Equal(t, map[string]int{"2020-04-17": 17}, vancouver)
+}
+
+func TestImport_WithMissingColumn_ReturnError(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("POST", "/import").
+		WithHeader("Authorization", token).
+		WithHeader("Content-Type", "text/csv").
+		WithBody("city,date\nvancouver,2020-04-17\n").
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/import_failed\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"Error reading import (Missing CSV column temperature)\",\"code\":\"import_failed\",\"error\":\"Error reading import (Missing CSV column temperature)\"}", responseBody)
+}
+
+func TestImport_WithUnsupportedContentType_ReturnUnsupportedMediaType(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("POST", "/import").
+		WithHeader("Authorization", token).
+		WithHeader("Content-Type", "application/json").
+		WithBody(`{"city": "vancouver"}`).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, statusCode)
+}
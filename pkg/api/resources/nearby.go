@@ -0,0 +1,162 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/julienschmidt/httprouter"
+)
+
+const defaultNearbyLimit = 10
+
+type latestObservationModel struct {
+	Date        string `json:"date"`
+	Temperature int    `json:"temperature"`
+}
+
+type nearbyCityResponseModel struct {
+	cityResponseModel
+	DistanceKm float64                 `json:"distance_km"`
+	Latest     *latestObservationModel `json:"latest,omitempty"`
+}
+
+type nearbyCitiesResponseModel struct {
+	Cities []nearbyCityResponseModel `json:"cities"`
+}
+
+// nearbyQuery is either a point (lat and lon, with an optional limit and
+// radius in km) or a bounding box (bbox=west,south,east,north).
+type nearbyQuery struct {
+	point    weathermanager.Coordinates
+	limit    int
+	radiusKm float64
+	box      *weathermanager.BoundingBox
+}
+
+func parseFloatParameter(query url.Values, name string) (float64, error) {
+	value, err := strconv.ParseFloat(query.Get(name), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s %s", name, query.Get(name))
+	}
+	return value, nil
+}
+
+func parseBoundingBox(bbox string) (weathermanager.BoundingBox, error) {
+	parts := strings.Split(bbox, ",")
+	if len(parts) != 4 {
+		return weathermanager.BoundingBox{}, fmt.Errorf("Invalid bbox %s, expected west,south,east,north", bbox)
+	}
+
+	corners := make([]float64, len(parts))
+	for i, part := range parts {
+		var err error
+		corners[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return weathermanager.BoundingBox{}, fmt.Errorf("Invalid bbox %s, expected west,south,east,north", bbox)
+		}
+	}
+	return weathermanager.BoundingBox{West: corners[0], South: corners[1], East: corners[2], North: corners[3]}, nil
+}
+
+func parseNearbyQuery(query url.Values) (nearbyQuery, error) {
+	if bbox := query.Get("bbox"); bbox != "" {
+		for _, name := range []string{"lat", "lon", "limit", "radius"} {
+			if query.Get(name) != "" {
+				return nearbyQuery{}, fmt.Errorf("Invalid query, bbox can not be combined with %s", name)
+			}
+		}
+		box, err := parseBoundingBox(bbox)
+		if err != nil {
+			return nearbyQuery{}, err
+		}
+		return nearbyQuery{box: &box}, nil
+	}
+
+	if query.Get("lat") == "" || query.Get("lon") == "" {
+		return nearbyQuery{}, fmt.Errorf("Invalid query, expected lat and lon or bbox")
+	}
+
+	q := nearbyQuery{limit: defaultNearbyLimit}
+	var err error
+	q.point.Latitude, err = parseFloatParameter(query, "lat")
+	if err != nil {
+		return q, err
+	}
+	q.point.Longitude, err = parseFloatParameter(query, "lon")
+	if err != nil {
+		return q, err
+	}
+	if query.Get("radius") != "" {
+		q.radiusKm, err = parseFloatParameter(query, "radius")
+		if err != nil || q.radiusKm <= 0 {
+			return q, fmt.Errorf("Invalid radius %s", query.Get("radius"))
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		q.limit, err = strconv.Atoi(limit)
+		if err != nil || q.limit <= 0 {
+			return q, fmt.Errorf("Invalid limit %s", limit)
+		}
+	}
+	return q, nil
+}
+
+func toNearbyCityResponseModel(nearby weathermanager.NearbyCity) nearbyCityResponseModel {
+	response := nearbyCityResponseModel{
+		cityResponseModel: toCityResponseModel(weathermanager.SummarizeCity(nearby.City, nil)),
+		DistanceKm:        nearby.DistanceKm,
+	}
+	response.Observations = nearby.Observations
+	if nearby.LatestDate != "" {
+		response.Latest = &latestObservationModel{
+			Date:        nearby.LatestDate,
+			Temperature: nearby.LatestTemperature,
+		}
+	}
+	return response
+}
+
+// NearbyCities returns the located cities nearest to a point, or inside a
+// bounding box, along with their latest observation.
+func (c *Cities) NearbyCities(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&c.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	q, err := parseNearbyQuery(r.URL.Query())
+	if err != nil {
+		c.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+		return
+	}
+
+	var found []weathermanager.NearbyCity
+	if q.box != nil {
+		found, err = weatherMgr.CitiesWithin(*q.box)
+	} else {
+		found, err = weatherMgr.NearestCities(q.point, q.limit, q.radiusKm)
+	}
+	if err != nil {
+		// Out of range coordinates are bad query parameters, not a body that
+		// failed validation.
+		if errors.Is(err, weathermanager.ErrValidation) {
+			c.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+			return
+		}
+		e := weatherManagerError(err, "Error searching cities")
+		c.SetResponse(e.Status, e, w)
+		return
+	}
+
+	response := nearbyCitiesResponseModel{Cities: []nearbyCityResponseModel{}}
+	for _, nearby := range found {
+		response.Cities = append(response.Cities, toNearbyCityResponseModel(nearby))
+	}
+	c.SetResponse(http.StatusOK, response, w)
+}
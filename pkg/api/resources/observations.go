@@ -0,0 +1,316 @@
+package resources
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/julienschmidt/httprouter"
+)
+
+type Observations struct {
+	api.ResourceBase
+	router *httprouter.Router
+}
+
+type observationRequestModel struct {
+	Temperature *int `json:"temperature"`
+}
+
+// revisionModel is a change of an observation, old being null when it was
+// created and new when it was deleted.
+type revisionModel struct {
+	Version int    `json:"version"`
+	Actor   string `json:"actor,omitempty"`
+	Time    string `json:"time"`
+	Old     *int   `json:"old"`
+	New     *int   `json:"new"`
+}
+
+type revisionListResponseModel struct {
+	City      string          `json:"city"`
+	Date      string          `json:"date"`
+	Revisions []revisionModel `json:"revisions"`
+}
+
+func toWeatherReport(entries []weatherEntry) map[string]int {
+	weatherReport := map[string]int{}
+	for _, o := range entries {
+		weatherReport[o.Date] = o.Temperature
+	}
+	return weatherReport
+}
+
+func toWeatherEntries(temperatures map[string]int) []weatherEntry {
+	weatherEntries := []weatherEntry{}
+	for k, v := range temperatures {
+		weatherEntries = append(weatherEntries, weatherEntry{
+			Date:        k,
+			Temperature: v,
+		})
+	}
+
+	sort.Slice(weatherEntries, func(i, j int) bool {
+		return weatherEntries[i].Date < weatherEntries[j].Date
+	})
+	return weatherEntries
+}
+
+func (o *Observations) ListObservations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&o.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city := ps.ByName("city")
+	if _, ok := resolveCity(&o.ResourceBase, w, weatherMgr, city); !ok {
+		return
+	}
+
+	dateRange := weathermanager.DateRange{}
+	asOf := time.Time{}
+	query := r.URL.Query()
+	if hasDateRange(query) {
+		var err error
+		dateRange, err = parseDateRange(query, time.Now())
+		if err != nil {
+			o.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+			return
+		}
+		asOf, err = parseAsOf(query)
+		if err != nil {
+			o.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+			return
+		}
+	}
+
+	writeWeatherReport(&o.ResourceBase, w, r, city, dateRange, func(dateRange weathermanager.DateRange, fn func(string, int) bool) error {
+		return weatherMgr.IterateRangeAsOf(city, dateRange, asOf, fn)
+	})
+}
+
+func (o *Observations) saveObservations(w http.ResponseWriter, r *http.Request, ps httprouter.Params, merge bool) {
+	weatherMgr, ok := authorizeWeatherRequest(&o.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city := ps.ByName("city")
+	if _, ok := resolveCity(&o.ResourceBase, w, weatherMgr, city); !ok {
+		return
+	}
+
+	temperatures, ok := parseObservations(&o.ResourceBase, w, r, city)
+	if !ok {
+		return
+	}
+
+	save := weatherMgr.SaveWeather
+	if merge {
+		save = weatherMgr.MergeWeather
+	}
+	err := save(city, temperatures)
+	if err != nil {
+		e := weatherManagerError(err, "Error saving weather")
+		o.SetResponse(e.Status, e, w)
+		return
+	}
+
+	saved, _ := weatherMgr.GetAllWeather(city)
+	o.SetResponse(http.StatusOK, weatherReportResponseModel{
+		City:    city,
+		Weather: toWeatherEntries(saved),
+	}, w)
+}
+
+func (o *Observations) PutObservations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	o.saveObservations(w, r, ps, false)
+}
+
+func (o *Observations) PatchObservations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	o.saveObservations(w, r, ps, true)
+}
+
+func (o *Observations) DeleteObservations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&o.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city := ps.ByName("city")
+	if _, ok := resolveCity(&o.ResourceBase, w, weatherMgr, city); !ok {
+		return
+	}
+
+	err := weatherMgr.SaveWeather(city, map[string]int{})
+	if err != nil {
+		e := weatherManagerError(err, "")
+		o.SetResponse(e.Status, e, w)
+		return
+	}
+
+	o.SetResponse(http.StatusOK, messageResponseModel{
+		"The observations were deleted succesfully!",
+	}, w)
+}
+
+func (o *Observations) GetObservation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&o.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	asOf, err := parseAsOf(r.URL.Query())
+	if err != nil {
+		o.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+		return
+	}
+
+	city, date := ps.ByName("city"), ps.ByName("date")
+	temperature, ok := weatherMgr.GetObservation(city, date)
+	if !asOf.IsZero() {
+		ok = false
+		err := weatherMgr.IterateRangeAsOf(city, weathermanager.SingleDay(date), asOf, func(_ string, t int) bool {
+			temperature, ok = t, true
+			return false
+		})
+		if errors.Is(err, weathermanager.ErrValidation) {
+			e := weatherManagerError(err, "")
+			o.SetResponse(e.Status, e, w)
+			return
+		}
+	}
+	if !ok {
+		o.SetResponse(http.StatusNotFound, internalerror.New(internalerror.CodeNotFound, "Observation not found"), w)
+		return
+	}
+
+	o.SetResponse(http.StatusOK, weatherEntry{
+		Date:        date,
+		Temperature: temperature,
+	}, w)
+}
+
+// ListRevisions lists every change of the observation of a city on a date,
+// oldest first.
+func (o *Observations) ListRevisions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&o.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&o.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	date := ps.ByName("date")
+	revisions, err := weatherMgr.ObservationHistory(city.ID, date)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		o.SetResponse(e.Status, e, w)
+		return
+	}
+
+	response := revisionListResponseModel{City: city.ID, Date: date, Revisions: []revisionModel{}}
+	for _, revision := range revisions {
+		response.Revisions = append(response.Revisions, revisionModel{
+			Version: revision.Version,
+			Actor:   revision.Actor,
+			Time:    revision.Time.Format(time.RFC3339Nano),
+			Old:     revision.Old,
+			New:     revision.New,
+		})
+	}
+	o.SetResponse(http.StatusOK, response, w)
+}
+
+func (o *Observations) saveObservation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, mustExist bool) {
+	weatherMgr, ok := authorizeWeatherRequest(&o.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, date := ps.ByName("city"), ps.ByName("date")
+	if _, ok := resolveCity(&o.ResourceBase, w, weatherMgr, city); !ok {
+		return
+	}
+
+	_, exists := weatherMgr.GetObservation(city, date)
+	if mustExist && !exists {
+		o.SetResponse(http.StatusNotFound, internalerror.New(internalerror.CodeNotFound, "Observation not found"), w)
+		return
+	}
+
+	var requestModel observationRequestModel
+	err := o.ParseFromBody(r, &requestModel)
+	if err != nil {
+		e := internalerror.Wrap(err, internalerror.CodeInvalidRequestBody, "Error parsing request body")
+		o.SetResponse(e.Status, e, w)
+		return
+	}
+	err = requestModel.validate(city, date)
+	if err != nil {
+		o.SetError(w, r, err)
+		return
+	}
+
+	err = weatherMgr.SaveObservation(city, date, *requestModel.Temperature)
+	if err != nil {
+		e := weatherManagerError(err, "Error saving weather")
+		o.SetResponse(e.Status, e, w)
+		return
+	}
+
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	o.SetResponse(status, weatherEntry{
+		Date:        date,
+		Temperature: *requestModel.Temperature,
+	}, w)
+}
+
+func (o *Observations) PutObservation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	o.saveObservation(w, r, ps, false)
+}
+
+func (o *Observations) PatchObservation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	o.saveObservation(w, r, ps, true)
+}
+
+func (o *Observations) DeleteObservation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&o.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	err := weatherMgr.DeleteObservation(ps.ByName("city"), ps.ByName("date"))
+	if err != nil {
+		e := weatherManagerError(err, "")
+		o.SetResponse(e.Status, e, w)
+		return
+	}
+
+	o.SetResponse(http.StatusOK, messageResponseModel{
+		"The observation was deleted succesfully!",
+	}, w)
+}
+
+func (o *Observations) Register(router *httprouter.Router) {
+	o.router = router
+	o.router.GET("/cities/:city/observations", o.ListObservations)
+	o.router.PUT("/cities/:city/observations", o.PutObservations)
+	o.router.PATCH("/cities/:city/observations", o.PatchObservations)
+	o.router.DELETE("/cities/:city/observations", o.DeleteObservations)
+	o.router.GET("/cities/:city/observations/:date", o.GetObservation)
+	o.router.PUT("/cities/:city/observations/:date", o.PutObservation)
+	o.router.PATCH("/cities/:city/observations/:date", o.PatchObservation)
+	o.router.DELETE("/cities/:city/observations/:date", o.DeleteObservation)
+	o.router.GET("/cities/:city/observations/:date/revisions", o.ListRevisions)
+}
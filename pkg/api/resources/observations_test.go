@@ -0,0 +1,490 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObservationsList_ReturnSortedObservations(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-05-18": 16, "2020-04-18": 15, "2020-04-17": 17})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":["+
+		"{\"date\":\"2020-04-17\",\"temperature\":17},"+
+		"{\"date\":\"2020-04-18\",\"temperature\":15},"+
+		"{\"date\":\"2020-05-18\",\"temperature\":16}]}", responseBody)
+}
+
+func TestObservationsList_WithDateRange_ReturnFilteredObservations(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-05-18": 16, "2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations?initial_date=2020-04-01&end_date=2020-04-30").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-18\",\"temperature\":15}]}", responseBody)
+}
+
+func TestObservationsList_WithUnknownCity_ReturnNotFound(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("GET", "/cities/vancouver/observations").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestObservationsPut_ReplaceObservations(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/cities/vancouver/observations").
+		WithHeader("Authorization", token).
+		WithBody(`{"weather": [{"date": "2020-04-19", "temperature": 16}]}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-19\",\"temperature\":16}]}", responseBody)
+}
+
+func TestObservationPut_ReturnCreated(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/cities/vancouver/observations/2020-04-18").
+		WithHeader("Authorization", token).
+		WithBody(`{"temperature": 15}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusCreated, statusCode)
+	assert.Equal(t, "{\"date\":\"2020-04-18\",\"temperature\":15}", responseBody)
+
+	temperature, ok := weatherMgr.GetObservation("vancouver", "2020-04-18")
+	assert.True(t, ok)
+	assert.Equal(t, 15, temperature)
+}
+
+func TestObservationPut_WithInvalidDate_ReturnError(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/cities/vancouver/observations/2020-02-31").
+		WithHeader("Authorization", token).
+		WithBody(`{"temperature": 15}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, responseBody, "Invalid date")
+}
+
+func TestObservationPatch_WithUnknownDate_ReturnNotFound(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PATCH", "/cities/vancouver/observations/2020-04-18").
+		WithHeader("Authorization", token).
+		WithBody(`{"temperature": 15}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusNotFound, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/not_found\",\"title\":\"Not Found\",\"status\":404,\"detail\":\"Observation not found\",\"code\":\"not_found\",\"error\":\"Observation not found\"}", responseBody)
+}
+
+func TestObservationGetAndDelete_ReturnOK(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations/2020-04-18").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"date\":\"2020-04-18\",\"temperature\":15}", responseBody)
+
+	testServer.Test("DELETE", "/cities/vancouver/observations/2020-04-18").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	testServer.Test("GET", "/cities/vancouver/observations/2020-04-18").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestObservationsList_WithLimit_ReturnPagesUntilExhausted(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 17, "2020-04-18": 15, "2020-04-19": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations?limit=2").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	var response weatherReportResponseModel
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, []weatherEntry{{"2020-04-17", 17}, {"2020-04-18", 15}}, response.Weather)
+	assert.NotEmpty(t, response.NextCursor)
+
+	testServer.Test("GET", "/cities/vancouver/observations?limit=2&cursor="+response.NextCursor).
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-19\",\"temperature\":16}]}", responseBody)
+}
+
+// rangeRecordingManager records the ranges read and the observations
+// yielded, to check how much of a report is read for a page.
+type rangeRecordingManager struct {
+	weathermanager.WeatherManager
+	ranges *[]weathermanager.DateRange
+	read   *int
+}
+
+func (m rangeRecordingManager) IterateRangeAsOf(city string, dateRange weathermanager.DateRange, asOf time.Time, fn func(string, int) bool) error {
+	*m.ranges = append(*m.ranges, dateRange)
+	return m.WeatherManager.IterateRangeAsOf(city, dateRange, asOf, func(date string, temperature int) bool {
+		*m.read++
+		return fn(date, temperature)
+	})
+}
+
+func (m rangeRecordingManager) WithActor(string) weathermanager.WeatherManager {
+	return m
+}
+
+func TestObservationsList_WithCursor_ReadFromCursor(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-16": 14, "2020-04-17": 17, "2020-04-18": 15, "2020-04-19": 16, "2020-04-20": 18})
+	ranges := []weathermanager.DateRange{}
+	read := 0
+	testServer, token := newAuthorizedTestServer(t, rangeRecordingManager{weatherMgr, &ranges, &read})
+
+	testServer.Test("GET", "/cities/vancouver/observations?limit=2&cursor="+encodeObservationsCursor("2020-04-17")).
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	var response weatherReportResponseModel
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, []weatherEntry{{"2020-04-18", 15}, {"2020-04-19", 16}}, response.Weather)
+	assert.Equal(t, []weathermanager.DateRange{{From: "2020-04-17"}}, ranges)
+	assert.Equal(t, 3, read, "a page reads one observation past its limit")
+}
+
+func TestObservationsList_WithInvalidCursor_ReturnError(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 17})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations?limit=2&cursor=bm90LWEtZGF0ZQ").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/invalid_parameter\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"Invalid cursor\",\"code\":\"invalid_parameter\",\"error\":\"Invalid cursor\"}", responseBody)
+}
+
+func TestObservationsList_WithStream_ReturnNDJSON(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 17, "2020-04-18": 15, "2020-04-19": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations?stream=true").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "application/x-ndjson", testServer.GetResponseHeader("Content-Type"))
+	assert.Equal(t, "{\"date\":\"2020-04-17\",\"temperature\":17}\n"+
+		"{\"date\":\"2020-04-18\",\"temperature\":15}\n"+
+		"{\"date\":\"2020-04-19\",\"temperature\":16}\n", responseBody)
+	assert.Empty(t, testServer.GetResponseTrailer("Next-Cursor"))
+}
+
+func TestObservationsList_WithStreamAndLimit_ReturnNextCursorTrailer(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 17, "2020-04-18": 15, "2020-04-19": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations?stream=true&limit=1").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"date\":\"2020-04-17\",\"temperature\":17}\n", responseBody)
+	assert.Equal(t, encodeObservationsCursor("2020-04-17"), testServer.GetResponseTrailer("Next-Cursor"))
+}
+
+// failingRangeManager fails reading observations after yielding the first
+// ones.
+type failingRangeManager struct {
+	weathermanager.WeatherManager
+}
+
+func (m failingRangeManager) IterateRangeAsOf(city string, dateRange weathermanager.DateRange, asOf time.Time, fn func(string, int) bool) error {
+	if !fn("2020-04-17", 17) {
+		return nil
+	}
+	return weathermanager.StorageError(errors.New("disk failure"), "Error reading %s", city)
+}
+
+func (m failingRangeManager) WithActor(string) weathermanager.WeatherManager {
+	return m
+}
+
+func TestObservationsList_WithStreamFailing_ReturnStreamErrorTrailer(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 17})
+	testServer, token := newAuthorizedTestServer(t, failingRangeManager{weatherMgr})
+
+	testServer.Test("GET", "/cities/vancouver/observations?stream=true").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"date\":\"2020-04-17\",\"temperature\":17}\n", responseBody)
+	assert.Contains(t, testServer.GetResponseTrailer("Stream-Error"), "Error reading vancouver")
+}
+
+// failingResponseWriter fails every write, as when the client went away.
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingResponseWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestStreamWeatherReport_WithWriteFailing_StopIterating(t *testing.T) {
+	w := failingResponseWriter{httptest.NewRecorder()}
+	read := 0
+	iterate := func(_ weathermanager.DateRange, fn func(string, int) bool) error {
+		for day := 1; day <= 1000; day++ {
+			read++
+			if !fn(fmt.Sprintf("2020-01-%04d", day), day) {
+				break
+			}
+		}
+		return nil
+	}
+
+	streamWeatherReport(&api.ResourceBase{}, w, "vancouver", weathermanager.DateRange{}, observationsPage{}, newNDJSONReportWriter(w), iterate)
+
+	assert.Equal(t, 1, read)
+}
+
+func TestObservationsList_WithCSVAccept_ReturnCSVAttachment(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("São Paulo", map[string]int{"2020-04-17": 27, "2020-04-18": 25})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/s%C3%A3o%20paulo/observations").
+		WithHeader("Authorization", token).
+		WithHeader("Accept", "text/csv").
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", testServer.GetResponseHeader("Content-Type"))
+	assert.Equal(t, "attachment; filename=\"s_o_paulo-weather.csv\"", testServer.GetResponseHeader("Content-Disposition"))
+	assert.Equal(t, "city,date,temperature\n"+
+		"são paulo,2020-04-17,27\n"+
+		"são paulo,2020-04-18,25\n", responseBody)
+}
+
+func TestObservationsList_WithFormatParam_OverrideAccept(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 17})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations?format=ndjson").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "application/x-ndjson", testServer.GetResponseHeader("Content-Type"))
+	assert.Equal(t, "{\"date\":\"2020-04-17\",\"temperature\":17}\n", responseBody)
+}
+
+func TestObservationsList_WithUnsupportedAccept_ReturnNotAcceptable(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 17})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations").
+		WithHeader("Authorization", token).
+		WithHeader("Accept", "application/xml").
+		Now()
+	statusCode, _ := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusNotAcceptable, statusCode)
+}
+
+func TestObservationPut_WithoutTemperature_ReturnError(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/cities/vancouver/observations/2999-01-01").
+		WithHeader("Authorization", token).
+		WithBody(`{}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, responseBody, "{\"parameter\":\"date\",\"detail\":\"Date 2999-01-01 is in the future\"}")
+	assert.Contains(t, responseBody, "{\"pointer\":\"/temperature\",\"detail\":\"Empty temperature\"}")
+}
+
+func TestObservationRevisions_ReturnEveryChange(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	for _, body := range []string{`{"temperature": 15}`, `{"temperature": 15}`, `{"temperature": 17}`} {
+		testServer.Test("PUT", "/cities/vancouver/observations/2020-04-18").
+			WithHeader("Authorization", token).
+			WithBody(body).
+			Now()
+		testServer.GetResponse()
+	}
+	testServer.Test("DELETE", "/cities/vancouver/observations/2020-04-18").
+		WithHeader("Authorization", token).
+		Now()
+	testServer.GetResponse()
+
+	testServer.Test("GET", "/cities/vancouver/observations/2020-04-18/revisions").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	var response revisionListResponseModel
+	assert.NoError(t, json.Unmarshal([]byte(responseBody), &response))
+	assert.Equal(t, http.StatusOK, statusCode)
+	if !assert.Len(t, response.Revisions, 3) {
+		return
+	}
+
+	fifteen, seventeen := 15, 17
+	for i, expected := range []struct{ old, new *int }{{nil, &fifteen}, {&fifteen, &seventeen}, {&seventeen, nil}} {
+		assert.Equal(t, i+1, response.Revisions[i].Version)
+		assert.Equal(t, "kirang", response.Revisions[i].Actor)
+		assert.Equal(t, expected.old, response.Revisions[i].Old)
+		assert.Equal(t, expected.new, response.Revisions[i].New)
+	}
+}
+
+func TestObservationRevisions_WithUnknownDate_ReturnNotFound(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations/2020-04-19/revisions").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestObservations_WithAsOf_ReturnPastValues(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+	first, _ := weatherMgr.ObservationHistory("vancouver", "2020-04-18")
+	second, _ := weatherMgr.ObservationHistory("vancouver", "2020-04-19")
+	saved := first[0].Time
+	if second[0].Time.After(saved) {
+		saved = second[0].Time
+	}
+	asOf := saved.Format(time.RFC3339Nano)
+	time.Sleep(time.Millisecond)
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 20, "2020-04-20": 21})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations?as_of="+url.QueryEscape(asOf)).
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-18\",\"temperature\":15},{\"date\":\"2020-04-19\",\"temperature\":16}]}", responseBody)
+
+	testServer.Test("GET", "/weather/vancouver?as_of="+url.QueryEscape(asOf)+"&date=2020-04-18").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, responseBody, "{\"date\":\"2020-04-18\",\"temperature\":15}")
+
+	testServer.Test("GET", "/cities/vancouver/observations/2020-04-20?as_of="+url.QueryEscape(asOf)).
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusNotFound, statusCode)
+
+	testServer.Test("GET", "/cities/vancouver/observations/2020-04-18").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"date\":\"2020-04-18\",\"temperature\":20}", responseBody)
+}
+
+func TestObservations_WithInvalidAsOf_ReturnError(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/observations?as_of=yesterday").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Contains(t, responseBody, "Invalid as_of yesterday, expected an RFC 3339 timestamp")
+}
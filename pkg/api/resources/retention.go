@@ -0,0 +1,213 @@
+package resources
+
+import (
+	"net/http"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/validation"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/julienschmidt/httprouter"
+)
+
+type Retention struct {
+	api.ResourceBase
+	router *httprouter.Router
+}
+
+type retentionRequestModel struct {
+	RawDays       *int `json:"raw_days"`
+	AggregateDays *int `json:"aggregate_days"`
+}
+
+type retentionResponseModel struct {
+	City          string `json:"city,omitempty"`
+	RawDays       int    `json:"raw_days"`
+	AggregateDays int    `json:"aggregate_days"`
+	Default       bool   `json:"default"`
+}
+
+type aggregateModel struct {
+	Month        string  `json:"month"`
+	Observations int     `json:"observations"`
+	Min          int     `json:"min"`
+	Max          int     `json:"max"`
+	Mean         float64 `json:"mean"`
+}
+
+type aggregateListResponseModel struct {
+	City       string           `json:"city"`
+	Aggregates []aggregateModel `json:"aggregates"`
+}
+
+func (m retentionRequestModel) validate() error {
+	v := validation.New()
+	if v.Required(validation.Pointer("raw_days"), m.RawDays != nil, "raw_days") && *m.RawDays < 0 {
+		v.Add(validation.Pointer("raw_days"), "Invalid raw_days %d", *m.RawDays)
+	}
+	if v.Required(validation.Pointer("aggregate_days"), m.AggregateDays != nil, "aggregate_days") && *m.AggregateDays < 0 {
+		v.Add(validation.Pointer("aggregate_days"), "Invalid aggregate_days %d", *m.AggregateDays)
+	}
+	return v.Err()
+}
+
+func (m retentionRequestModel) policy() weathermanager.RetentionPolicy {
+	return weathermanager.RetentionPolicy{RawDays: *m.RawDays, AggregateDays: *m.AggregateDays}
+}
+
+func (rt *Retention) GetDefaultRetention(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&rt.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	policy := weatherMgr.DefaultRetention()
+	rt.SetResponse(http.StatusOK, retentionResponseModel{
+		RawDays:       policy.RawDays,
+		AggregateDays: policy.AggregateDays,
+		Default:       true,
+	}, w)
+}
+
+func (rt *Retention) PutDefaultRetention(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&rt.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	var requestModel retentionRequestModel
+	ok = parseBody(&rt.ResourceBase, w, r, &requestModel, func() error {
+		return requestModel.validate()
+	})
+	if !ok {
+		return
+	}
+
+	err := weatherMgr.SetDefaultRetention(requestModel.policy())
+	if err != nil {
+		e := weatherManagerError(err, "")
+		rt.SetResponse(e.Status, e, w)
+		return
+	}
+
+	rt.GetDefaultRetention(w, r, nil)
+}
+
+func (rt *Retention) GetCityRetention(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&rt.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&rt.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	policy, overridden, err := weatherMgr.Retention(city.ID)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		rt.SetResponse(e.Status, e, w)
+		return
+	}
+
+	rt.SetResponse(http.StatusOK, retentionResponseModel{
+		City:          city.ID,
+		RawDays:       policy.RawDays,
+		AggregateDays: policy.AggregateDays,
+		Default:       !overridden,
+	}, w)
+}
+
+func (rt *Retention) PutCityRetention(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&rt.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&rt.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	var requestModel retentionRequestModel
+	ok = parseBody(&rt.ResourceBase, w, r, &requestModel, func() error {
+		return requestModel.validate()
+	})
+	if !ok {
+		return
+	}
+
+	policy := requestModel.policy()
+	err := weatherMgr.SetRetention(city.ID, &policy)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		rt.SetResponse(e.Status, e, w)
+		return
+	}
+
+	rt.GetCityRetention(w, r, ps)
+}
+
+// DeleteCityRetention removes the policy of a city, which then follows the
+// default one.
+func (rt *Retention) DeleteCityRetention(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&rt.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&rt.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	err := weatherMgr.SetRetention(city.ID, nil)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		rt.SetResponse(e.Status, e, w)
+		return
+	}
+
+	rt.GetCityRetention(w, r, ps)
+}
+
+func (rt *Retention) ListAggregates(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&rt.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&rt.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	aggregates, err := weatherMgr.Aggregates(city.ID)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		rt.SetResponse(e.Status, e, w)
+		return
+	}
+
+	response := aggregateListResponseModel{City: city.ID, Aggregates: []aggregateModel{}}
+	for _, a := range aggregates {
+		response.Aggregates = append(response.Aggregates, aggregateModel{
+			Month:        a.Month,
+			Observations: a.Count,
+			Min:          a.Min,
+			Max:          a.Max,
+			Mean:         a.Mean(),
+		})
+	}
+	rt.SetResponse(http.StatusOK, response, w)
+}
+
+func (rt *Retention) Register(router *httprouter.Router) {
+	rt.router = router
+	rt.router.GET("/retention", rt.GetDefaultRetention)
+	rt.router.PUT("/retention", rt.PutDefaultRetention)
+	rt.router.GET("/cities/:city/retention", rt.GetCityRetention)
+	rt.router.PUT("/cities/:city/retention", rt.PutCityRetention)
+	rt.router.DELETE("/cities/:city/retention", rt.DeleteCityRetention)
+	rt.router.GET("/cities/:city/aggregates", rt.ListAggregates)
+}
@@ -0,0 +1,138 @@
+package resources
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention_RollUpAndDropExpiredData(t *testing.T) {
+	recent := time.Now().UTC().AddDate(0, 0, -10).Format("2006-01-02")
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{
+		"2000-01-15": 1,
+		"2020-04-17": 10,
+		"2020-04-18": 15,
+		"2020-04-19": 21,
+		recent:       16,
+	})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/cities/vancouver/retention").
+		WithHeader("Authorization", token).
+		WithBody(`{"raw_days": 90, "aggregate_days": 3650}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"raw_days\":90,\"aggregate_days\":3650,\"default\":false}", responseBody)
+
+	report := weatherMgr.ApplyRetention()
+	assert.Equal(t, weathermanager.RetentionReport{RolledUp: 4, DroppedAggregates: 1}, report)
+
+	testServer.Test("GET", "/cities/vancouver/aggregates").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"aggregates\":[{\"month\":\"2020-04\",\"observations\":3,\"min\":10,\"max\":21,\"mean\":15.3}]}", responseBody)
+
+	temperatures, _ := weatherMgr.GetAllWeather("vancouver")
+	assert.Equal(t, map[string]int{recent: 16}, temperatures)
+
+	_, err := weatherMgr.ObservationHistory("vancouver", "2020-04-18")
+	assert.Error(t, err)
+}
+
+func TestRetention_WithoutCityPolicy_FollowDefault(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/retention").
+		WithHeader("Authorization", token).
+		WithBody(`{"raw_days": 30, "aggregate_days": 0}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"raw_days\":30,\"aggregate_days\":0,\"default\":true}", responseBody)
+
+	testServer.Test("GET", "/cities/vancouver/retention").
+		WithHeader("Authorization", token).
+		Now()
+	_, responseBody = testServer.GetResponse()
+	assert.Equal(t, "{\"city\":\"vancouver\",\"raw_days\":30,\"aggregate_days\":0,\"default\":true}", responseBody)
+
+	weatherMgr.ApplyRetention()
+	aggregates, _ := weatherMgr.Aggregates("vancouver")
+	assert.Len(t, aggregates, 1)
+}
+
+func TestRetention_WithInvalidPolicy_ReturnValidationError(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/cities/vancouver/retention").
+		WithHeader("Authorization", token).
+		WithBody(`{"raw_days": -1}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, responseBody, "{\"pointer\":\"/raw_days\",\"detail\":\"Invalid raw_days -1\"}")
+	assert.Contains(t, responseBody, "{\"pointer\":\"/aggregate_days\",\"detail\":\"Empty aggregate_days\"}")
+
+	testServer.Test("PUT", "/retention").
+		WithHeader("Authorization", token).
+		WithBody(`{"raw_days": 90, "aggregate_days": 30}`).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, responseBody, "Aggregate retention (30 days) can not be shorter than raw retention (90 days)")
+}
+
+func TestRetention_WriteToRolledUpMonth_ReturnValidationError(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2001-01-05": 10})
+	weatherMgr.SetDefaultRetention(weathermanager.RetentionPolicy{RawDays: 30})
+	weatherMgr.ApplyRetention()
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("PUT", "/cities/vancouver/observations/2001-01-05").
+		WithHeader("Authorization", token).
+		WithBody(`{"temperature": 10}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, responseBody, "Observation 2001-01-05 is in 2001-01, already rolled up by retention")
+
+	testServer.Test("POST", "/weather/").
+		WithHeader("Authorization", token).
+		WithBody(`{"city": "vancouver", "weather": [{"date": "2001-01-20", "temperature": 12}]}`).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+
+	weatherMgr.ApplyRetention()
+	aggregates, _ := weatherMgr.Aggregates("vancouver")
+	assert.Equal(t, []weathermanager.Aggregate{{Month: "2001-01", Count: 1, Sum: 10, Min: 10, Max: 10}}, aggregates)
+}
+
+func TestRetention_RollUpWholeMonthsOnly(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	cutoff := time.Date(today.Year(), today.Month()-1, 15, 0, 0, 0, 0, time.UTC)
+	rawDays := int(today.Sub(cutoff).Hours() / 24)
+	old := cutoff.AddDate(0, 0, -1).Format("2006-01-02")
+	previousMonth := cutoff.AddDate(0, -1, 0).Format("2006-01-02")
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{previousMonth: 8, old: 12})
+	weatherMgr.SetRetention("vancouver", &weathermanager.RetentionPolicy{RawDays: rawDays})
+
+	report := weatherMgr.ApplyRetention()
+
+	temperatures, _ := weatherMgr.GetAllWeather("vancouver")
+	assert.Equal(t, 1, report.RolledUp)
+	assert.Equal(t, map[string]int{old: 12}, temperatures, "the month of the cutoff is kept until it is over")
+}
@@ -0,0 +1,151 @@
+package resources
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/julienschmidt/httprouter"
+)
+
+const snapshotContentType = "application/gzip"
+
+// snapshotExpansionLimit bounds how many times larger than the request body
+// limit a snapshot may grow once decompressed. Observations compress about
+// tenfold, so only gzip bombs come near it.
+const snapshotExpansionLimit = 20
+
+type Snapshot struct {
+	api.ResourceBase
+	router *httprouter.Router
+}
+
+type cityDiffModel struct {
+	City    string `json:"city"`
+	Status  string `json:"status"`
+	Added   int    `json:"added"`
+	Changed int    `json:"changed"`
+	Removed int    `json:"removed"`
+}
+
+type restoreResponseModel struct {
+	Mode      string          `json:"mode"`
+	DryRun    bool            `json:"dry_run"`
+	CreatedAt string          `json:"created_at"`
+	Added     int             `json:"added"`
+	Changed   int             `json:"changed"`
+	Removed   int             `json:"removed"`
+	Cities    []cityDiffModel `json:"cities"`
+}
+
+// ExportSnapshot responds with a snapshot file of every city. The file is
+// written to memory first, so a failure is still reported as a problem.
+func (s *Snapshot) ExportSnapshot(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&s.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	snapshot, err := weatherMgr.Snapshot()
+	if err != nil {
+		s.SetError(w, r, err)
+		return
+	}
+
+	var b bytes.Buffer
+	err = weathermanager.WriteSnapshot(&b, snapshot)
+	if err != nil {
+		s.SetError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("weather-snapshot-%s.json.gz", snapshot.CreatedAt.Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", snapshotContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
+
+// RestoreSnapshot restores the snapshot file sent as the body, or with
+// dry_run=true only reports what restoring it would change.
+func (s *Snapshot) RestoreSnapshot(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&s.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	mode := weathermanager.RestoreMode(query.Get("mode"))
+	if mode == "" {
+		mode = weathermanager.RestoreMerge
+	}
+	if mode != weathermanager.RestoreReplace && mode != weathermanager.RestoreMerge {
+		s.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, "Invalid mode "+string(mode)), w)
+		return
+	}
+
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			s.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, "Invalid dry_run "+value), w)
+			return
+		}
+	}
+
+	options := api.OptionsFromContext(r.Context())
+	body := http.MaxBytesReader(w, r.Body, options.ImportBytesLimit())
+	snapshot, err := weathermanager.ReadSnapshot(body, options.ImportBytesLimit()*snapshotExpansionLimit)
+	if err != nil {
+		// http.MaxBytesReader only reports the overflow through its message.
+		if strings.Contains(err.Error(), "request body too large") || errors.Is(err, weathermanager.ErrSnapshotTooLarge) {
+			e := internalerror.Wrap(err, internalerror.CodeRequestBodyTooLarge, "Error reading snapshot")
+			s.SetResponse(e.Status, e, w)
+			return
+		}
+		e := weatherManagerError(err, "Error reading snapshot")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	diff, err := weatherMgr.Restore(snapshot, mode, dryRun)
+	if err != nil {
+		e := weatherManagerError(err, "Error restoring snapshot")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	response := restoreResponseModel{
+		Mode:      string(diff.Mode),
+		DryRun:    diff.DryRun,
+		CreatedAt: snapshot.CreatedAt.Format(time.RFC3339),
+		Added:     diff.Added,
+		Changed:   diff.Changed,
+		Removed:   diff.Removed,
+		Cities:    []cityDiffModel{},
+	}
+	for _, city := range diff.Cities {
+		response.Cities = append(response.Cities, cityDiffModel{
+			City:    city.City,
+			Status:  city.Status,
+			Added:   city.Added,
+			Changed: city.Changed,
+			Removed: city.Removed,
+		})
+	}
+	s.SetResponse(http.StatusOK, response, w)
+}
+
+func (s *Snapshot) Register(router *httprouter.Router) {
+	s.router = router
+	s.router.GET("/admin/snapshot", s.ExportSnapshot)
+	s.router.POST("/admin/snapshot", s.RestoreSnapshot)
+}
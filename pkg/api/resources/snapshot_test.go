@@ -0,0 +1,188 @@
+package resources
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exportTestSnapshot(t *testing.T, weatherMgr weathermanager.WeatherManager) string {
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/admin/snapshot").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "application/gzip", testServer.GetResponseHeader("Content-Type"))
+	assert.Contains(t, testServer.GetResponseHeader("Content-Disposition"), "attachment; filename=\"weather-snapshot-")
+	return responseBody
+}
+
+func TestSnapshot_ExportAndRestoreIntoEmptyManager(t *testing.T) {
+	source := weathermanager.New()
+	source.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+	source.RegisterCity(weathermanager.City{Name: "São Paulo", Country: "BR", Aliases: []string{"sampa"}})
+	source.SaveWeather("sampa", map[string]int{"2020-04-18": 25})
+	source.RegisterStation(weathermanager.Station{ID: "yvr-1", City: "vancouver"})
+	source.SaveStationObservations("yvr-1", map[string]int{"2020-04-18": 14})
+	snapshot := exportTestSnapshot(t, source)
+
+	target := weathermanager.New()
+	testServer, token := newAuthorizedTestServer(t, target)
+	testServer.Test("POST", "/admin/snapshot?mode=replace").
+		WithHeader("Authorization", token).
+		WithBody(snapshot).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, responseBody, "\"mode\":\"replace\",\"dry_run\":false")
+	assert.Contains(t, responseBody, "\"added\":3,\"changed\":0,\"removed\":0")
+
+	temperatures, _ := target.GetAllWeather("sampa")
+	assert.Equal(t, map[string]int{"2020-04-18": 25}, temperatures)
+	city, _ := target.ResolveCity("sampa")
+	assert.Equal(t, "BR", city.Country)
+	observations, _ := target.StationObservations("vancouver", weathermanager.DateRange{})
+	assert.Equal(t, []weathermanager.StationObservation{{Station: "yvr-1", Date: "2020-04-18", Temperature: 14}}, observations)
+}
+
+func TestSnapshot_WithDryRun_ReturnDiffWithoutChanges(t *testing.T) {
+	source := weathermanager.New()
+	source.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+	snapshot := exportTestSnapshot(t, source)
+
+	target := weathermanager.New()
+	target.SaveWeather("vancouver", map[string]int{"2020-04-18": 12, "2020-04-20": 18})
+	target.SaveWeather("toronto", map[string]int{"2020-04-18": 9})
+	testServer, token := newAuthorizedTestServer(t, target)
+
+	testServer.Test("POST", "/admin/snapshot?mode=replace&dry_run=true").
+		WithHeader("Authorization", token).
+		WithBody(snapshot).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, responseBody, "\"mode\":\"replace\",\"dry_run\":true")
+	assert.Contains(t, responseBody, "\"added\":1,\"changed\":1,\"removed\":2,\"cities\":["+
+		"{\"city\":\"toronto\",\"status\":\"removed\",\"added\":0,\"changed\":0,\"removed\":1},"+
+		"{\"city\":\"vancouver\",\"status\":\"changed\",\"added\":1,\"changed\":1,\"removed\":1}]")
+
+	temperatures, _ := target.GetAllWeather("vancouver")
+	assert.Equal(t, map[string]int{"2020-04-18": 12, "2020-04-20": 18}, temperatures)
+	_, ok := target.GetAllWeather("toronto")
+	assert.True(t, ok)
+}
+
+func TestSnapshot_ReplaceAndMerge(t *testing.T) {
+	source := weathermanager.New()
+	source.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	snapshot := exportTestSnapshot(t, source)
+
+	merged := weathermanager.New()
+	merged.SaveWeather("vancouver", map[string]int{"2020-04-20": 18})
+	merged.SaveWeather("toronto", map[string]int{"2020-04-18": 9})
+	testServer, token := newAuthorizedTestServer(t, merged)
+	testServer.Test("POST", "/admin/snapshot?mode=merge").
+		WithHeader("Authorization", token).
+		WithBody(snapshot).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	temperatures, _ := merged.GetAllWeather("vancouver")
+	assert.Equal(t, map[string]int{"2020-04-18": 15, "2020-04-20": 18}, temperatures)
+	_, ok := merged.GetAllWeather("toronto")
+	assert.True(t, ok)
+
+	replaced := weathermanager.New()
+	replaced.SaveWeather("vancouver", map[string]int{"2020-04-20": 18})
+	replaced.SaveWeather("toronto", map[string]int{"2020-04-18": 9})
+	testServer, token = newAuthorizedTestServer(t, replaced)
+	testServer.Test("POST", "/admin/snapshot?mode=replace").
+		WithHeader("Authorization", token).
+		WithBody(snapshot).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+	temperatures, _ = replaced.GetAllWeather("vancouver")
+	assert.Equal(t, map[string]int{"2020-04-18": 15}, temperatures)
+	_, ok = replaced.GetAllWeather("toronto")
+	assert.False(t, ok)
+
+	// Cities removed by a replace can still be undeleted.
+	_, err := replaced.UndeleteWeather("toronto")
+	assert.NoError(t, err)
+}
+
+func TestSnapshot_WithCorruptedSnapshot_ReturnValidationFailed(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+
+	snapshot, err := weatherMgr.Snapshot()
+	require.NoError(t, err)
+	var b bytes.Buffer
+	err = weathermanager.WriteSnapshot(&b, snapshot)
+	assert.NoError(t, err)
+	reader, _ := gzip.NewReader(&b)
+	var content bytes.Buffer
+	content.ReadFrom(reader)
+
+	var tampered bytes.Buffer
+	writer := gzip.NewWriter(&tampered)
+	writer.Write([]byte(strings.Replace(content.String(), "\"2020-04-18\":15", "\"2020-04-18\":35", 1)))
+	writer.Close()
+
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+	testServer.Test("POST", "/admin/snapshot").
+		WithHeader("Authorization", token).
+		WithBody(tampered.String()).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, responseBody, "Snapshot checksum mismatch")
+
+	testServer.Test("POST", "/admin/snapshot").
+		WithHeader("Authorization", token).
+		WithBody(`{"cities": []}`).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+
+	temperatures, _ := weatherMgr.GetAllWeather("vancouver")
+	assert.Equal(t, map[string]int{"2020-04-18": 15}, temperatures)
+}
+
+func TestSnapshot_WithGzipBomb_ReturnRequestEntityTooLarge(t *testing.T) {
+	var bomb bytes.Buffer
+	writer := gzip.NewWriter(&bomb)
+	writer.Write([]byte(strings.Repeat(" ", 1024*snapshotExpansionLimit+1) + "{}"))
+	writer.Close()
+	assert.True(t, bomb.Len() < 1024)
+
+	testServer, token := newAuthorizedTestServerWithOptions(t, weathermanager.New(), &api.ServerOptions{MaxImportBytes: 1024})
+	testServer.Test("POST", "/admin/snapshot").
+		WithHeader("Authorization", token).
+		WithBody(bomb.String()).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+	assert.Contains(t, responseBody, "\"code\":\"request_body_too_large\"")
+}
+
+func TestSnapshot_WithInvalidMode_ReturnBadRequest(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("POST", "/admin/snapshot?mode=overwrite").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Contains(t, responseBody, "Invalid mode overwrite")
+}
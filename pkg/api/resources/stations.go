@@ -0,0 +1,284 @@
+package resources
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/julienschmidt/httprouter"
+)
+
+const maxStationLength = 100
+
+type Stations struct {
+	api.ResourceBase
+	router *httprouter.Router
+}
+
+type stationRequestModel struct {
+	Name      string   `json:"name"`
+	City      string   `json:"city"`
+	Owner     string   `json:"owner"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Elevation *float64 `json:"elevation"`
+}
+
+type stationResponseModel struct {
+	Station   string   `json:"station"`
+	Name      string   `json:"name"`
+	City      string   `json:"city"`
+	Owner     string   `json:"owner,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Elevation *float64 `json:"elevation,omitempty"`
+}
+
+type stationListResponseModel struct {
+	City     string                 `json:"city"`
+	Stations []stationResponseModel `json:"stations"`
+}
+
+type stationObservationModel struct {
+	Date        string `json:"date"`
+	Station     string `json:"station"`
+	Temperature int    `json:"temperature"`
+}
+
+type stationObservationsResponseModel struct {
+	City         string                    `json:"city"`
+	Observations []stationObservationModel `json:"observations"`
+}
+
+type combinedObservationModel struct {
+	Date        string `json:"date"`
+	Temperature int    `json:"temperature"`
+	Stations    int    `json:"stations"`
+}
+
+type combinedObservationsResponseModel struct {
+	City    string                     `json:"city"`
+	Reducer string                     `json:"reducer"`
+	Weather []combinedObservationModel `json:"weather"`
+}
+
+func toStationResponseModel(station weathermanager.Station) stationResponseModel {
+	response := stationResponseModel{
+		Station: station.ID,
+		Name:    station.Name,
+		City:    station.City,
+		Owner:   station.Owner,
+	}
+	response.Latitude, response.Longitude, response.Elevation = fromCoordinates(station.Coordinates)
+	return response
+}
+
+func (s *Stations) GetStation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&s.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	station, err := weatherMgr.GetStation(ps.ByName("station"))
+	if err != nil {
+		e := weatherManagerError(err, "")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	s.SetResponse(http.StatusOK, toStationResponseModel(station), w)
+}
+
+func (s *Stations) PutStation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&s.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	id := ps.ByName("station")
+	var requestModel stationRequestModel
+	ok = parseBody(&s.ResourceBase, w, r, &requestModel, func() error {
+		return requestModel.validate(id)
+	})
+	if !ok {
+		return
+	}
+
+	_, err := weatherMgr.GetStation(id)
+	exists := err == nil
+
+	station, err := weatherMgr.RegisterStation(weathermanager.Station{
+		ID:          id,
+		Name:        requestModel.Name,
+		City:        requestModel.City,
+		Owner:       requestModel.Owner,
+		Coordinates: toCoordinates(requestModel.Latitude, requestModel.Longitude, requestModel.Elevation),
+	})
+	if err != nil {
+		e := weatherManagerError(err, "Error registering station")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	s.SetResponse(status, toStationResponseModel(station), w)
+}
+
+func (s *Stations) DeleteStation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&s.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	err := weatherMgr.DeleteStation(ps.ByName("station"))
+	if err != nil {
+		e := weatherManagerError(err, "")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	s.SetResponse(http.StatusOK, messageResponseModel{
+		"The station was deleted succesfully!",
+	}, w)
+}
+
+// PatchStationObservations records observations of a station, merging them
+// into the ones it sent before.
+func (s *Stations) PatchStationObservations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&s.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	station, err := weatherMgr.GetStation(ps.ByName("station"))
+	if err != nil {
+		e := weatherManagerError(err, "")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	var requestModel observationsRequestModel
+	ok = parseBody(&s.ResourceBase, w, r, &requestModel, func() error {
+		return requestModel.validate(station.City)
+	})
+	if !ok {
+		return
+	}
+
+	err = weatherMgr.SaveStationObservations(station.ID, toWeatherReport(requestModel.Weather))
+	if err != nil {
+		e := weatherManagerError(err, "Error saving weather")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	s.SetResponse(http.StatusOK, messageResponseModel{
+		"The observations were saved succesfully!",
+	}, w)
+}
+
+func (s *Stations) ListCityStations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&s.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&s.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	stations, err := weatherMgr.ListStations(city.ID)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	response := stationListResponseModel{City: city.ID, Stations: []stationResponseModel{}}
+	for _, station := range stations {
+		response.Stations = append(response.Stations, toStationResponseModel(station))
+	}
+	s.SetResponse(http.StatusOK, response, w)
+}
+
+// ListCityStationObservations lists the observations of every station of a
+// city, or combines them into one value per date with the reducer given in
+// reduce (mean, median, min or max).
+func (s *Stations) ListCityStationObservations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	weatherMgr, ok := authorizeWeatherRequest(&s.ResourceBase, w, r)
+	if !ok {
+		return
+	}
+
+	city, ok := resolveCity(&s.ResourceBase, w, weatherMgr, ps.ByName("city"))
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	dateRange, err := parseDateRange(query, time.Now())
+	if err != nil {
+		s.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+		return
+	}
+
+	reduce := query.Get("reduce")
+	if reduce == "" {
+		observations, err := weatherMgr.StationObservations(city.ID, dateRange)
+		if err != nil {
+			e := weatherManagerError(err, "")
+			s.SetResponse(e.Status, e, w)
+			return
+		}
+
+		response := stationObservationsResponseModel{City: city.ID, Observations: []stationObservationModel{}}
+		for _, o := range observations {
+			response.Observations = append(response.Observations, stationObservationModel{
+				Date:        o.Date,
+				Station:     o.Station,
+				Temperature: o.Temperature,
+			})
+		}
+		s.SetResponse(http.StatusOK, response, w)
+		return
+	}
+
+	reducer, err := weathermanager.ReducerByName(reduce)
+	if err != nil {
+		s.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+		return
+	}
+
+	combined, err := weatherMgr.CombineStationObservations(city.ID, dateRange, reducer)
+	if err != nil {
+		e := weatherManagerError(err, "")
+		s.SetResponse(e.Status, e, w)
+		return
+	}
+
+	response := combinedObservationsResponseModel{City: city.ID, Reducer: reduce, Weather: []combinedObservationModel{}}
+	for _, c := range combined {
+		response.Weather = append(response.Weather, combinedObservationModel{
+			Date:        c.Date,
+			Temperature: c.Temperature,
+			Stations:    c.Stations,
+		})
+	}
+	s.SetResponse(http.StatusOK, response, w)
+}
+
+func (s *Stations) Register(router *httprouter.Router) {
+	s.router = router
+	s.router.GET("/stations/:station", s.GetStation)
+	s.router.PUT("/stations/:station", s.PutStation)
+	s.router.DELETE("/stations/:station", s.DeleteStation)
+	s.router.PATCH("/stations/:station/observations", s.PatchStationObservations)
+	s.router.GET("/cities/:city/stations", s.ListCityStations)
+	s.router.GET("/cities/:city/stations/observations", s.ListCityStationObservations)
+}
@@ -0,0 +1,147 @@
+package resources
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStationsManager() *weathermanager.MainWeatherManager {
+	weatherMgr := weathermanager.New()
+	weatherMgr.RegisterStation(weathermanager.Station{ID: "yvr-airport", City: "vancouver", Owner: "transport"})
+	weatherMgr.RegisterStation(weathermanager.Station{ID: "stanley-park", City: "vancouver"})
+	weatherMgr.RegisterStation(weathermanager.Station{ID: "kitsilano", City: "vancouver"})
+	weatherMgr.SaveStationObservations("yvr-airport", map[string]int{"2020-04-18": 14, "2020-04-19": 16})
+	weatherMgr.SaveStationObservations("stanley-park", map[string]int{"2020-04-18": 15})
+	weatherMgr.SaveStationObservations("kitsilano", map[string]int{"2020-04-18": 20})
+	return weatherMgr
+}
+
+func TestStationPut_ReturnCreatedThenOK(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("PUT", "/stations/YVR%20Airport").
+		WithHeader("Authorization", token).
+		WithBody(`{"name": "YVR Airport", "city": "Vancouver", "owner": "transport", "latitude": 49.19, "longitude": -123.18, "elevation": 4}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusCreated, statusCode)
+	assert.Equal(t, "{\"station\":\"yvr-airport\",\"name\":\"YVR Airport\",\"city\":\"vancouver\",\"owner\":\"transport\",\"latitude\":49.19,\"longitude\":-123.18,\"elevation\":4}", responseBody)
+
+	testServer.Test("PUT", "/stations/yvr-airport").
+		WithHeader("Authorization", token).
+		WithBody(`{"city": "vancouver"}`).
+		Now()
+	statusCode, responseBody = testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"station\":\"yvr-airport\",\"name\":\"yvr-airport\",\"city\":\"vancouver\"}", responseBody)
+}
+
+func TestStationPut_WithAnotherCity_ReturnConflict(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, newStationsManager())
+
+	testServer.Test("PUT", "/stations/yvr-airport").
+		WithHeader("Authorization", token).
+		WithBody(`{"city": "toronto"}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusConflict, statusCode)
+	assert.Contains(t, responseBody, "Station yvr-airport already belongs to vancouver")
+}
+
+func TestStationPut_WithoutCity_ReturnValidationError(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, weathermanager.New())
+
+	testServer.Test("PUT", "/stations/yvr-airport").
+		WithHeader("Authorization", token).
+		WithBody(`{"latitude": 49.19}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Contains(t, responseBody, "{\"pointer\":\"/city\",\"detail\":\"Empty city\"}")
+	assert.Contains(t, responseBody, "{\"pointer\":\"/longitude\",\"detail\":\"Empty longitude\"}")
+}
+
+func TestStationObservations_KeepEveryStationValue(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, newStationsManager())
+
+	testServer.Test("PATCH", "/stations/kitsilano/observations").
+		WithHeader("Authorization", token).
+		WithBody(`{"weather": [{"date": "2020-04-19", "temperature": 18}]}`).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	testServer.Test("GET", "/cities/vancouver/stations/observations?date=2020-04-19").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"observations\":["+
+		"{\"date\":\"2020-04-19\",\"station\":\"kitsilano\",\"temperature\":18},"+
+		"{\"date\":\"2020-04-19\",\"station\":\"yvr-airport\",\"temperature\":16}]}", responseBody)
+}
+
+func TestStationObservations_WithReducer_ReturnCombinedValues(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, newStationsManager())
+
+	for reducer, expected := range map[string]string{
+		"mean":   "{\"date\":\"2020-04-18\",\"temperature\":16,\"stations\":3}",
+		"median": "{\"date\":\"2020-04-18\",\"temperature\":15,\"stations\":3}",
+		"min":    "{\"date\":\"2020-04-18\",\"temperature\":14,\"stations\":3}",
+		"max":    "{\"date\":\"2020-04-18\",\"temperature\":20,\"stations\":3}",
+	} {
+		testServer.Test("GET", "/cities/vancouver/stations/observations?reduce="+reducer).
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, responseBody := testServer.GetResponse()
+
+		assert.Equal(t, http.StatusOK, statusCode, reducer)
+		assert.Equal(t, "{\"city\":\"vancouver\",\"reducer\":\""+reducer+"\",\"weather\":["+expected+","+
+			"{\"date\":\"2020-04-19\",\"temperature\":16,\"stations\":1}]}", responseBody, reducer)
+	}
+}
+
+func TestStationObservations_WithUnknownReducer_ReturnError(t *testing.T) {
+	testServer, token := newAuthorizedTestServer(t, newStationsManager())
+
+	testServer.Test("GET", "/cities/vancouver/stations/observations?reduce=sum").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Contains(t, responseBody, "Invalid reducer sum, expected one of max, mean, median, min")
+}
+
+func TestCityStations_ReturnStationsOfCity(t *testing.T) {
+	weatherMgr := newStationsManager()
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/cities/vancouver/stations").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"stations\":["+
+		"{\"station\":\"kitsilano\",\"name\":\"kitsilano\",\"city\":\"vancouver\"},"+
+		"{\"station\":\"stanley-park\",\"name\":\"stanley-park\",\"city\":\"vancouver\"},"+
+		"{\"station\":\"yvr-airport\",\"name\":\"yvr-airport\",\"city\":\"vancouver\",\"owner\":\"transport\"}]}", responseBody)
+
+	testServer.Test("DELETE", "/cities/vancouver").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, _ = testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	_, err := weatherMgr.GetStation("kitsilano")
+	assert.Error(t, err)
+}
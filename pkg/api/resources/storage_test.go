@@ -0,0 +1,125 @@
+package resources
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+func newTestDatabase(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "weather-storage")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "weather.db")
+}
+
+// storageBackends runs test against every WeatherManager implementation. The
+// behaviour of the storages themselves is tested in weathermanager.
+func storageBackends(t *testing.T, test func(t *testing.T, weatherMgr weathermanager.WeatherManager)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, weathermanager.New())
+	})
+	t.Run("bolt", func(t *testing.T) {
+		weatherMgr, err := weathermanager.OpenBolt(newTestDatabase(t), weathermanager.DefaultOptions())
+		require.NoError(t, err)
+		defer weatherMgr.Close()
+		test(t, weatherMgr)
+	})
+	t.Run("sql", func(t *testing.T) {
+		db, err := sql.Open("sqlite", newTestDatabase(t))
+		require.NoError(t, err)
+		db.SetMaxOpenConns(1)
+		weatherMgr, err := weathermanager.OpenSQL(db, weathermanager.DefaultOptions())
+		require.NoError(t, err)
+		defer weatherMgr.Close()
+		test(t, weatherMgr)
+	})
+}
+
+func TestStorage_GetWeatherWithBoundaries(t *testing.T) {
+	storageBackends(t, func(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+		weatherMgr.SaveWeather("Vancouver", map[string]int{"2020-03-18": -4, "2020-04-17": 14, "2020-04-18": 15, "2020-04-19": 16})
+		testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+		cases := map[string]string{
+			"initial_date=2020-04-17&end_date=2020-04-19":                "[{\"date\":\"2020-04-18\",\"temperature\":15}]",
+			"initial_date=2020-04-17&end_date=2020-04-19&inclusive=both": "[{\"date\":\"2020-04-17\",\"temperature\":14},{\"date\":\"2020-04-18\",\"temperature\":15},{\"date\":\"2020-04-19\",\"temperature\":16}]",
+			"initial_date=2020-04-01":                                    "[{\"date\":\"2020-04-17\",\"temperature\":14},{\"date\":\"2020-04-18\",\"temperature\":15},{\"date\":\"2020-04-19\",\"temperature\":16}]",
+			"initial_date=2020-01-01&end_date=2020-04-01":                "[{\"date\":\"2020-03-18\",\"temperature\":-4}]",
+		}
+		for query, weather := range cases {
+			testServer.Test("GET", "/weather/VANCOUVER?"+query).
+				WithHeader("Authorization", token).
+				Now()
+			statusCode, responseBody := testServer.GetResponse()
+
+			assert.Equal(t, http.StatusOK, statusCode, query)
+			assert.Equal(t, "{\"city\":\"VANCOUVER\",\"weather\":"+weather+"}", responseBody, query)
+		}
+	})
+}
+
+func TestStorage_SaveAndDeleteObservations(t *testing.T) {
+	storageBackends(t, func(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+		testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+		testServer.Test("PUT", "/cities/vancouver/observations/2020-04-20").
+			WithHeader("Authorization", token).
+			WithBody(`{"temperature": 17}`).
+			Now()
+		statusCode, _ := testServer.GetResponse()
+		assert.Equal(t, http.StatusCreated, statusCode)
+
+		testServer.Test("DELETE", "/cities/vancouver/observations/2020-04-18").
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, _ = testServer.GetResponse()
+		assert.Equal(t, http.StatusOK, statusCode)
+
+		testServer.Test("GET", "/cities/vancouver/observations").
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, responseBody := testServer.GetResponse()
+		assert.Equal(t, http.StatusOK, statusCode)
+		assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-19\",\"temperature\":16},{\"date\":\"2020-04-20\",\"temperature\":17}]}", responseBody)
+	})
+}
+
+func TestStorage_DeleteAndUndeleteCity(t *testing.T) {
+	storageBackends(t, func(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+		testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+		testServer.Test("DELETE", "/cities/vancouver").
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, _ := testServer.GetResponse()
+		assert.Equal(t, http.StatusOK, statusCode)
+
+		testServer.Test("GET", "/weather/vancouver?initial_date=2020-04-01").
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, _ = testServer.GetResponse()
+		assert.Equal(t, http.StatusNotFound, statusCode)
+
+		testServer.Test("POST", "/cities/vancouver/undelete").
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, _ = testServer.GetResponse()
+		assert.Equal(t, http.StatusOK, statusCode)
+
+		temperatures, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"2020-04-18": 15}, temperatures)
+	})
+}
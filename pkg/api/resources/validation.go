@@ -0,0 +1,132 @@
+package resources
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/validation"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+)
+
+// validateWeatherEntries checks each entry in order, also rejecting dates
+// repeated within the payload, which would otherwise silently overwrite
+// each other.
+func validateWeatherEntries(v *validation.Validator, entries []weatherEntry) {
+	seen := map[string]int{}
+	for i, entry := range entries {
+		date := validation.Pointer("weather", i, "date")
+		if v.Date(date, entry.Date) {
+			if first, ok := seen[entry.Date]; ok {
+				v.Add(date, "Duplicated date %s (first sent at index %d)", entry.Date, first)
+			} else {
+				seen[entry.Date] = i
+			}
+		}
+		v.Temperature(validation.Pointer("weather", i, "temperature"), entry.Temperature)
+	}
+}
+
+func (m saveWeatherReportRequestModel) validate() error {
+	v := validation.New()
+	v.City(validation.Pointer("city"), m.City)
+	validateWeatherEntries(v, m.Weather)
+	return v.Err()
+}
+
+func (m observationsRequestModel) validate(city string) error {
+	v := validation.New()
+	v.City(validation.Parameter("city"), city)
+	validateWeatherEntries(v, m.Weather)
+	return v.Err()
+}
+
+func (m observationRequestModel) validate(city string, date string) error {
+	v := validation.New()
+	v.City(validation.Parameter("city"), city)
+	v.Date(validation.Parameter("date"), date)
+	if v.Required(validation.Pointer("temperature"), m.Temperature != nil, "temperature") {
+		v.Temperature(validation.Pointer("temperature"), *m.Temperature)
+	}
+	return v.Err()
+}
+
+func validateCityQualifiers(v *validation.Validator, m cityRequestModel) {
+	if m.Country != "" {
+		v.Country(validation.Pointer("country"), m.Country)
+	}
+	if utf8.RuneCountInString(m.Region) > validation.MaxCityLength {
+		v.Add(validation.Pointer("region"), "Region exceeds %d characters", validation.MaxCityLength)
+	}
+	for i, alias := range m.Aliases {
+		v.City(validation.Pointer("aliases", i), alias)
+	}
+	validateLocation(v, m.Latitude, m.Longitude, m.Elevation)
+}
+
+// validateLocation requires latitude and longitude to be sent together, and
+// elevation only along with them.
+func validateLocation(v *validation.Validator, latitude *float64, longitude *float64, elevation *float64) {
+	if (latitude == nil) != (longitude == nil) {
+		if latitude == nil {
+			v.Add(validation.Pointer("latitude"), "Empty latitude")
+		} else {
+			v.Add(validation.Pointer("longitude"), "Empty longitude")
+		}
+	}
+	if latitude != nil {
+		v.Latitude(validation.Pointer("latitude"), *latitude)
+	}
+	if longitude != nil {
+		v.Longitude(validation.Pointer("longitude"), *longitude)
+	}
+	if elevation != nil {
+		if latitude == nil || longitude == nil {
+			v.Add(validation.Pointer("elevation"), "Elevation requires latitude and longitude")
+		}
+		v.Elevation(validation.Pointer("elevation"), *elevation)
+	}
+}
+
+func (m cityRequestModel) validate(city string) error {
+	v := validation.New()
+	v.City(validation.Parameter("city"), city)
+	validateCityQualifiers(v, m)
+	validateWeatherEntries(v, m.Weather)
+	return v.Err()
+}
+
+// validatePatch only accepts new aliases and location for a registered city, as changing
+// its country or region would change its ID.
+func (m cityRequestModel) validatePatch(city weathermanager.City) error {
+	v := validation.New()
+	if m.Country != "" && !strings.EqualFold(m.Country, city.Country) {
+		v.Add(validation.Pointer("country"), "Country can not be changed")
+	}
+	if m.Region != "" && !strings.EqualFold(m.Region, city.Region) {
+		v.Add(validation.Pointer("region"), "Region can not be changed")
+	}
+	for i, alias := range m.Aliases {
+		v.City(validation.Pointer("aliases", i), alias)
+	}
+	validateLocation(v, m.Latitude, m.Longitude, m.Elevation)
+	validateWeatherEntries(v, m.Weather)
+	return v.Err()
+}
+
+func (m stationRequestModel) validate(station string) error {
+	v := validation.New()
+	if strings.TrimSpace(station) == "" {
+		v.Add(validation.Parameter("station"), "Empty station")
+	} else if utf8.RuneCountInString(station) > maxStationLength {
+		v.Add(validation.Parameter("station"), "Station exceeds %d characters", maxStationLength)
+	}
+	v.City(validation.Pointer("city"), m.City)
+	if utf8.RuneCountInString(m.Name) > maxStationLength {
+		v.Add(validation.Pointer("name"), "Name exceeds %d characters", maxStationLength)
+	}
+	if utf8.RuneCountInString(m.Owner) > maxStationLength {
+		v.Add(validation.Pointer("owner"), "Owner exceeds %d characters", maxStationLength)
+	}
+	validateLocation(v, m.Latitude, m.Longitude, m.Elevation)
+	return v.Err()
+}
@@ -1,8 +1,8 @@
 package resources
 
 import (
-	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/felipecurvelo/weather-reporting-api/pkg/authorizer"
 	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
@@ -27,8 +27,9 @@ type weatherEntry struct {
 }
 
 type weatherReportResponseModel struct {
-	City    string         `json:"city"`
-	Weather []weatherEntry `json:"weather"`
+	City       string         `json:"city"`
+	Weather    []weatherEntry `json:"weather"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
 type saveWeatherReportRequestModel struct {
@@ -50,30 +51,37 @@ func (weather *Weather) SaveCityWeather(w http.ResponseWriter, r *http.Request,
 	ctx := r.Context()
 	auth := authorizer.FromContext(ctx)
 	if auth == nil {
-		e := internalerror.New("Internal Server Error")
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
 		weather.SetResponse(http.StatusInternalServerError, e, w)
 		return
 	}
 
 	weatherMgr := weathermanager.FromContext(ctx)
 	if weatherMgr == nil {
-		e := internalerror.New("Internal Server Error")
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
 		weather.SetResponse(http.StatusInternalServerError, e, w)
 		return
 	}
 
 	err := weather.ValidateAuthToken(ctx, r)
 	if err != nil {
-		e := internalerror.New(fmt.Sprintf("Error validating auth token (%s)", err.Error()))
+		e := internalerror.Wrap(err, internalerror.CodeInvalidToken, "Error validating auth token")
 		weather.SetResponse(http.StatusUnauthorized, e, w)
 		return
 	}
+	weatherMgr = weatherMgr.WithActor(weather.Identity(ctx, r))
 
 	var requestModel saveWeatherReportRequestModel
 	err = weather.ParseFromBody(r, &requestModel)
 	if err != nil {
-		e := internalerror.New(fmt.Sprintf("Error parsing request body (%s)", err.Error()))
-		weather.SetResponse(http.StatusInternalServerError, e, w)
+		e := internalerror.Wrap(err, internalerror.CodeInvalidRequestBody, "Error parsing request body")
+		weather.SetResponse(e.Status, e, w)
+		return
+	}
+
+	err = requestModel.validate()
+	if err != nil {
+		weather.SetError(w, r, err)
 		return
 	}
 
@@ -84,8 +92,8 @@ func (weather *Weather) SaveCityWeather(w http.ResponseWriter, r *http.Request,
 
 	err = weatherMgr.SaveWeather(requestModel.City, weatherReport)
 	if err != nil {
-		e := internalerror.New(fmt.Sprintf("Error saving weather (%s)", err.Error()))
-		weather.SetResponse(http.StatusBadRequest, e, w)
+		e := weatherManagerError(err, "Error saving weather")
+		weather.SetResponse(e.Status, e, w)
 		return
 	}
 
@@ -94,97 +102,123 @@ func (weather *Weather) SaveCityWeather(w http.ResponseWriter, r *http.Request,
 	}, w)
 }
 
-func (weather *Weather) GetCityWeather(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func (weather *Weather) getWeatherRequestFromURL(r *http.Request, ps httprouter.Params) (getWeatherReportRequestModel, bool) {
+	query := r.URL.Query()
+	requestModel := getWeatherReportRequestModel{
+		City:        query.Get("city"),
+		InitialDate: query.Get("initial_date"),
+		EndDate:     query.Get("end_date"),
+	}
+
+	if city := ps.ByName("city"); city != "" {
+		requestModel.City = city
+	}
+
+	ok := requestModel.City != "" || hasDateRange(query)
+	return requestModel, ok
+}
+
+func (weather *Weather) GetCityWeather(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	ctx := r.Context()
 	auth := authorizer.FromContext(ctx)
 	if auth == nil {
-		e := internalerror.New("Internal Server Error")
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
 		weather.SetResponse(http.StatusInternalServerError, e, w)
 		return
 	}
 
 	weatherMgr := weathermanager.FromContext(ctx)
 	if weatherMgr == nil {
-		e := internalerror.New("Internal Server Error")
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
 		weather.SetResponse(http.StatusInternalServerError, e, w)
 		return
 	}
 
 	err := weather.ValidateAuthToken(ctx, r)
 	if err != nil {
-		e := internalerror.New(fmt.Sprintf("Error validating auth token (%s)", err.Error()))
+		e := internalerror.Wrap(err, internalerror.CodeInvalidToken, "Error validating auth token")
 		weather.SetResponse(http.StatusUnauthorized, e, w)
 		return
 	}
-
-	var requestModel getWeatherReportRequestModel
-	err = weather.ParseFromBody(r, &requestModel)
-	if err != nil {
-		e := internalerror.New(fmt.Sprintf("Error parsing request body (%s)", err.Error()))
-		weather.SetResponse(http.StatusInternalServerError, e, w)
+	weatherMgr = weatherMgr.WithActor(weather.Identity(ctx, r))
+
+	requestModel, ok := weather.getWeatherRequestFromURL(r, ps)
+	if ok {
+		dateRange, err := parseDateRange(r.URL.Query(), time.Now())
+		if err != nil {
+			weather.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+			return
+		}
+		asOf, err := parseAsOf(r.URL.Query())
+		if err != nil {
+			weather.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+			return
+		}
+
+		writeWeatherReport(&weather.ResourceBase, w, r, requestModel.City, dateRange, func(dateRange weathermanager.DateRange, fn func(string, int) bool) error {
+			return weatherMgr.IterateRangeAsOf(requestModel.City, dateRange, asOf, fn)
+		})
 		return
 	}
 
-	cityWeather, err := weatherMgr.GetWeather(
-		requestModel.City,
-		requestModel.InitialDate,
-		requestModel.EndDate,
-	)
+	// Reading the filters from a GET body is deprecated, as proxies and
+	// caches are free to drop it. Kept as a fallback for older clients.
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Warning", `299 - "Sending filters in the body of GET /weather/ is deprecated, use query parameters"`)
+
+	err = weather.ParseFromBody(r, &requestModel)
 	if err != nil {
-		e := internalerror.New(err.Error())
-		weather.SetResponse(http.StatusBadRequest, e, w)
+		e := internalerror.Wrap(err, internalerror.CodeInvalidRequestBody, "Error parsing request body")
+		weather.SetResponse(e.Status, e, w)
 		return
 	}
 
-	weatherEntries := []weatherEntry{}
-	for k, v := range cityWeather {
-		weatherEntries = append(weatherEntries, weatherEntry{
-			Date:        k,
-			Temperature: v,
-		})
-
-	}
-
-	weather.SetResponse(http.StatusOK, weatherReportResponseModel{
-		City:    requestModel.City,
-		Weather: weatherEntries,
-	}, w)
+	dateRange := weathermanager.Between(requestModel.InitialDate, requestModel.EndDate)
+	writeWeatherReport(&weather.ResourceBase, w, r, requestModel.City, dateRange, func(dateRange weathermanager.DateRange, fn func(string, int) bool) error {
+		if requestModel.InitialDate == "" || requestModel.EndDate == "" {
+			// Reports which of the dates is missing.
+			return weatherMgr.IterateWeather(requestModel.City, requestModel.InitialDate, requestModel.EndDate, fn)
+		}
+		return weatherMgr.IterateRange(requestModel.City, dateRange, fn)
+	})
 }
 
 func (weather *Weather) DeleteCityWeather(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	ctx := r.Context()
 	auth := authorizer.FromContext(ctx)
 	if auth == nil {
-		e := internalerror.New("Internal Server Error")
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
 		weather.SetResponse(http.StatusInternalServerError, e, w)
 		return
 	}
 
 	weatherMgr := weathermanager.FromContext(ctx)
 	if weatherMgr == nil {
-		e := internalerror.New("Internal Server Error")
+		e := internalerror.New(internalerror.CodeInternal, "Internal Server Error")
 		weather.SetResponse(http.StatusInternalServerError, e, w)
 		return
 	}
 
 	err := weather.ValidateAuthToken(ctx, r)
 	if err != nil {
-		e := internalerror.New(fmt.Sprintf("Error validating auth token (%s)", err.Error()))
+		e := internalerror.Wrap(err, internalerror.CodeInvalidToken, "Error validating auth token")
 		weather.SetResponse(http.StatusUnauthorized, e, w)
 		return
 	}
+	weatherMgr = weatherMgr.WithActor(weather.Identity(ctx, r))
 
 	var requestModel deleteWeatherReportRequestModel
 	err = weather.ParseFromBody(r, &requestModel)
 	if err != nil {
-		e := internalerror.New(fmt.Sprintf("Error parsing request body (%s)", err.Error()))
-		weather.SetResponse(http.StatusInternalServerError, e, w)
+		e := internalerror.Wrap(err, internalerror.CodeInvalidRequestBody, "Error parsing request body")
+		weather.SetResponse(e.Status, e, w)
 		return
 	}
 
 	err = weatherMgr.DeleteWeather(requestModel.City)
 	if err != nil {
-		weather.SetResponse(http.StatusInternalServerError, err, w)
+		e := weatherManagerError(err, "")
+		weather.SetResponse(e.Status, e, w)
 		return
 	}
 
@@ -197,5 +231,6 @@ func (weather *Weather) Register(router *httprouter.Router) {
 	weather.router = router
 	weather.router.POST("/weather/", weather.SaveCityWeather)
 	weather.router.GET("/weather/", weather.GetCityWeather)
+	weather.router.GET("/weather/:city", weather.GetCityWeather)
 	weather.router.DELETE("/weather/", weather.DeleteCityWeather)
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
 	"github.com/felipecurvelo/weather-reporting-api/pkg/authorizer"
@@ -23,7 +24,7 @@ func TestWeatherSave_WithEmptyAuthHeader_ReturnUnauthorized(t *testing.T) {
 	statusCode, responseBody := testServer.GetResponse()
 
 	assert.Equal(t, http.StatusUnauthorized, statusCode)
-	assert.Equal(t, "{\"error\":\"Error validating auth token (Empty Token)\"}", responseBody)
+	assert.Equal(t, "{\"type\":\"/problems/missing_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Error validating auth token (Empty Token)\",\"code\":\"missing_token\",\"error\":\"Error validating auth token (Empty Token)\"}", responseBody)
 }
 
 func TestWeatherSave_WithInvalidAuthToken_ReturnUnauthorized(t *testing.T) {
@@ -39,7 +40,7 @@ func TestWeatherSave_WithInvalidAuthToken_ReturnUnauthorized(t *testing.T) {
 	statusCode, responseBody := testServer.GetResponse()
 
 	assert.Equal(t, http.StatusUnauthorized, statusCode)
-	assert.Equal(t, "{\"error\":\"Error validating auth token (Invalid Token)\"}", responseBody)
+	assert.Equal(t, "{\"type\":\"/problems/invalid_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Error validating auth token (Invalid Token)\",\"code\":\"invalid_token\",\"error\":\"Error validating auth token (Invalid Token)\"}", responseBody)
 }
 
 func TestWeatherSave_ReturnOK(t *testing.T) {
@@ -134,7 +135,7 @@ func TestWeatherSave_WithInvalidDate_ReturnError(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Invalid date")
 }
 
@@ -182,7 +183,7 @@ func TestWeatherSave_WithInvalidDateRange_ReturnError(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Invalid date")
 }
 
@@ -197,7 +198,7 @@ func TestWeatherGet_WithEmptyAuthHeader_ReturnUnauthorized(t *testing.T) {
 	statusCode, responseBody := testServer.GetResponse()
 
 	assert.Equal(t, http.StatusUnauthorized, statusCode)
-	assert.Equal(t, "{\"error\":\"Error validating auth token (Empty Token)\"}", responseBody)
+	assert.Equal(t, "{\"type\":\"/problems/missing_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Error validating auth token (Empty Token)\",\"code\":\"missing_token\",\"error\":\"Error validating auth token (Empty Token)\"}", responseBody)
 }
 
 func TestWeatherGet_WithInvalidAuthToken_ReturnUnauthorized(t *testing.T) {
@@ -213,7 +214,7 @@ func TestWeatherGet_WithInvalidAuthToken_ReturnUnauthorized(t *testing.T) {
 	statusCode, responseBody := testServer.GetResponse()
 
 	assert.Equal(t, http.StatusUnauthorized, statusCode)
-	assert.Equal(t, "{\"error\":\"Error validating auth token (Invalid Token)\"}", responseBody)
+	assert.Equal(t, "{\"type\":\"/problems/invalid_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Error validating auth token (Invalid Token)\",\"code\":\"invalid_token\",\"error\":\"Error validating auth token (Invalid Token)\"}", responseBody)
 }
 
 func TestWeatherGet_ReturnOK(t *testing.T) {
@@ -343,7 +344,7 @@ func TestWeatherGet_WithEmptyCity_ReturnError(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Empty city")
 }
 
@@ -408,7 +409,7 @@ func TestWeatherGet_WithEmptyInitialDate_ReturnError(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Empty initial date")
 }
 
@@ -474,7 +475,7 @@ func TestWeatherGet_WithInvalidInitialDate_ReturnOK(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Invalid initial date")
 }
 
@@ -540,7 +541,7 @@ func TestWeatherGet_WithInvalidInitialDateRange_ReturnOK(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Invalid initial date")
 }
 
@@ -605,7 +606,7 @@ func TestWeatherGet_WithEmptyEndDate_ReturnOK(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Empty end date")
 }
 
@@ -671,7 +672,7 @@ func TestWeatherGet_WithInvalidEndDate_ReturnOK(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Invalid end date")
 }
 
@@ -737,7 +738,7 @@ func TestWeatherGet_WithInvalidEndDateRange_ReturnOK(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Invalid end date")
 }
 
@@ -803,7 +804,7 @@ func TestWeatherGet_WithInvalidDateRange_ReturnOK(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
 	assert.Contains(t, responseBody, "Invalid date range")
 }
 
@@ -818,7 +819,7 @@ func TestWeatherDelete_WithEmptyAuthHeader_ReturnUnauthorized(t *testing.T) {
 	statusCode, responseBody := testServer.GetResponse()
 
 	assert.Equal(t, http.StatusUnauthorized, statusCode)
-	assert.Equal(t, "{\"error\":\"Error validating auth token (Empty Token)\"}", responseBody)
+	assert.Equal(t, "{\"type\":\"/problems/missing_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Error validating auth token (Empty Token)\",\"code\":\"missing_token\",\"error\":\"Error validating auth token (Empty Token)\"}", responseBody)
 }
 
 func TestWeatherDelete_WithInvalidAuthToken_ReturnUnauthorized(t *testing.T) {
@@ -834,7 +835,7 @@ func TestWeatherDelete_WithInvalidAuthToken_ReturnUnauthorized(t *testing.T) {
 	statusCode, responseBody := testServer.GetResponse()
 
 	assert.Equal(t, http.StatusUnauthorized, statusCode)
-	assert.Equal(t, "{\"error\":\"Error validating auth token (Invalid Token)\"}", responseBody)
+	assert.Equal(t, "{\"type\":\"/problems/invalid_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Error validating auth token (Invalid Token)\",\"code\":\"invalid_token\",\"error\":\"Error validating auth token (Invalid Token)\"}", responseBody)
 }
 
 func TestWeatherDelete_ReturnEmpty(t *testing.T) {
@@ -928,7 +929,221 @@ func TestWeatherDelete_ReturnEmpty(t *testing.T) {
 		Now()
 	statusCode, responseBody = testServer.GetResponse()
 
-	assert.Equal(t, http.StatusBadRequest, statusCode)
-	assert.Equal(t, "{\"error\":\"Weather report not found\"}", responseBody)
+	assert.Equal(t, http.StatusNotFound, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/not_found\",\"title\":\"Not Found\",\"status\":404,\"detail\":\"Weather report not found\",\"code\":\"not_found\",\"error\":\"Weather report not found\"}", responseBody)
 	assert.NotContains(t, responseBody, "vancouver")
 }
+
+func newAuthorizedTestServer(t *testing.T, weatherMgr weathermanager.WeatherManager) (*api.TestServer, string) {
+	return newAuthorizedTestServerWithOptions(t, weatherMgr, &api.ServerOptions{})
+}
+
+func newAuthorizedTestServerWithOptions(t *testing.T, weatherMgr weathermanager.WeatherManager, options *api.ServerOptions) (*api.TestServer, string) {
+	ctx := authorizer.NewContext(context.Background(), authorizer.NewAuthMock())
+	ctx = weathermanager.NewContext(ctx, weatherMgr)
+
+	testServer := api.NewTestServerWithOptions(ctx, t, options).
+		RegisterResource(&Auth{}).
+		RegisterResource(&Weather{}).
+		RegisterResource(&Cities{}).
+		RegisterResource(&Observations{}).
+		RegisterResource(&Stations{}).
+		RegisterResource(&Retention{}).
+		RegisterResource(&Import{}).
+		RegisterResource(&Snapshot{}).
+		RegisterResource(&Cache{})
+
+	testServer.Test("POST", "/auth/").
+		WithBody(`{"name": "kirang", "password": "secret"}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	var tokenObj map[string]interface{}
+	err := json.Unmarshal([]byte(responseBody), &tokenObj)
+	assert.NoError(t, err)
+
+	return testServer, tokenObj["token"].(string)
+}
+
+func TestWeatherGet_WithQueryParams_ReturnOK(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-05-18": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/weather/?city=vancouver&initial_date=2020-04-01&end_date=2020-04-30").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-18\",\"temperature\":15}]}", responseBody)
+	assert.Empty(t, testServer.GetResponseHeader("Deprecation"))
+}
+
+func TestWeatherGet_WithCityInPath_ReturnOK(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/weather/vancouver?initial_date=2020-04-01&end_date=2020-04-30").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-18\",\"temperature\":15}]}", responseBody)
+}
+
+func TestWeatherGet_WithQueryParamsMissingEndDate_ReturnOpenEndedRange(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-03-18": 14, "2020-04-18": 15, "2020-05-18": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/weather/vancouver?initial_date=2020-04-01").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-18\",\"temperature\":15},{\"date\":\"2020-05-18\",\"temperature\":16}]}", responseBody)
+}
+
+func TestWeatherGet_WithInclusiveBoundaries_ReturnBoundaryDates(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 14, "2020-04-18": 15, "2020-04-19": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	cases := map[string]string{
+		"inclusive=none":  "[{\"date\":\"2020-04-18\",\"temperature\":15}]",
+		"inclusive=start": "[{\"date\":\"2020-04-17\",\"temperature\":14},{\"date\":\"2020-04-18\",\"temperature\":15}]",
+		"inclusive=end":   "[{\"date\":\"2020-04-18\",\"temperature\":15},{\"date\":\"2020-04-19\",\"temperature\":16}]",
+		"inclusive=both":  "[{\"date\":\"2020-04-17\",\"temperature\":14},{\"date\":\"2020-04-18\",\"temperature\":15},{\"date\":\"2020-04-19\",\"temperature\":16}]",
+	}
+
+	for inclusive, weather := range cases {
+		testServer.Test("GET", "/weather/vancouver?initial_date=2020-04-17&end_date=2020-04-19&"+inclusive).
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, responseBody := testServer.GetResponse()
+
+		assert.Equal(t, http.StatusOK, statusCode, inclusive)
+		assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":"+weather+"}", responseBody, inclusive)
+	}
+}
+
+func TestWeatherGet_WithSingleDate_ReturnThatDay(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 14, "2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/weather/vancouver?date=2020-04-18").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"city\":\"vancouver\",\"weather\":[{\"date\":\"2020-04-18\",\"temperature\":15}]}", responseBody)
+}
+
+func TestWeatherGet_WithLastDays_ReturnRecentObservations(t *testing.T) {
+	today := time.Now().UTC()
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{
+		today.Format("2006-01-02"):                   15,
+		today.AddDate(0, 0, -6).Format("2006-01-02"): 14,
+		today.AddDate(0, 0, -7).Format("2006-01-02"): 13,
+	})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/weather/vancouver?last=1w").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Contains(t, responseBody, "\"temperature\":14")
+	assert.Contains(t, responseBody, "\"temperature\":15")
+	assert.NotContains(t, responseBody, "\"temperature\":13")
+}
+
+func TestWeatherGet_WithInvalidRangeParameters_ReturnBadRequest(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	for _, query := range []string{"last=0d", "last=soon", "date=2020-04-18&last=7d", "inclusive=left", "last=7d&end_date=2020-04-18"} {
+		testServer.Test("GET", "/weather/vancouver?"+query).
+			WithHeader("Authorization", token).
+			Now()
+		statusCode, responseBody := testServer.GetResponse()
+
+		assert.Equal(t, http.StatusBadRequest, statusCode, query)
+		assert.Contains(t, responseBody, "\"code\":\"invalid_parameter\"", query)
+	}
+}
+
+func TestWeatherGet_WithBody_ReturnDeprecationHeader(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/weather/").
+		WithHeader("Authorization", token).
+		WithBody(`{"city": "vancouver", "initial_date": "2020-04-01", "end_date": "2020-04-30"}`).
+		Now()
+	statusCode, _ := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "true", testServer.GetResponseHeader("Deprecation"))
+}
+
+func TestWeatherGet_WithStreamAndInvalidRange_ReturnError(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/weather/vancouver?initial_date=2020-04-30&end_date=2020-04-01&stream=true").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/validation_failed\",\"title\":\"Unprocessable Entity\",\"status\":422,\"detail\":\"Invalid date range\",\"code\":\"validation_failed\",\"error\":\"Invalid date range\"}", responseBody)
+}
+
+func TestWeatherGet_WithCSVFormat_ReturnCSV(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-17": 17, "2020-05-18": 16})
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("GET", "/weather/vancouver?initial_date=2020-04-01&end_date=2020-04-30&format=csv").
+		WithHeader("Authorization", token).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "attachment; filename=\"vancouver-weather.csv\"", testServer.GetResponseHeader("Content-Disposition"))
+	assert.Equal(t, "city,date,temperature\nvancouver,2020-04-17,17\nvancouver,2020-04-18,15\n", responseBody)
+}
+
+func TestWeatherSave_WithSeveralViolations_ReturnAllErrors(t *testing.T) {
+	weatherMgr := weathermanager.New()
+	testServer, token := newAuthorizedTestServer(t, weatherMgr)
+
+	testServer.Test("POST", "/weather/").
+		WithHeader("Authorization", token).
+		WithBody(`{"city": "", "weather": [
+			{"date": "2020-04-17", "temperature": 15},
+			{"date": "2020-04-17", "temperature": 16},
+			{"date": "2999-01-01", "temperature": 500}
+		]}`).
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/validation_failed\",\"title\":\"Unprocessable Entity\",\"status\":422,\"detail\":\"Empty city (and 3 more errors)\",\"instance\":\"/weather/\",\"code\":\"validation_failed\",\"error\":\"Empty city (and 3 more errors)\",\"errors\":[{\"pointer\":\"/city\",\"detail\":\"Empty city\"},{\"pointer\":\"/weather/1/date\",\"detail\":\"Duplicated date 2020-04-17 (first sent at index 0)\"},{\"pointer\":\"/weather/2/date\",\"detail\":\"Date 2999-01-01 is in the future\"},{\"pointer\":\"/weather/2/temperature\",\"detail\":\"Temperature 500 is out of range [-100, 70]\"}]}", responseBody)
+
+	_, exists := weatherMgr.GetAllWeather("")
+	assert.False(t, exists)
+}
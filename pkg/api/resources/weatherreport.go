@@ -0,0 +1,339 @@
+package resources
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/api"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+)
+
+const (
+	maxObservationsLimit = 10000
+	streamFlushInterval  = 100
+	nextCursorTrailer    = "Next-Cursor"
+	streamErrorTrailer   = "Stream-Error"
+)
+
+// iterateWeatherFunc iterates the observations within a date range, in date
+// order.
+type iterateWeatherFunc func(weathermanager.DateRange, func(string, int) bool) error
+
+type observationsPage struct {
+	limit  int
+	after  string
+	stream bool
+}
+
+func encodeObservationsCursor(date string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(date))
+}
+
+func decodeObservationsCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("Invalid cursor")
+	}
+
+	date := string(b)
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", fmt.Errorf("Invalid cursor")
+	}
+	return date, nil
+}
+
+func parseObservationsPage(r *http.Request) (observationsPage, error) {
+	query := r.URL.Query()
+	page := observationsPage{}
+
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		page.limit, err = strconv.Atoi(limit)
+		if err != nil || page.limit <= 0 {
+			return page, fmt.Errorf("Invalid limit %s", limit)
+		}
+		if page.limit > maxObservationsLimit {
+			page.limit = maxObservationsLimit
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		page.after, err = decodeObservationsCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	if stream := query.Get("stream"); stream != "" {
+		var err error
+		page.stream, err = strconv.ParseBool(stream)
+		if err != nil {
+			return page, fmt.Errorf("Invalid stream %s", stream)
+		}
+	}
+
+	return page, nil
+}
+
+// pageRange narrows dateRange to the observations after the cursor of page, so
+// each page is read from where the previous one stopped rather than from the
+// start of the range.
+func pageRange(dateRange weathermanager.DateRange, page observationsPage) weathermanager.DateRange {
+	if page.after == "" || page.after < dateRange.From {
+		return dateRange
+	}
+	if dateRange.To != "" && page.after >= dateRange.To {
+		// Nothing is left after the cursor, the last day is only read to
+		// look the city up and is skipped as it is not after the cursor.
+		return weathermanager.SingleDay(dateRange.To)
+	}
+
+	dateRange.From = page.after
+	dateRange.FromInclusive = false
+	return dateRange
+}
+
+// reportFormat resolves the representation of a report: the format query
+// parameter wins over the Accept header, and stream=true asks for NDJSON.
+func reportFormat(r *http.Request, page observationsPage) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "json":
+		return api.MediaTypeJSON, nil
+	case "csv":
+		return api.MediaTypeCSV, nil
+	case "ndjson":
+		return api.MediaTypeNDJSON, nil
+	case "":
+	default:
+		return "", fmt.Errorf("Invalid format %s", format)
+	}
+
+	if page.stream {
+		return api.MediaTypeNDJSON, nil
+	}
+
+	return api.NegotiateContentType(r, api.MediaTypeJSON, api.MediaTypeCSV, api.MediaTypeNDJSON), nil
+}
+
+func attachmentFilename(city string, extension string) string {
+	name := []rune{}
+	for _, c := range strings.ToLower(city) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' {
+			name = append(name, c)
+		} else {
+			name = append(name, '_')
+		}
+	}
+	if len(name) == 0 {
+		return "weather." + extension
+	}
+	return string(name) + "-weather." + extension
+}
+
+// csvSafe keeps spreadsheet applications from evaluating user provided values
+// as formulas.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@") {
+		return "'" + value
+	}
+	return value
+}
+
+// writeWeatherReport writes the observations of dateRange yielded by iterate,
+// honouring the limit, cursor and stream query parameters. Without a limit
+// every observation is returned in a single page, as before pagination
+// existed.
+func writeWeatherReport(base *api.ResourceBase, w http.ResponseWriter, r *http.Request, city string, dateRange weathermanager.DateRange, iterate iterateWeatherFunc) {
+	page, err := parseObservationsPage(r)
+	if err != nil {
+		base.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+		return
+	}
+
+	format, err := reportFormat(r, page)
+	if err != nil {
+		base.SetResponse(http.StatusBadRequest, internalerror.New(internalerror.CodeInvalidParameter, err.Error()), w)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+
+	switch format {
+	case "":
+		e := internalerror.New(internalerror.CodeNotAcceptable, "Not Acceptable, supported types are application/json, text/csv and application/x-ndjson")
+		base.SetResponse(http.StatusNotAcceptable, e, w)
+		return
+	case api.MediaTypeCSV:
+		streamWeatherReport(base, w, city, dateRange, page, newCSVReportWriter(w, city), iterate)
+		return
+	case api.MediaTypeNDJSON:
+		streamWeatherReport(base, w, city, dateRange, page, newNDJSONReportWriter(w), iterate)
+		return
+	}
+
+	response := weatherReportResponseModel{
+		City:    city,
+		Weather: []weatherEntry{},
+	}
+	err = iterate(pageRange(dateRange, page), func(date string, temperature int) bool {
+		if date <= page.after {
+			return true
+		}
+		if page.limit > 0 && len(response.Weather) == page.limit {
+			response.NextCursor = encodeObservationsCursor(response.Weather[page.limit-1].Date)
+			return false
+		}
+
+		response.Weather = append(response.Weather, weatherEntry{
+			Date:        date,
+			Temperature: temperature,
+		})
+		return true
+	})
+	if err != nil {
+		e := weatherManagerError(err, "")
+		base.SetResponse(e.Status, e, w)
+		return
+	}
+
+	base.SetResponse(http.StatusOK, response, w)
+}
+
+type reportWriter interface {
+	ContentType() string
+	Extension() string
+	WriteHeader() error
+	WriteEntry(weatherEntry) error
+	Flush() error
+}
+
+type ndjsonReportWriter struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONReportWriter(w http.ResponseWriter) *ndjsonReportWriter {
+	return &ndjsonReportWriter{encoder: json.NewEncoder(w)}
+}
+
+func (n *ndjsonReportWriter) ContentType() string             { return api.MediaTypeNDJSON }
+func (n *ndjsonReportWriter) Extension() string               { return "ndjson" }
+func (n *ndjsonReportWriter) WriteHeader() error              { return nil }
+func (n *ndjsonReportWriter) WriteEntry(e weatherEntry) error { return n.encoder.Encode(e) }
+func (n *ndjsonReportWriter) Flush() error                    { return nil }
+
+type csvReportWriter struct {
+	writer *csv.Writer
+	city   string
+}
+
+func newCSVReportWriter(w http.ResponseWriter, city string) *csvReportWriter {
+	return &csvReportWriter{
+		writer: csv.NewWriter(w),
+		city:   csvSafe(city),
+	}
+}
+
+func (c *csvReportWriter) ContentType() string { return api.MediaTypeCSV + "; charset=utf-8" }
+func (c *csvReportWriter) Extension() string   { return "csv" }
+
+func (c *csvReportWriter) WriteHeader() error {
+	return c.writer.Write([]string{"city", "date", "temperature"})
+}
+
+// WriteEntry buffers the row, errors writing the buffer surface in Write or
+// Flush once it fills up.
+func (c *csvReportWriter) WriteEntry(e weatherEntry) error {
+	return c.writer.Write([]string{c.city, e.Date, strconv.Itoa(e.Temperature)})
+}
+
+func (c *csvReportWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// streamWeatherReport writes the observations row by row as they are
+// iterated. When the limit cuts the stream short, the cursor for the next page
+// is sent in the Next-Cursor trailer. The status is sent with the first row,
+// so an error reading the observations after it is reported in the
+// Stream-Error trailer, which complete streams never carry. Iterating stops at
+// the first error writing the response, as a client going away does not
+// cancel the request.
+func streamWeatherReport(base *api.ResourceBase, w http.ResponseWriter, city string, dateRange weathermanager.DateRange, page observationsPage, report reportWriter, iterate iterateWeatherFunc) {
+	flusher, _ := w.(http.Flusher)
+	started := false
+	written := 0
+	lastDate := ""
+	var writeErr error
+
+	start := func() {
+		w.Header().Set("Content-Type", report.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachmentFilename(city, report.Extension())))
+		w.Header().Set("Trailer", nextCursorTrailer+", "+streamErrorTrailer)
+		w.WriteHeader(http.StatusOK)
+		writeErr = report.WriteHeader()
+		started = true
+	}
+
+	err := iterate(pageRange(dateRange, page), func(date string, temperature int) bool {
+		if date <= page.after {
+			return true
+		}
+		if page.limit > 0 && written == page.limit {
+			w.Header().Set(nextCursorTrailer, encodeObservationsCursor(lastDate))
+			return false
+		}
+		if !started {
+			start()
+		}
+		if writeErr == nil {
+			writeErr = report.WriteEntry(weatherEntry{
+				Date:        date,
+				Temperature: temperature,
+			})
+		}
+		if writeErr != nil {
+			return false
+		}
+		written++
+		lastDate = date
+
+		if written%streamFlushInterval == 0 {
+			writeErr = report.Flush()
+			if writeErr != nil {
+				return false
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return true
+	})
+	if err != nil && !started {
+		e := weatherManagerError(err, "")
+		base.SetResponse(e.Status, e, w)
+		return
+	}
+
+	if !started {
+		start()
+	}
+	if writeErr == nil {
+		writeErr = report.Flush()
+	}
+	if writeErr != nil {
+		log.Printf("Error writing the weather report of %s (%s)", city, writeErr.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading the weather report of %s (%s)", city, err.Error())
+		w.Header().Set(streamErrorTrailer, weatherManagerError(err, "").Error())
+	}
+}
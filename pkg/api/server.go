@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,14 +18,60 @@ type Resource interface {
 }
 
 type Server struct {
-	httpServer  *http.Server
-	mainContext context.Context
-	Router      *httprouter.Router
-	stop        chan os.Signal
+	httpServer   *http.Server
+	mainContext  context.Context
+	options      *ServerOptions
+	Router       *httprouter.Router
+	listener     net.Listener
+	certificates *certificateReloader
+	versions     map[string]*versionGroup
+	stop         chan os.Signal
+	reload       chan os.Signal
 }
 
+const (
+	DefaultMaxBodyBytes   = 1 << 20
+	DefaultMaxImportBytes = 64 << 20
+)
+
 type ServerOptions struct {
-	Port int
+	Port                   int
+	CertFile               string
+	KeyFile                string
+	ClientCAFile           string
+	RequireClientCert      bool
+	MaxBodyBytes           int64
+	MaxImportBytes         int64
+	StrictJSON             bool
+	RequireJSONContentType bool
+}
+
+func (o *ServerOptions) TLSEnabled() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+func (o *ServerOptions) maxBodyBytes() int64 {
+	if o.MaxBodyBytes <= 0 {
+		return DefaultMaxBodyBytes
+	}
+	return o.MaxBodyBytes
+}
+
+func (o *ServerOptions) ImportBytesLimit() int64 {
+	if o.MaxImportBytes <= 0 {
+		return DefaultMaxImportBytes
+	}
+	return o.MaxImportBytes
+}
+
+type optionsContextKey struct{}
+
+func OptionsFromContext(ctx context.Context) *ServerOptions {
+	options, ok := ctx.Value(optionsContextKey{}).(*ServerOptions)
+	if !ok {
+		return &ServerOptions{}
+	}
+	return options
 }
 
 func (s *Server) GetHttpHandler() http.Handler {
@@ -36,12 +83,25 @@ func (s *Server) GetHttpHandler() http.Handler {
 }
 
 func (s *Server) Start() *Server {
-	s.stop = make(chan os.Signal)
+	s.stop = make(chan os.Signal, 1)
 	signal.Notify(s.stop, syscall.SIGTERM, syscall.SIGINT)
 
+	listener, err := s.listen()
+	if err != nil {
+		fmt.Println(fmt.Sprintf("[Listen]: %s\n", err))
+		s.stop <- syscall.SIGQUIT
+		return s
+	}
+	s.listener = listener
+
 	startServer := func() {
-		if err := s.httpServer.ListenAndServe(); err != nil {
-			fmt.Println(fmt.Sprintf("[ListenAndServe]: %s\n", err))
+		serve := func() error { return s.httpServer.Serve(listener) }
+		if s.options.TLSEnabled() {
+			serve = func() error { return s.httpServer.ServeTLS(listener, "", "") }
+		}
+
+		if err := serve(); err != nil && err != http.ErrServerClosed {
+			fmt.Println(fmt.Sprintf("[Serve]: %s\n", err))
 			s.stop <- syscall.SIGQUIT
 		}
 	}
@@ -51,12 +111,70 @@ func (s *Server) Start() *Server {
 	return s
 }
 
+func (s *Server) listen() (net.Listener, error) {
+	if s.options.TLSEnabled() {
+		certificates, err := newCertificateReloader(s.options.CertFile, s.options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig, err := newTLSConfig(s.options, certificates)
+		if err != nil {
+			return nil, err
+		}
+
+		s.certificates = certificates
+		s.httpServer.TLSConfig = tlsConfig
+		s.watchReloadSignal()
+	}
+
+	return net.Listen("tcp", s.httpServer.Addr)
+}
+
+func (s *Server) watchReloadSignal() {
+	// The goroutine ranges over its own copy of the channel, as Close resets
+	// the field.
+	reload := make(chan os.Signal, 1)
+	s.reload = reload
+	signal.Notify(reload, syscall.SIGHUP)
+
+	go func() {
+		for range reload {
+			if err := s.ReloadCertificates(); err != nil {
+				fmt.Println(fmt.Sprintf("[ReloadCertificates]: %s\n", err))
+			}
+		}
+	}()
+}
+
+func (s *Server) ReloadCertificates() error {
+	if s.certificates == nil {
+		return fmt.Errorf("TLS is not enabled")
+	}
+
+	return s.certificates.Reload()
+}
+
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+
+	return s.listener.Addr()
+}
+
 func (s *Server) WaitForShutdownSignal() *Server {
 	<-s.stop
 	return s
 }
 
 func (s *Server) Close() error {
+	if s.reload != nil {
+		signal.Stop(s.reload)
+		close(s.reload)
+		s.reload = nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	err := s.httpServer.Shutdown(ctx)
@@ -69,13 +187,16 @@ func (s *Server) RegisterResource(resource Resource) *Server {
 }
 
 func NewServer(ctx context.Context, options *ServerOptions) *Server {
+	ctx = context.WithValue(ctx, optionsContextKey{}, options)
 	server := &Server{
 		httpServer:  &http.Server{Addr: fmt.Sprintf("0.0.0.0:%d", options.Port)},
 		mainContext: ctx,
+		options:     options,
 		Router:      httprouter.New(),
+		versions:    map[string]*versionGroup{},
 	}
 
-	mainHandler := http.Handler(server.Router)
+	mainHandler := requestIDHandler(recoveryHandler(server.versionHandler(server.Router)))
 	contextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		r = r.WithContext(ctx)
 		mainHandler.ServeHTTP(w, r)
@@ -25,6 +25,16 @@ func (ts *TestServer) RegisterResource(resource Resource) *TestServer {
 	return ts
 }
 
+func (ts *TestServer) RegisterVersion(name string, options VersionOptions) *TestServer {
+	ts.apiServer.RegisterVersion(name, options)
+	return ts
+}
+
+func (ts *TestServer) RegisterVersionedResource(version string, resource Resource) *TestServer {
+	ts.apiServer.RegisterVersionedResource(version, resource)
+	return ts
+}
+
 func (ts *TestServer) Test(method string, endpointURL string) *TestServer {
 	ts.httpServer = httptest.NewUnstartedServer(ts.apiServer.GetHttpHandler())
 
@@ -69,9 +79,11 @@ func (ts *TestServer) GetResponse() (int, string) {
 }
 
 func NewTestServer(ctx context.Context, t *testing.T) *TestServer {
-	serverOptions := &ServerOptions{
-		Port: 8080,
-	}
+	return NewTestServerWithOptions(ctx, t, &ServerOptions{})
+}
+
+func NewTestServerWithOptions(ctx context.Context, t *testing.T, serverOptions *ServerOptions) *TestServer {
+	serverOptions.Port = 8080
 
 	apiServer := NewServer(ctx, serverOptions)
 
@@ -80,3 +92,11 @@ func NewTestServer(ctx context.Context, t *testing.T) *TestServer {
 		t:         t,
 	}
 }
+
+func (ts *TestServer) GetResponseHeader(key string) string {
+	return ts.httpResponse.Header.Get(key)
+}
+
+func (ts *TestServer) GetResponseTrailer(key string) string {
+	return ts.httpResponse.Trailer.Get(key)
+}
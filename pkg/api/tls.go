@@ -0,0 +1,115 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+type certificateReloader struct {
+	certFile    string
+	keyFile     string
+	certificate *tls.Certificate
+	mutex       sync.RWMutex
+}
+
+func (c *certificateReloader) Reload() error {
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("Error loading certificate (%s)", err.Error())
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.certificate = &certificate
+	return nil
+}
+
+func (c *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.certificate, nil
+}
+
+func newCertificateReloader(certFile string, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CA (%s)", err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in CA %s", caFile)
+	}
+
+	return pool, nil
+}
+
+func newTLSConfig(options *ServerOptions, reloader *certificateReloader) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if options.ClientCAFile == "" {
+		return config, nil
+	}
+
+	pool, err := loadCertPool(options.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if options.RequireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// NewClientTLSConfig returns the TLS configuration of a client of the API. The
+// server certificate is verified against caFile when given, instead of the
+// system roots, and the certificate of certFile and keyFile is presented to
+// servers asking for one.
+func NewClientTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("Both a certificate and a key are needed")
+		}
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading certificate (%s)", err.Error())
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/authorizer"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCertificate(t *testing.T, commonName string, serial int64, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (c *testCertificate) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCertificate) writeFiles(t *testing.T, certFile string, keyFile string) {
+	require.NoError(t, ioutil.WriteFile(certFile, c.pem, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, c.keyPEM(t), 0600))
+}
+
+func (c *testCertificate) tlsCertificate(t *testing.T) tls.Certificate {
+	certificate, err := tls.X509KeyPair(c.pem, c.keyPEM(t))
+	require.NoError(t, err)
+	return certificate
+}
+
+type protectedResource struct {
+	ResourceBase
+}
+
+func (p *protectedResource) Register(router *httprouter.Router) {
+	router.GET("/protected/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if err := p.ValidateAuthToken(r.Context(), r); err != nil {
+			p.SetResponse(http.StatusUnauthorized, err, w)
+			return
+		}
+		p.SetResponse(http.StatusOK, map[string]string{"message": "ok"}, w)
+	})
+}
+
+type tlsTestSetup struct {
+	dir      string
+	ca       *testCertificate
+	certFile string
+	keyFile  string
+	caFile   string
+	server   *Server
+}
+
+func newTLSTestSetup(t *testing.T, mutualTLS bool, requireClientCert bool) *tlsTestSetup {
+	dir, err := ioutil.TempDir("", "weather-tls")
+	require.NoError(t, err)
+
+	setup := &tlsTestSetup{
+		dir:      dir,
+		ca:       newTestCertificate(t, "test-ca", 1, nil),
+		certFile: filepath.Join(dir, "server.crt"),
+		keyFile:  filepath.Join(dir, "server.key"),
+		caFile:   filepath.Join(dir, "ca.crt"),
+	}
+	newTestCertificate(t, "localhost", 2, setup.ca).writeFiles(t, setup.certFile, setup.keyFile)
+	require.NoError(t, ioutil.WriteFile(setup.caFile, setup.ca.pem, 0600))
+
+	options := &ServerOptions{
+		CertFile:          setup.certFile,
+		KeyFile:           setup.keyFile,
+		RequireClientCert: requireClientCert,
+	}
+	if mutualTLS {
+		options.ClientCAFile = setup.caFile
+	}
+
+	ctx := authorizer.NewContext(context.Background(), authorizer.NewAuthMock())
+	setup.server = NewServer(ctx, options).RegisterResource(&protectedResource{})
+	setup.server.httpServer.Addr = "127.0.0.1:0"
+	setup.server.Start()
+	require.NotNil(t, setup.server.Addr())
+
+	return setup
+}
+
+func (s *tlsTestSetup) Close() {
+	s.server.Close()
+	os.RemoveAll(s.dir)
+}
+
+func (s *tlsTestSetup) client(clientCerts ...tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.ca.cert)
+
+	tlsConfig := &tls.Config{RootCAs: pool}
+	if len(clientCerts) > 0 {
+		// Always present the certificate, even when it is not signed by one of
+		// the CAs the server advertises.
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &clientCerts[0], nil
+		}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
+
+func (s *tlsTestSetup) url() string {
+	return "https://" + s.server.Addr().String() + "/protected/"
+}
+
+func TestServerTLS_WithToken_ReturnOK(t *testing.T) {
+	setup := newTLSTestSetup(t, false, false)
+	defer setup.Close()
+
+	request, err := http.NewRequest("GET", setup.url(), nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "M0CK3D_T0K3N")
+
+	response, err := setup.client().Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotNil(t, response.TLS)
+}
+
+func TestServerTLS_WithClientCertificate_ReturnOK(t *testing.T) {
+	setup := newTLSTestSetup(t, true, false)
+	defer setup.Close()
+
+	clientCert := newTestCertificate(t, "kirang", 3, setup.ca).tlsCertificate(t)
+	response, err := setup.client(clientCert).Get(setup.url())
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestServerTLS_WithUnknownClientIdentity_ReturnUnauthorized(t *testing.T) {
+	setup := newTLSTestSetup(t, true, false)
+	defer setup.Close()
+
+	clientCert := newTestCertificate(t, "felipe", 3, setup.ca).tlsCertificate(t)
+	response, err := setup.client(clientCert).Get(setup.url())
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	assert.Equal(t, "{\"type\":\"/problems/missing_token\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"Empty Token\",\"code\":\"missing_token\",\"error\":\"Empty Token\"}", string(body))
+}
+
+func TestServerTLS_WithUntrustedClientCertificate_ReturnError(t *testing.T) {
+	setup := newTLSTestSetup(t, true, false)
+	defer setup.Close()
+
+	otherCA := newTestCertificate(t, "other-ca", 10, nil)
+	clientCert := newTestCertificate(t, "kirang", 11, otherCA).tlsCertificate(t)
+	response, err := setup.client(clientCert).Get(setup.url())
+	if err == nil {
+		response.Body.Close()
+	}
+	assert.Error(t, err)
+}
+
+func TestServerTLS_RequireClientCert_WithoutCertificate_ReturnError(t *testing.T) {
+	setup := newTLSTestSetup(t, true, true)
+	defer setup.Close()
+
+	request, err := http.NewRequest("GET", setup.url(), nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "M0CK3D_T0K3N")
+
+	response, err := setup.client().Do(request)
+	if err == nil {
+		response.Body.Close()
+	}
+	assert.Error(t, err)
+}
+
+func TestServerTLS_ReloadCertificates_ServeNewCertificate(t *testing.T) {
+	setup := newTLSTestSetup(t, false, false)
+	defer setup.Close()
+
+	response, err := setup.client().Get(setup.url())
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, int64(2), response.TLS.PeerCertificates[0].SerialNumber.Int64())
+
+	newTestCertificate(t, "localhost", 42, setup.ca).writeFiles(t, setup.certFile, setup.keyFile)
+	require.NoError(t, setup.server.ReloadCertificates())
+
+	response, err = setup.client().Get(setup.url())
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, int64(42), response.TLS.PeerCertificates[0].SerialNumber.Int64())
+}
+
+func TestServerTLS_WithMissingCertificate_DoNotListen(t *testing.T) {
+	server := NewServer(context.Background(), &ServerOptions{
+		CertFile: "missing.crt",
+		KeyFile:  "missing.key",
+	})
+	server.Start()
+	defer server.Close()
+
+	assert.Nil(t, server.Addr())
+}
+
+func TestClientTLSConfig_WithCAAndClientCertificate_ReturnOK(t *testing.T) {
+	setup := newTLSTestSetup(t, true, true)
+	defer setup.Close()
+
+	clientCertFile := filepath.Join(setup.dir, "client.crt")
+	clientKeyFile := filepath.Join(setup.dir, "client.key")
+	newTestCertificate(t, "kirang", 3, setup.ca).writeFiles(t, clientCertFile, clientKeyFile)
+
+	tlsConfig, err := NewClientTLSConfig(setup.caFile, clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	response, err := client.Get(setup.url())
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestClientTLSConfig_WithCertificateWithoutKey_ReturnError(t *testing.T) {
+	_, err := NewClientTLSConfig("", "client.crt", "")
+	assert.Error(t, err)
+}
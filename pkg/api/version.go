@@ -0,0 +1,118 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/julienschmidt/httprouter"
+)
+
+const APIVersionHeader = "API-Version"
+
+var vendorMediaType = regexp.MustCompile(`^application/vnd\.weather\.(v[0-9]+)\+json$`)
+
+type VersionOptions struct {
+	Deprecated bool
+	Sunset     time.Time
+}
+
+type versionGroup struct {
+	name    string
+	options VersionOptions
+	router  *httprouter.Router
+}
+
+func (g *versionGroup) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(APIVersionHeader, g.name)
+	w.Header().Add("Vary", "Accept")
+	if g.options.Deprecated {
+		w.Header().Set("Deprecation", "true")
+	}
+	if !g.options.Sunset.IsZero() {
+		w.Header().Set("Sunset", g.options.Sunset.UTC().Format(http.TimeFormat))
+	}
+
+	g.router.ServeHTTP(w, r)
+}
+
+func (s *Server) RegisterVersion(name string, options VersionOptions) *Server {
+	s.versions[name] = &versionGroup{
+		name:    name,
+		options: options,
+		router:  httprouter.New(),
+	}
+	return s
+}
+
+func (s *Server) RegisterVersionedResource(version string, resource Resource) *Server {
+	group, ok := s.versions[version]
+	if !ok {
+		s.RegisterVersion(version, VersionOptions{})
+		group = s.versions[version]
+	}
+
+	resource.Register(group.router)
+	return s
+}
+
+// requestedVersion reads the version asked for in the Accept header, either
+// as a vendor media type (application/vnd.weather.v2+json) or as a version
+// parameter (application/json; version=2).
+func requestedVersion(r *http.Request) string {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		if match := vendorMediaType.FindStringSubmatch(mediaType); match != nil {
+			return match[1]
+		}
+
+		if version := params["version"]; version != "" {
+			if !strings.HasPrefix(version, "v") {
+				version = "v" + version
+			}
+			return version
+		}
+	}
+
+	return ""
+}
+
+func (s *Server) versionHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		segments := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		if group, ok := s.versions[segments[0]]; ok {
+			path := "/"
+			if len(segments) > 1 {
+				path += segments[1]
+			}
+
+			versioned := r.Clone(r.Context())
+			versioned.URL.Path = path
+			versioned.URL.RawPath = ""
+			group.ServeHTTP(w, versioned)
+			return
+		}
+
+		version := requestedVersion(r)
+		if version == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		group, ok := s.versions[version]
+		if !ok {
+			e := internalerror.New(internalerror.CodeUnsupportedAPIVersion, "Unsupported API version "+version)
+			(&ResourceBase{}).SetResponse(http.StatusNotAcceptable, e, w)
+			return
+		}
+
+		group.ServeHTTP(w, r)
+	})
+}
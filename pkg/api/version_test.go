@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+type versionedResource struct {
+	ResourceBase
+	message string
+}
+
+func (v *versionedResource) Register(router *httprouter.Router) {
+	router.GET("/greeting/:name", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		v.SetResponse(http.StatusOK, map[string]string{"message": v.message + " " + ps.ByName("name")}, w)
+	})
+}
+
+func newVersionedTestServer(t *testing.T) *TestServer {
+	return NewTestServer(context.Background(), t).
+		RegisterResource(&versionedResource{message: "hello"}).
+		RegisterVersion("v1", VersionOptions{
+			Deprecated: true,
+			Sunset:     time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+		}).
+		RegisterVersionedResource("v1", &versionedResource{message: "hello"}).
+		RegisterVersionedResource("v2", &versionedResource{message: "hi"})
+}
+
+func TestVersion_WithPathPrefix_RouteToVersion(t *testing.T) {
+	testServer := newVersionedTestServer(t)
+
+	testServer.Test("GET", "/v2/greeting/kirang").Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"message\":\"hi kirang\"}", responseBody)
+	assert.Equal(t, "v2", testServer.GetResponseHeader(APIVersionHeader))
+	assert.Empty(t, testServer.GetResponseHeader("Deprecation"))
+}
+
+func TestVersion_WithDeprecatedVersion_ReturnDeprecationHeaders(t *testing.T) {
+	testServer := newVersionedTestServer(t)
+
+	testServer.Test("GET", "/v1/greeting/kirang").Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"message\":\"hello kirang\"}", responseBody)
+	assert.Equal(t, "true", testServer.GetResponseHeader("Deprecation"))
+	assert.Equal(t, "Fri, 01 Jan 2021 00:00:00 GMT", testServer.GetResponseHeader("Sunset"))
+}
+
+func TestVersion_WithVendorAcceptHeader_RouteToVersion(t *testing.T) {
+	testServer := newVersionedTestServer(t)
+
+	testServer.Test("GET", "/greeting/kirang").
+		WithHeader("Accept", "application/vnd.weather.v2+json").
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"message\":\"hi kirang\"}", responseBody)
+}
+
+func TestVersion_WithVersionParameter_RouteToVersion(t *testing.T) {
+	testServer := newVersionedTestServer(t)
+
+	testServer.Test("GET", "/greeting/kirang").
+		WithHeader("Accept", "application/json; version=2").
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"message\":\"hi kirang\"}", responseBody)
+}
+
+func TestVersion_WithoutVersion_RouteToUnversioned(t *testing.T) {
+	testServer := newVersionedTestServer(t)
+
+	testServer.Test("GET", "/greeting/kirang").Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "{\"message\":\"hello kirang\"}", responseBody)
+	assert.Empty(t, testServer.GetResponseHeader(APIVersionHeader))
+}
+
+func TestVersion_WithUnknownVersion_ReturnNotAcceptable(t *testing.T) {
+	testServer := newVersionedTestServer(t)
+
+	testServer.Test("GET", "/greeting/kirang").
+		WithHeader("Accept", "application/vnd.weather.v9+json").
+		Now()
+	statusCode, responseBody := testServer.GetResponse()
+
+	assert.Equal(t, http.StatusNotAcceptable, statusCode)
+	assert.Equal(t, "{\"type\":\"/problems/unsupported_api_version\",\"title\":\"Not Acceptable\",\"status\":406,\"detail\":\"Unsupported API version v9\",\"code\":\"unsupported_api_version\",\"error\":\"Unsupported API version v9\"}", responseBody)
+}
@@ -8,16 +8,22 @@ import (
 )
 
 type Authorizer interface {
-	GenerateAccessToken() string
+	GenerateAccessToken(string) string
 	ValidateToken(string) bool
+	ValidateIdentity(string) bool
+	TokenIdentity(string) string
 }
 
 type MainAuth struct {
-	validToken string
+	validToken    string
+	tokenIdentity string
+	identities    map[string]bool
 }
 
-func (auth *MainAuth) GenerateAccessToken() string {
+// GenerateAccessToken issues a token to identity, replacing the previous one.
+func (auth *MainAuth) GenerateAccessToken(identity string) string {
 	auth.validToken = auth.createHash(time.Now().String())
+	auth.tokenIdentity = identity
 	return auth.validToken
 }
 
@@ -29,6 +35,28 @@ func (auth *MainAuth) ValidateToken(token string) bool {
 	return token == auth.validToken
 }
 
+// TokenIdentity returns the identity a valid token was issued to.
+func (auth *MainAuth) TokenIdentity(token string) string {
+	if !auth.ValidateToken(token) {
+		return ""
+	}
+
+	return auth.tokenIdentity
+}
+
+func (auth *MainAuth) ValidateIdentity(identity string) bool {
+	if identity == "" {
+		return false
+	}
+
+	return auth.identities[identity]
+}
+
+func (auth *MainAuth) AllowIdentity(identity string) *MainAuth {
+	auth.identities[identity] = true
+	return auth
+}
+
 func (auth *MainAuth) createHash(s string) string {
 	h := sha1.New()
 	h.Write([]byte(s))
@@ -36,7 +64,9 @@ func (auth *MainAuth) createHash(s string) string {
 }
 
 func NewAuth() *MainAuth {
-	return &MainAuth{}
+	return &MainAuth{
+		identities: map[string]bool{},
+	}
 }
 
 type contextKey struct{}
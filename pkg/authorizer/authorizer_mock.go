@@ -4,7 +4,7 @@ type AuthMock struct {
 	validToken string
 }
 
-func (auth *AuthMock) GenerateAccessToken() string {
+func (auth *AuthMock) GenerateAccessToken(identity string) string {
 	return "M0CK3D_T0K3N"
 }
 
@@ -15,3 +15,14 @@ func NewAuthMock() *AuthMock {
 func (auth *AuthMock) ValidateToken(token string) bool {
 	return token == "M0CK3D_T0K3N"
 }
+
+func (auth *AuthMock) ValidateIdentity(identity string) bool {
+	return identity == "kirang"
+}
+
+func (auth *AuthMock) TokenIdentity(token string) string {
+	if !auth.ValidateToken(token) {
+		return ""
+	}
+	return "kirang"
+}
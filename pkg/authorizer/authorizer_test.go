@@ -8,13 +8,32 @@ import (
 
 func TestGenerateAccessToken_ReturnToken(t *testing.T) {
 	a := NewAuth()
-	token := a.GenerateAccessToken()
+	token := a.GenerateAccessToken("kirang")
 	assert.NotEmpty(t, token)
 }
 
 func TestGenerateAccessToken_CalledTwice_ReturnDifferentTokens(t *testing.T) {
 	a := NewAuth()
-	token1 := a.GenerateAccessToken()
-	token2 := a.GenerateAccessToken()
+	token1 := a.GenerateAccessToken("kirang")
+	token2 := a.GenerateAccessToken("kirang")
 	assert.NotEqual(t, token1, token2)
 }
+
+func TestTokenIdentity_ReturnIdentityOfValidToken(t *testing.T) {
+	a := NewAuth()
+	token := a.GenerateAccessToken("kirang")
+	assert.Equal(t, "kirang", a.TokenIdentity(token))
+	assert.Equal(t, "", a.TokenIdentity("unknown"))
+	assert.Equal(t, "", a.TokenIdentity(""))
+}
+
+func TestValidateIdentity_WithAllowedIdentity_ReturnTrue(t *testing.T) {
+	a := NewAuth().AllowIdentity("kirang")
+	assert.True(t, a.ValidateIdentity("kirang"))
+}
+
+func TestValidateIdentity_WithUnknownIdentity_ReturnFalse(t *testing.T) {
+	a := NewAuth().AllowIdentity("kirang")
+	assert.False(t, a.ValidateIdentity("felipe"))
+	assert.False(t, a.ValidateIdentity(""))
+}
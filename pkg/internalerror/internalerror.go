@@ -1,15 +1,143 @@
 package internalerror
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+type Code string
+
+const (
+	CodeInternal              Code = "internal_error"
+	CodeMissingToken          Code = "missing_token"
+	CodeInvalidToken          Code = "invalid_token"
+	CodeInvalidCredentials    Code = "invalid_credentials"
+	CodeInvalidRequestBody    Code = "invalid_request_body"
+	CodeRequestBodyTooLarge   Code = "request_body_too_large"
+	CodeUnsupportedMediaType  Code = "unsupported_media_type"
+	CodeNotAcceptable         Code = "not_acceptable"
+	CodeUnsupportedAPIVersion Code = "unsupported_api_version"
+	CodeInvalidParameter      Code = "invalid_parameter"
+	CodeInvalidRequest        Code = "invalid_request"
+	CodeNotFound              Code = "not_found"
+	CodeImportFailed          Code = "import_failed"
+	CodeValidationFailed      Code = "validation_failed"
+	CodeConflict              Code = "conflict"
+	CodeStorageUnavailable    Code = "storage_unavailable"
+)
+
+var statuses = map[Code]int{
+	CodeInternal:              http.StatusInternalServerError,
+	CodeMissingToken:          http.StatusUnauthorized,
+	CodeInvalidToken:          http.StatusUnauthorized,
+	CodeInvalidCredentials:    http.StatusBadRequest,
+	CodeInvalidRequestBody:    http.StatusBadRequest,
+	CodeRequestBodyTooLarge:   http.StatusRequestEntityTooLarge,
+	CodeUnsupportedMediaType:  http.StatusUnsupportedMediaType,
+	CodeNotAcceptable:         http.StatusNotAcceptable,
+	CodeUnsupportedAPIVersion: http.StatusNotAcceptable,
+	CodeInvalidParameter:      http.StatusBadRequest,
+	CodeInvalidRequest:        http.StatusBadRequest,
+	CodeNotFound:              http.StatusNotFound,
+	CodeImportFailed:          http.StatusBadRequest,
+	CodeValidationFailed:      http.StatusUnprocessableEntity,
+	CodeConflict:              http.StatusConflict,
+	CodeStorageUnavailable:    http.StatusServiceUnavailable,
+}
+
+func (c Code) Status() int {
+	status, ok := statuses[c]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+// FieldError points at the member of the request body (Pointer), the
+// parameter of the request (Parameter) or the row of an imported file (Row) a
+// problem was found in.
+type FieldError struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Row       int    `json:"row,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// InternalError is rendered as an RFC 7807 problem. The legacy "error" member
+// carries the same text as "detail" for clients written against the old
+// {"error": "..."} responses.
 type InternalError struct {
-	ErrorMessage string `json:"error"`
+	Code         Code
+	Status       int
+	ErrorMessage string
+	Instance     string
+	RequestID    string
+	Errors       []FieldError
+}
+
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	Error     string       `json:"error"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
 }
 
 func (i InternalError) Error() string {
 	return i.ErrorMessage
 }
 
-func New(message string) InternalError {
+func (i InternalError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(problem{
+		Type:      "/problems/" + string(i.Code),
+		Title:     http.StatusText(i.Status),
+		Status:    i.Status,
+		Detail:    i.ErrorMessage,
+		Instance:  i.Instance,
+		Code:      i.Code,
+		Error:     i.ErrorMessage,
+		RequestID: i.RequestID,
+		Errors:    i.Errors,
+	})
+}
+
+func (i InternalError) WithFieldErrors(errors ...FieldError) InternalError {
+	i.Errors = append(append([]FieldError{}, i.Errors...), errors...)
+	return i
+}
+
+func New(code Code, message string) InternalError {
 	return InternalError{
+		Code:         code,
+		Status:       code.Status(),
 		ErrorMessage: message,
 	}
 }
+
+// Wrap prefixes the message of err, keeping its code and field errors when it
+// already is an InternalError. Any other error is wrapped as fallbackCode.
+func Wrap(err error, fallbackCode Code, message string) InternalError {
+	wrapped, ok := err.(InternalError)
+	if !ok {
+		wrapped = New(fallbackCode, err.Error())
+	}
+
+	wrapped.ErrorMessage = fmt.Sprintf("%s (%s)", message, wrapped.ErrorMessage)
+	return wrapped
+}
+
+// From returns err as an InternalError, using code when it is a plain error.
+func From(err error, code Code) InternalError {
+	converted, ok := err.(InternalError)
+	if !ok {
+		return New(code, err.Error())
+	}
+	return converted
+}
@@ -0,0 +1,47 @@
+package internalerror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_ReturnStatusOfCode(t *testing.T) {
+	e := New(CodeNotFound, "City not found")
+
+	assert.Equal(t, http.StatusNotFound, e.Status)
+	assert.Equal(t, "City not found", e.Error())
+}
+
+func TestMarshalJSON_ReturnProblem(t *testing.T) {
+	e := New(CodeInvalidRequestBody, "Invalid request body").
+		WithFieldErrors(FieldError{Pointer: "/city", Detail: "Expected string, got number"})
+	e.Instance = "/weather/"
+
+	b, err := json.Marshal(e)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"type\":\"/problems/invalid_request_body\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"Invalid request body\",\"instance\":\"/weather/\",\"code\":\"invalid_request_body\",\"error\":\"Invalid request body\",\"errors\":[{\"pointer\":\"/city\",\"detail\":\"Expected string, got number\"}]}", string(b))
+}
+
+func TestWrap_WithInternalError_KeepCode(t *testing.T) {
+	e := Wrap(New(CodeMissingToken, "Empty Token"), CodeInvalidToken, "Error validating auth token")
+
+	assert.Equal(t, CodeMissingToken, e.Code)
+	assert.Equal(t, http.StatusUnauthorized, e.Status)
+	assert.Equal(t, "Error validating auth token (Empty Token)", e.Error())
+}
+
+func TestWrap_WithPlainError_UseFallbackCode(t *testing.T) {
+	e := Wrap(fmt.Errorf("Invalid date range"), CodeInvalidRequest, "Error saving weather")
+
+	assert.Equal(t, CodeInvalidRequest, e.Code)
+	assert.Equal(t, "Error saving weather (Invalid date range)", e.Error())
+}
+
+func TestCodeStatus_WithUnknownCode_ReturnInternalServerError(t *testing.T) {
+	assert.Equal(t, http.StatusInternalServerError, Code("unknown").Status())
+}
@@ -0,0 +1,197 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+)
+
+const (
+	dateLayout = "2006-01-02"
+
+	MaxCityLength = 100
+
+	// Temperatures (in Celsius) beyond the recorded extremes, with some margin,
+	// are rejected as physically impossible.
+	MinTemperature = -100
+	MaxTemperature = 70
+
+	// Elevations (in meters) from below the Dead Sea shore up to above the
+	// Himalayan summits.
+	MinElevation = -500
+	MaxElevation = 9000
+)
+
+// now is replaced in tests to pin the current date.
+var now = time.Now
+
+// Location tells where a violation was found: a member of the request body
+// (as a JSON pointer) or a path or query parameter.
+type Location struct {
+	pointer   string
+	parameter string
+}
+
+// Pointer builds the JSON pointer of a body member from its path segments,
+// e.g. Pointer("weather", 0, "date") is /weather/0/date.
+func Pointer(segments ...interface{}) Location {
+	pointer := ""
+	for _, segment := range segments {
+		s := fmt.Sprint(segment)
+		s = strings.Replace(s, "~", "~0", -1)
+		s = strings.Replace(s, "/", "~1", -1)
+		pointer += "/" + s
+	}
+	return Location{pointer: pointer}
+}
+
+func Parameter(name string) Location {
+	return Location{parameter: name}
+}
+
+func CheckCity(city string) error {
+	if strings.TrimSpace(city) == "" {
+		return fmt.Errorf("Empty city")
+	}
+	if utf8.RuneCountInString(city) > MaxCityLength {
+		return fmt.Errorf("City exceeds %d characters", MaxCityLength)
+	}
+	return nil
+}
+
+// CheckCountry accepts ISO 3166-1 alpha-2 country codes, e.g. US.
+func CheckCountry(country string) error {
+	if len(country) != 2 || strings.IndexFunc(country, func(r rune) bool {
+		return !unicode.IsLetter(r) || r > unicode.MaxASCII
+	}) >= 0 {
+		return fmt.Errorf("Invalid country %s, expected an ISO 3166-1 alpha-2 code", country)
+	}
+	return nil
+}
+
+// CheckDate accepts dates up to one day ahead of the current UTC date, so
+// observations from time zones ahead of UTC are not mistaken for future ones.
+func CheckDate(date string) error {
+	parsed, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return fmt.Errorf("Invalid date %s", date)
+	}
+
+	today := now().UTC().Truncate(24 * time.Hour)
+	if parsed.After(today.AddDate(0, 0, 1)) {
+		return fmt.Errorf("Date %s is in the future", date)
+	}
+	return nil
+}
+
+func CheckTemperature(temperature int) error {
+	if temperature < MinTemperature || temperature > MaxTemperature {
+		return fmt.Errorf("Temperature %d is out of range [%d, %d]", temperature, MinTemperature, MaxTemperature)
+	}
+	return nil
+}
+
+func CheckLatitude(latitude float64) error {
+	if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return fmt.Errorf("Latitude %g is out of range [-90, 90]", latitude)
+	}
+	return nil
+}
+
+func CheckLongitude(longitude float64) error {
+	if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return fmt.Errorf("Longitude %g is out of range [-180, 180]", longitude)
+	}
+	return nil
+}
+
+func CheckElevation(elevation float64) error {
+	if math.IsNaN(elevation) || elevation < MinElevation || elevation > MaxElevation {
+		return fmt.Errorf("Elevation %g is out of range [%d, %d]", elevation, MinElevation, MaxElevation)
+	}
+	return nil
+}
+
+// Validator collects every violation found in a request, so they can be
+// reported together instead of one at a time.
+type Validator struct {
+	errors []internalerror.FieldError
+}
+
+func New() *Validator {
+	return &Validator{}
+}
+
+func (v *Validator) Add(location Location, format string, args ...interface{}) {
+	v.errors = append(v.errors, internalerror.FieldError{
+		Pointer:   location.pointer,
+		Parameter: location.parameter,
+		Detail:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *Validator) check(location Location, err error) bool {
+	if err != nil {
+		v.Add(location, "%s", err.Error())
+		return false
+	}
+	return true
+}
+
+func (v *Validator) Required(location Location, present bool, name string) bool {
+	if !present {
+		v.Add(location, "Empty %s", name)
+	}
+	return present
+}
+
+func (v *Validator) City(location Location, city string) bool {
+	return v.check(location, CheckCity(city))
+}
+
+func (v *Validator) Country(location Location, country string) bool {
+	return v.check(location, CheckCountry(country))
+}
+
+func (v *Validator) Date(location Location, date string) bool {
+	return v.check(location, CheckDate(date))
+}
+
+func (v *Validator) Temperature(location Location, temperature int) bool {
+	return v.check(location, CheckTemperature(temperature))
+}
+
+func (v *Validator) Latitude(location Location, latitude float64) bool {
+	return v.check(location, CheckLatitude(latitude))
+}
+
+func (v *Validator) Longitude(location Location, longitude float64) bool {
+	return v.check(location, CheckLongitude(longitude))
+}
+
+func (v *Validator) Elevation(location Location, elevation float64) bool {
+	return v.check(location, CheckElevation(elevation))
+}
+
+func (v *Validator) Valid() bool {
+	return len(v.errors) == 0
+}
+
+// Err returns nil when no violation was found, otherwise a validation_failed
+// error listing all of them.
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+
+	message := v.errors[0].Detail
+	if len(v.errors) > 1 {
+		message = fmt.Sprintf("%s (and %d more errors)", message, len(v.errors)-1)
+	}
+	return internalerror.New(internalerror.CodeValidationFailed, message).WithFieldErrors(v.errors...)
+}
@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/internalerror"
+	"github.com/stretchr/testify/assert"
+)
+
+func pinNow(t *testing.T, date string) {
+	pinned, _ := time.Parse(dateLayout, date)
+	now = func() time.Time { return pinned.Add(15 * time.Hour) }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func TestPointer_EscapeSegments(t *testing.T) {
+	assert.Equal(t, Location{pointer: "/weather/0/date"}, Pointer("weather", 0, "date"))
+	assert.Equal(t, Location{pointer: "/a~1b/c~0d"}, Pointer("a/b", "c~d"))
+}
+
+func TestCheckDate(t *testing.T) {
+	pinNow(t, "2020-04-20")
+
+	assert.Nil(t, CheckDate("2020-04-20"))
+	assert.Nil(t, CheckDate("2020-04-21"))
+	assert.EqualError(t, CheckDate("2020-04-22"), "Date 2020-04-22 is in the future")
+	assert.EqualError(t, CheckDate("2020-02-31"), "Invalid date 2020-02-31")
+}
+
+func TestCheckCity(t *testing.T) {
+	assert.Nil(t, CheckCity("vancouver"))
+	assert.EqualError(t, CheckCity("  "), "Empty city")
+	assert.EqualError(t, CheckCity(strings.Repeat("a", MaxCityLength+1)), "City exceeds 100 characters")
+}
+
+func TestCheckTemperature(t *testing.T) {
+	assert.Nil(t, CheckTemperature(MinTemperature))
+	assert.Nil(t, CheckTemperature(MaxTemperature))
+	assert.EqualError(t, CheckTemperature(500), "Temperature 500 is out of range [-100, 70]")
+}
+
+func TestValidator_WithoutViolations_ReturnNil(t *testing.T) {
+	v := New()
+	v.City(Pointer("city"), "vancouver")
+	v.Temperature(Pointer("temperature"), 15)
+
+	assert.True(t, v.Valid())
+	assert.Nil(t, v.Err())
+}
+
+func TestValidator_CollectAllViolations(t *testing.T) {
+	v := New()
+	v.City(Parameter("city"), "")
+	v.Date(Pointer("weather", 0, "date"), "2020-02-31")
+	v.Required(Pointer("weather", 0, "temperature"), false, "temperature")
+
+	err := v.Err().(internalerror.InternalError)
+
+	assert.Equal(t, internalerror.CodeValidationFailed, err.Code)
+	assert.Equal(t, "Empty city (and 2 more errors)", err.Error())
+	assert.Equal(t, []internalerror.FieldError{
+		{Parameter: "city", Detail: "Empty city"},
+		{Pointer: "/weather/0/date", Detail: "Invalid date 2020-02-31"},
+		{Pointer: "/weather/0/temperature", Detail: "Empty temperature"},
+	}, err.Errors)
+}
+
+func TestCheckCoordinates(t *testing.T) {
+	assert.Nil(t, CheckLatitude(-90))
+	assert.Nil(t, CheckLongitude(180))
+	assert.Nil(t, CheckElevation(MinElevation))
+	assert.EqualError(t, CheckLatitude(90.5), "Latitude 90.5 is out of range [-90, 90]")
+	assert.EqualError(t, CheckLongitude(-181), "Longitude -181 is out of range [-180, 180]")
+	assert.EqualError(t, CheckElevation(9001), "Elevation 9001 is out of range [-500, 9000]")
+}
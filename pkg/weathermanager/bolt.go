@@ -0,0 +1,672 @@
+package weathermanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of a bolt database. Observations are kept in a bucket per city, and
+// station readings in a bucket per station, keyed by date: dates sort in time
+// order, so a range of dates is read with a single cursor seek. Revisions are
+// kept in a bucket per city too, keyed by date and version.
+var (
+	boltMetaBucket         = []byte("meta")
+	boltCitiesBucket       = []byte("cities")
+	boltObservationsBucket = []byte("observations")
+	boltStationsBucket     = []byte("stations")
+	boltReadingsBucket     = []byte("readings")
+	boltDeletedBucket      = []byte("deleted")
+	boltDeletedDataBucket  = []byte("deleted_data")
+	boltRevisionsBucket    = []byte("revisions")
+
+	boltDefaultRetentionKey = []byte("default_retention")
+	boltHistorySinceKey     = []byte("history_since")
+)
+
+// boltCity is the record of a city, without the observations of the city and
+// its stations, which have buckets of their own.
+type boltCity struct {
+	City      snapshotCityModel `json:"city"`
+	Retention *retentionModel   `json:"retention,omitempty"`
+}
+
+// boltRevision is the record of a revision, whose date and version are its
+// key.
+type boltRevision struct {
+	Actor string    `json:"actor,omitempty"`
+	Time  time.Time `json:"time"`
+	Old   *int      `json:"old,omitempty"`
+	New   *int      `json:"new,omitempty"`
+}
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+// OpenBolt opens, or creates, the bbolt database at path and loads its
+// cities.
+func OpenBolt(path string, options Options) (*StoredWeatherManager, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, StorageError(err, "Error opening %s", path)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltMetaBucket, boltCitiesBucket, boltObservationsBucket, boltStationsBucket, boltReadingsBucket, boltDeletedBucket, boltDeletedDataBucket, boltRevisionsBucket} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := splitDeletedData(tx)
+		if err != nil {
+			return err
+		}
+
+		meta := tx.Bucket(boltMetaBucket)
+		if meta.Get(boltHistorySinceKey) != nil {
+			return nil
+		}
+		since, err := now().UTC().MarshalText()
+		if err != nil {
+			return err
+		}
+		return meta.Put(boltHistorySinceKey, since)
+	})
+	if err != nil {
+		db.Close()
+		return nil, StorageError(err, "Error opening %s", path)
+	}
+
+	m, err := openStored(&boltStore{db: db}, options)
+	if err != nil {
+		db.Close()
+		return nil, StorageError(err, "Error loading %s", path)
+	}
+	return m, nil
+}
+
+// splitDeletedData moves the data of the deleted cities recorded before it was
+// kept apart, in the deleted record itself, to the deleted_data bucket.
+func splitDeletedData(tx *bolt.Tx) error {
+	deleted := tx.Bucket(boltDeletedBucket)
+	data := tx.Bucket(boltDeletedDataBucket)
+	records := [][]byte{}
+	err := deleted.ForEach(func(k, v []byte) error {
+		if data.Get(k) == nil {
+			records = append(records, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, v := range records {
+		var record deletedCityModel
+		err := json.Unmarshal(v, &record)
+		if err != nil {
+			return err
+		}
+		city := record.deletedCity()
+		city.observations = len(city.city.Observations)
+		err = (&boltTx{tx: tx}).putDeleted(city)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeTemperature(temperature int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(int64(temperature)))
+	return b
+}
+
+func decodeTemperature(b []byte) int {
+	return int(int64(binary.BigEndian.Uint64(b)))
+}
+
+// revisionKey is the key of the revision of date with the given version.
+// Dates have a fixed length, so keys sort by date and then version.
+func revisionKey(date string, version uint32) []byte {
+	key := make([]byte, len(date)+4)
+	copy(key, date)
+	binary.BigEndian.PutUint32(key[len(date):], version)
+	return key
+}
+
+func readTemperatures(bucket *bolt.Bucket) map[string]int {
+	temperatures := map[string]int{}
+	if bucket == nil {
+		return temperatures
+	}
+	bucket.ForEach(func(k, v []byte) error {
+		temperatures[string(k)] = decodeTemperature(v)
+		return nil
+	})
+	return temperatures
+}
+
+// writeTemperatures puts and deletes the dates of the bucket key of parent
+// that changed.
+func writeTemperatures(parent *bolt.Bucket, key []byte, changes temperatureChanges) error {
+	if len(changes.put) == 0 && len(changes.deleted) == 0 {
+		return nil
+	}
+
+	bucket, err := parent.CreateBucketIfNotExists(key)
+	if err != nil {
+		return err
+	}
+	for _, date := range changes.deleted {
+		err := bucket.Delete([]byte(date))
+		if err != nil {
+			return err
+		}
+	}
+	for date, temperature := range changes.put {
+		err := bucket.Put([]byte(date), encodeTemperature(temperature))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteBucket(parent *bolt.Bucket, key []byte) error {
+	if parent.Bucket(key) == nil {
+		return nil
+	}
+	return parent.DeleteBucket(key)
+}
+
+// seekRange positions c on the first key within dateRange, comparing the
+// first len(dateLayout) bytes of the keys as their date, and calls fn with each
+// key and value in the range until it returns false.
+func seekRange(c *bolt.Cursor, dateRange DateRange, fn func(k, v []byte) bool) {
+	k, v := c.First()
+	if dateRange.From != "" {
+		k, v = c.Seek([]byte(dateRange.From))
+	}
+	for ; k != nil; k, v = c.Next() {
+		date := string(k[:len(dateLayout)])
+		if date == dateRange.From && !dateRange.FromInclusive {
+			continue
+		}
+		if dateRange.To != "" && (date > dateRange.To || (date == dateRange.To && !dateRange.ToInclusive)) {
+			return
+		}
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+func readCity(v []byte) (boltCity, error) {
+	var record boltCity
+	err := json.Unmarshal(v, &record)
+	return record, err
+}
+
+func (s *boltStore) load() ([]storedCity, []storedDeletedCity, *RetentionPolicy, error) {
+	cities := []storedCity{}
+	deleted := []storedDeletedCity{}
+	var retention *RetentionPolicy
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltMetaBucket).Get(boltDefaultRetentionKey); v != nil {
+			var policy retentionModel
+			err := json.Unmarshal(v, &policy)
+			if err != nil {
+				return err
+			}
+			retention = policy.policy()
+		}
+
+		err := tx.Bucket(boltCitiesBucket).ForEach(func(k, v []byte) error {
+			record, err := readCity(v)
+			if err != nil {
+				return err
+			}
+			record.City.Aggregates = nil
+			cities = append(cities, storedCity{city: fromSnapshotCityModel(record.City), retention: record.Retention.policy()})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltDeletedBucket).ForEach(func(k, v []byte) error {
+			var record deletedCityModel
+			err := json.Unmarshal(v, &record)
+			if err != nil {
+				return err
+			}
+			deleted = append(deleted, record.deletedCity())
+			return nil
+		})
+	})
+	return cities, deleted, retention, err
+}
+
+func (s *boltStore) historySince() (time.Time, error) {
+	var since time.Time
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return since.UnmarshalText(tx.Bucket(boltMetaBucket).Get(boltHistorySinceKey))
+	})
+	return since, err
+}
+
+func (s *boltStore) loadCity(id string) (*storedCity, error) {
+	var city *storedCity
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltCitiesBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		record, err := readCity(v)
+		if err != nil {
+			return err
+		}
+
+		readings := tx.Bucket(boltReadingsBucket)
+		stored := fromSnapshotCityModel(record.City)
+		stored.Observations = readTemperatures(tx.Bucket(boltObservationsBucket).Bucket([]byte(id)))
+		for i := range stored.Stations {
+			stored.Stations[i].Observations = readTemperatures(readings.Bucket([]byte(stored.Stations[i].Station.ID)))
+		}
+		city = &storedCity{city: stored, retention: record.Retention.policy()}
+		return nil
+	})
+	return city, err
+}
+
+func (s *boltStore) loadDeleted(id string) (*storedDeletedCity, error) {
+	var deleted *storedDeletedCity
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltDeletedBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		var record deletedCityModel
+		err := json.Unmarshal(v, &record)
+		if err != nil {
+			return err
+		}
+
+		var data snapshotCityModel
+		err = json.Unmarshal(tx.Bucket(boltDeletedDataBucket).Get([]byte(id)), &data)
+		if err != nil {
+			return err
+		}
+		city := record.deletedCity()
+		city.city = fromSnapshotCityModel(data)
+		deleted = &city
+		return nil
+	})
+	return deleted, err
+}
+
+func (s *boltStore) stats(ids []string) (map[string]cityStats, error) {
+	stats := map[string]cityStats{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		readings := tx.Bucket(boltReadingsBucket)
+		for _, id := range ids {
+			v := tx.Bucket(boltCitiesBucket).Get([]byte(id))
+			if v == nil {
+				continue
+			}
+			record, err := readCity(v)
+			if err != nil {
+				return err
+			}
+
+			city := cityStats{}
+			if bucket := tx.Bucket(boltObservationsBucket).Bucket([]byte(id)); bucket != nil {
+				city.observations = bucket.Stats().KeyN
+				c := bucket.Cursor()
+				if k, _ := c.First(); k != nil {
+					city.firstDate = string(k)
+				}
+				if k, v := c.Last(); k != nil {
+					city.lastDate, city.lastTemperature = string(k), decodeTemperature(v)
+				}
+			}
+			for _, station := range record.City.Stations {
+				bucket := readings.Bucket([]byte(station.ID))
+				if bucket == nil {
+					continue
+				}
+				if k, _ := bucket.Cursor().First(); k != nil && (city.firstReading == "" || string(k) < city.firstReading) {
+					city.firstReading = string(k)
+				}
+			}
+			for _, aggregate := range record.City.Aggregates {
+				if city.firstAggregate == "" || aggregate.Month < city.firstAggregate {
+					city.firstAggregate = aggregate.Month
+				}
+			}
+			stats[id] = city
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// scanBucket reads at most limit dates of the bucket key of parent within
+// dateRange.
+func (s *boltStore) scanBucket(parent []byte, key string, dateRange DateRange, limit int) ([]string, []int, error) {
+	dates := []string{}
+	temperatures := []int{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(parent).Bucket([]byte(key))
+		if bucket == nil || limit <= 0 {
+			return nil
+		}
+
+		seekRange(bucket.Cursor(), dateRange, func(k, v []byte) bool {
+			dates = append(dates, string(k))
+			temperatures = append(temperatures, decodeTemperature(v))
+			return len(dates) < limit
+		})
+		return nil
+	})
+	return dates, temperatures, err
+}
+
+func (s *boltStore) scan(city string, dateRange DateRange, limit int) ([]string, []int, error) {
+	return s.scanBucket(boltObservationsBucket, city, dateRange, limit)
+}
+
+func (s *boltStore) scanReadings(station string, dateRange DateRange, limit int) ([]string, []int, error) {
+	return s.scanBucket(boltReadingsBucket, station, dateRange, limit)
+}
+
+func (s *boltStore) aggregates(city string) ([]Aggregate, error) {
+	aggregates := []Aggregate{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltCitiesBucket).Get([]byte(city))
+		if v == nil {
+			return nil
+		}
+		record, err := readCity(v)
+		if err != nil {
+			return err
+		}
+		aggregates = append(aggregates, fromSnapshotCityModel(record.City).Aggregates...)
+		return nil
+	})
+	sort.Slice(aggregates, func(i, j int) bool {
+		return aggregates[i].Month < aggregates[j].Month
+	})
+	return aggregates, err
+}
+
+func (s *boltStore) revisions(city string, dateRange DateRange) (map[string][]Revision, error) {
+	history := map[string][]Revision{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRevisionsBucket).Bucket([]byte(city))
+		if bucket == nil {
+			return nil
+		}
+
+		var err error
+		seekRange(bucket.Cursor(), dateRange, func(k, v []byte) bool {
+			var record boltRevision
+			err = json.Unmarshal(v, &record)
+			if err != nil {
+				return false
+			}
+			date := string(k[:len(dateLayout)])
+			history[date] = append(history[date], Revision{
+				Version: int(binary.BigEndian.Uint32(k[len(dateLayout):])),
+				Actor:   record.Actor,
+				Time:    record.Time,
+				Old:     record.Old,
+				New:     record.New,
+			})
+			return true
+		})
+		return err
+	})
+	return history, err
+}
+
+func (s *boltStore) update(fn func(storeTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (s *boltStore) saveDefaultRetention(policy RetentionPolicy) error {
+	v, err := json.Marshal(toRetentionModel(&policy))
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMetaBucket).Put(boltDefaultRetentionKey, v)
+	})
+}
+
+func (s *boltStore) close() error {
+	return s.db.Close()
+}
+
+func (t *boltTx) cityIDs() ([]string, error) {
+	ids := []string{}
+	for _, name := range [][]byte{boltCitiesBucket, boltDeletedBucket} {
+		err := t.tx.Bucket(name).ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// storedStations returns the IDs of the stations stored with city.
+func (t *boltTx) storedStations(city string) map[string]bool {
+	stations := map[string]bool{}
+	v := t.tx.Bucket(boltCitiesBucket).Get([]byte(city))
+	if v == nil {
+		return stations
+	}
+
+	if record, err := readCity(v); err == nil {
+		for _, s := range record.City.Stations {
+			stations[s.ID] = true
+		}
+	}
+	return stations
+}
+
+// deleteStations deletes the readings of the stations that still belong to
+// city.
+func (t *boltTx) deleteStations(city string, stations map[string]bool) error {
+	owners := t.tx.Bucket(boltStationsBucket)
+	for station := range stations {
+		owner := owners.Get([]byte(station))
+		if owner != nil && string(owner) != city {
+			continue
+		}
+
+		err := deleteBucket(t.tx.Bucket(boltReadingsBucket), []byte(station))
+		if err != nil {
+			return err
+		}
+		err = owners.Delete([]byte(station))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *boltTx) putCity(change cityChange) error {
+	city := change.city.city
+	key := []byte(city.City.ID)
+
+	if change.recordChanged() {
+		record := boltCity{City: toSnapshotCityModel(city), Retention: toRetentionModel(change.city.retention)}
+		record.City.Observations = nil
+		for i := range record.City.Stations {
+			record.City.Stations[i].Observations = nil
+		}
+		v, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		err = t.tx.Bucket(boltCitiesBucket).Put(key, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := writeTemperatures(t.tx.Bucket(boltObservationsBucket), key, change.observations)
+	if err != nil {
+		return err
+	}
+
+	deleted := map[string]bool{}
+	for _, station := range change.deletedStations {
+		deleted[station] = true
+	}
+	err = t.deleteStations(city.City.ID, deleted)
+	if err != nil {
+		return err
+	}
+
+	readings := t.tx.Bucket(boltReadingsBucket)
+	for station, changes := range change.readings {
+		if change.newStations[station] {
+			// Readings left by a city the station belonged to before.
+			err := deleteBucket(readings, []byte(station))
+			if err != nil {
+				return err
+			}
+			err = t.tx.Bucket(boltStationsBucket).Put([]byte(station), key)
+			if err != nil {
+				return err
+			}
+		}
+		err := writeTemperatures(readings, []byte(station), changes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *boltTx) deleteCity(id string) error {
+	err := t.deleteStations(id, t.storedStations(id))
+	if err != nil {
+		return err
+	}
+	err = t.tx.Bucket(boltCitiesBucket).Delete([]byte(id))
+	if err != nil {
+		return err
+	}
+	return deleteBucket(t.tx.Bucket(boltObservationsBucket), []byte(id))
+}
+
+func (t *boltTx) putDeleted(deleted storedDeletedCity) error {
+	v, err := json.Marshal(toDeletedCityModel(deleted))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(toSnapshotCityModel(deleted.city))
+	if err != nil {
+		return err
+	}
+
+	key := []byte(deleted.city.City.ID)
+	err = t.tx.Bucket(boltDeletedBucket).Put(key, v)
+	if err != nil {
+		return err
+	}
+	return t.tx.Bucket(boltDeletedDataBucket).Put(key, data)
+}
+
+func (t *boltTx) deleteDeleted(id string) error {
+	err := t.tx.Bucket(boltDeletedBucket).Delete([]byte(id))
+	if err != nil {
+		return err
+	}
+	return t.tx.Bucket(boltDeletedDataBucket).Delete([]byte(id))
+}
+
+func (t *boltTx) putRevisions(city string, revisions map[string][]Revision) error {
+	bucket, err := t.tx.Bucket(boltRevisionsBucket).CreateBucketIfNotExists([]byte(city))
+	if err != nil {
+		return err
+	}
+
+	for date, list := range revisions {
+		version := lastVersion(bucket, date)
+		for _, revision := range list {
+			v, err := json.Marshal(boltRevision{Actor: revision.Actor, Time: revision.Time, Old: revision.Old, New: revision.New})
+			if err != nil {
+				return err
+			}
+			version++
+			err = bucket.Put(revisionKey(date, version), v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lastVersion returns the version of the last revision of date stored in
+// bucket, 0 when there is none.
+func lastVersion(bucket *bolt.Bucket, date string) uint32 {
+	c := bucket.Cursor()
+	k, _ := c.Seek(revisionKey(date, math.MaxUint32))
+	if k == nil {
+		k, _ = c.Last()
+	} else if !bytes.Equal(k, revisionKey(date, math.MaxUint32)) {
+		k, _ = c.Prev()
+	}
+	if k == nil || string(k[:len(dateLayout)]) != date {
+		return 0
+	}
+	return binary.BigEndian.Uint32(k[len(dateLayout):])
+}
+
+func (t *boltTx) deleteHistory(city string, dates []string) error {
+	parent := t.tx.Bucket(boltRevisionsBucket)
+	if dates == nil {
+		return deleteBucket(parent, []byte(city))
+	}
+
+	bucket := parent.Bucket([]byte(city))
+	if bucket == nil {
+		return nil
+	}
+	for _, date := range dates {
+		c := bucket.Cursor()
+		for k, _ := c.Seek([]byte(date)); k != nil && string(k[:len(dateLayout)]) == date; k, _ = c.Seek([]byte(date)) {
+			err := c.Delete()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+package weathermanager
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// The size of a cached range is estimated from the observations it holds:
+// each costs its date, the string header pointing to it and its temperature,
+// and each range a fixed overhead for its key and bookkeeping.
+const (
+	cachedObservationBytes = 16 + 8
+	cachedRangeBytes       = 256
+)
+
+// CacheStats tells how a CachedWeatherManager has been doing since it was
+// created.
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+	Entries       int
+	Bytes         int64
+	MaxBytes      int64
+}
+
+// CachedWeatherManager keeps the observation ranges read from another
+// WeatherManager in a least recently used cache, bounded by an estimate of
+// the memory they take.
+//
+// Ranges are cached by city ID and by their dates, with exclusive bounds
+// turned into inclusive ones, so equivalent ranges share an entry. Writes to
+// a city drop its cached ranges, while the ranges of other cities stay. Past
+// observations, read with an as-of time, are never cached.
+type CachedWeatherManager struct {
+	WeatherManager
+	cache *weatherCache
+}
+
+// NewCached caches the ranges read from m, holding up to about maxBytes.
+func NewCached(m WeatherManager, maxBytes int64) *CachedWeatherManager {
+	return &CachedWeatherManager{
+		WeatherManager: m,
+		cache:          newWeatherCache(maxBytes),
+	}
+}
+
+// CacheStats returns the hit and miss counts and the size of the cache.
+func (c *CachedWeatherManager) CacheStats() CacheStats {
+	return c.cache.stats()
+}
+
+// WithActor binds the manager it wraps to actor, sharing the cache.
+func (c *CachedWeatherManager) WithActor(actor string) WeatherManager {
+	return &CachedWeatherManager{WeatherManager: c.WeatherManager.WithActor(actor), cache: c.cache}
+}
+
+func (c *CachedWeatherManager) GetWeather(city string, initialDate string, endDate string) (map[string]int, error) {
+	return getWeather(c, city, initialDate, endDate)
+}
+
+func (c *CachedWeatherManager) IterateWeather(city string, initialDate string, endDate string, fn func(string, int) bool) error {
+	return iterateWeather(c, city, initialDate, endDate, fn)
+}
+
+func (c *CachedWeatherManager) IterateRange(city string, dateRange DateRange, fn func(string, int) bool) error {
+	return c.IterateRangeAsOf(city, dateRange, time.Time{}, fn)
+}
+
+// IterateRangeAsOf reads the current observations of city from the cache. On
+// a miss the range is read from the manager it wraps, passing each
+// observation to fn as it is read, and only cached when fn read it whole and
+// it fits in the cache.
+func (c *CachedWeatherManager) IterateRangeAsOf(city string, dateRange DateRange, asOf time.Time, fn func(string, int) bool) error {
+	if !asOf.IsZero() {
+		return c.WeatherManager.IterateRangeAsOf(city, dateRange, asOf, fn)
+	}
+
+	key, ok := c.key(city, dateRange)
+	if !ok {
+		// Unknown cities and invalid ranges are reported by the manager.
+		return c.WeatherManager.IterateRangeAsOf(city, dateRange, asOf, fn)
+	}
+
+	if entry, ok := c.cache.get(key); ok {
+		for i, date := range entry.dates {
+			if !fn(date, entry.temperatures[i]) {
+				break
+			}
+		}
+		return nil
+	}
+
+	generation := c.cache.generation(key.city)
+	entry := &cacheEntry{key: key, dates: []string{}, temperatures: []int{}, bytes: cachedRangeBytes}
+	complete := true
+	err := c.WeatherManager.IterateRange(city, dateRange, func(date string, temperature int) bool {
+		if entry != nil {
+			entry.bytes += int64(len(date) + cachedObservationBytes)
+			if entry.bytes > c.cache.maxBytes {
+				// The range can never be cached, the rest is passed through.
+				entry = nil
+			} else {
+				entry.dates = append(entry.dates, date)
+				entry.temperatures = append(entry.temperatures, temperature)
+			}
+		}
+		if !fn(date, temperature) {
+			complete = false
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if entry != nil && complete {
+		c.cache.put(entry, generation)
+	}
+	return nil
+}
+
+// key returns the cache key of a range of city, or false when the city can
+// not be resolved or the range is invalid.
+func (c *CachedWeatherManager) key(city string, dateRange DateRange) (cacheKey, bool) {
+	if city == "" {
+		return cacheKey{}, false
+	}
+	registered, err := c.WeatherManager.ResolveCity(city)
+	if err != nil {
+		return cacheKey{}, false
+	}
+
+	bounds, err := dateRange.bounds()
+	if err != nil {
+		return cacheKey{}, false
+	}
+
+	key := cacheKey{city: registered.ID}
+	if bounds.hasFrom {
+		if !bounds.fromInclusive {
+			bounds.from = bounds.from.AddDate(0, 0, 1)
+		}
+		key.from = bounds.from.Format(dateLayout)
+	}
+	if bounds.hasTo {
+		if !bounds.toInclusive {
+			bounds.to = bounds.to.AddDate(0, 0, -1)
+		}
+		key.to = bounds.to.Format(dateLayout)
+	}
+	return key, true
+}
+
+// invalidate drops the cached ranges of the city named city.
+func (c *CachedWeatherManager) invalidate(city string) {
+	registered, err := c.WeatherManager.ResolveCity(city)
+	if err == nil {
+		c.cache.invalidate(registered.ID)
+	}
+}
+
+func (c *CachedWeatherManager) SaveWeather(city string, temperatures map[string]int) error {
+	err := c.WeatherManager.SaveWeather(city, temperatures)
+	c.invalidate(city)
+	return err
+}
+
+func (c *CachedWeatherManager) MergeWeather(city string, temperatures map[string]int) error {
+	err := c.WeatherManager.MergeWeather(city, temperatures)
+	c.invalidate(city)
+	return err
+}
+
+func (c *CachedWeatherManager) ImportWeather(weathers map[string]map[string]int) error {
+	err := c.WeatherManager.ImportWeather(weathers)
+	for city := range weathers {
+		c.invalidate(city)
+	}
+	return err
+}
+
+// DeleteWeather resolves the city before deleting it, as it can not be
+// resolved once deleted.
+func (c *CachedWeatherManager) DeleteWeather(city string) error {
+	registered, resolveErr := c.WeatherManager.ResolveCity(city)
+	err := c.WeatherManager.DeleteWeather(city)
+	if resolveErr == nil {
+		c.cache.invalidate(registered.ID)
+	}
+	return err
+}
+
+func (c *CachedWeatherManager) SaveObservation(city string, date string, temperature int) error {
+	err := c.WeatherManager.SaveObservation(city, date, temperature)
+	c.invalidate(city)
+	return err
+}
+
+func (c *CachedWeatherManager) DeleteObservation(city string, date string) error {
+	err := c.WeatherManager.DeleteObservation(city, date)
+	c.invalidate(city)
+	return err
+}
+
+func (c *CachedWeatherManager) UndeleteWeather(city string) (City, error) {
+	registered, err := c.WeatherManager.UndeleteWeather(city)
+	if err == nil {
+		c.cache.invalidate(registered.ID)
+	}
+	return registered, err
+}
+
+func (c *CachedWeatherManager) Restore(snapshot Snapshot, mode RestoreMode, dryRun bool) (RestoreDiff, error) {
+	diff, err := c.WeatherManager.Restore(snapshot, mode, dryRun)
+	if !dryRun {
+		c.cache.clear()
+	}
+	return diff, err
+}
+
+// maintainer is implemented by the managers running background jobs.
+type maintainer interface {
+	PurgeDeleted() int
+	ApplyRetention() RetentionReport
+}
+
+// PurgeDeleted purges the deleted cities of the manager it wraps, when it
+// keeps them.
+func (c *CachedWeatherManager) PurgeDeleted() int {
+	m, ok := c.WeatherManager.(maintainer)
+	if !ok {
+		return 0
+	}
+	return m.PurgeDeleted()
+}
+
+// ApplyRetention applies the retention of the manager it wraps, dropping the
+// whole cache when observations were rolled up.
+func (c *CachedWeatherManager) ApplyRetention() RetentionReport {
+	m, ok := c.WeatherManager.(maintainer)
+	if !ok {
+		return RetentionReport{}
+	}
+	report := m.ApplyRetention()
+	if report.RolledUp > 0 {
+		c.cache.clear()
+	}
+	return report
+}
+
+func (c *CachedWeatherManager) RunMaintenance(interval time.Duration) func() {
+	return runEvery(interval, func() {
+		c.PurgeDeleted()
+		c.ApplyRetention()
+	})
+}
+
+type cacheKey struct {
+	city, from, to string
+}
+
+type cacheEntry struct {
+	key          cacheKey
+	dates        []string
+	temperatures []int
+	bytes        int64
+}
+
+// weatherCache is the LRU of a CachedWeatherManager. A range read while its
+// city is written may be stale, so every invalidation bumps a generation,
+// and ranges read before it are not cached.
+type weatherCache struct {
+	maxBytes    int64
+	bytes       int64
+	lru         *list.List
+	entries     map[cacheKey]*list.Element
+	cities      map[string]map[cacheKey]bool
+	generations map[string]uint64
+	epoch       uint64
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	invalidated uint64
+	mutex       sync.Mutex
+}
+
+// cacheGeneration is the state of a city a range is read from.
+type cacheGeneration struct {
+	epoch, city uint64
+}
+
+func newWeatherCache(maxBytes int64) *weatherCache {
+	return &weatherCache{
+		maxBytes:    maxBytes,
+		lru:         list.New(),
+		entries:     map[cacheKey]*list.Element{},
+		cities:      map[string]map[cacheKey]bool{},
+		generations: map[string]uint64{},
+	}
+}
+
+func (c *weatherCache) get(key cacheKey) (*cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(element)
+	return element.Value.(*cacheEntry), true
+}
+
+func (c *weatherCache) generation(city string) cacheGeneration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return cacheGeneration{epoch: c.epoch, city: c.generations[city]}
+}
+
+// put caches entry, its bytes already counted, unless its city was written
+// since generation was taken, evicting the least recently used ranges to make
+// room.
+func (c *weatherCache) put(entry *cacheEntry, generation cacheGeneration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry.bytes > c.maxBytes || generation != (cacheGeneration{epoch: c.epoch, city: c.generations[entry.key.city]}) {
+		return
+	}
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	if c.cities[entry.key.city] == nil {
+		c.cities[entry.key.city] = map[cacheKey]bool{}
+	}
+	c.cities[entry.key.city][entry.key] = true
+	c.bytes += entry.bytes
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *weatherCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	delete(c.cities[entry.key.city], entry.key)
+	if len(c.cities[entry.key.city]) == 0 {
+		delete(c.cities, entry.key.city)
+	}
+	c.bytes -= entry.bytes
+}
+
+func (c *weatherCache) invalidate(city string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generations[city]++
+	for key := range c.cities[city] {
+		c.remove(c.entries[key])
+		c.invalidated++
+	}
+}
+
+func (c *weatherCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.epoch++
+	c.invalidated += uint64(c.lru.Len())
+	c.lru.Init()
+	c.entries = map[cacheKey]*list.Element{}
+	c.cities = map[string]map[cacheKey]bool{}
+	c.bytes = 0
+}
+
+func (c *weatherCache) stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		Invalidations: c.invalidated,
+		Entries:       c.lru.Len(),
+		Bytes:         c.bytes,
+		MaxBytes:      c.maxBytes,
+	}
+}
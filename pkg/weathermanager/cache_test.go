@@ -0,0 +1,74 @@
+package weathermanager_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readCountingManager counts the observations read from the manager it wraps.
+type readCountingManager struct {
+	weathermanager.WeatherManager
+	read *int
+}
+
+func (m readCountingManager) IterateRange(city string, dateRange weathermanager.DateRange, fn func(string, int) bool) error {
+	return m.WeatherManager.IterateRange(city, dateRange, func(date string, temperature int) bool {
+		*m.read++
+		return fn(date, temperature)
+	})
+}
+
+func newCountedCache(t *testing.T, maxBytes int64, days int) (*weathermanager.CachedWeatherManager, *int) {
+	weatherMgr := weathermanager.New()
+	temperatures := map[string]int{}
+	for day := 1; day <= days; day++ {
+		temperatures[fmt.Sprintf("2020-04-%02d", day)] = day
+	}
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", temperatures))
+
+	read := 0
+	return weathermanager.NewCached(readCountingManager{weatherMgr, &read}, maxBytes), &read
+}
+
+func TestCached_WithEarlyStop_ReadOnlyWhatIsConsumed(t *testing.T) {
+	weatherMgr, read := newCountedCache(t, 1<<20, 30)
+
+	dates := []string{}
+	err := weatherMgr.IterateRange("vancouver", weathermanager.DateRange{}, func(date string, _ int) bool {
+		dates = append(dates, date)
+		return len(dates) < 2
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2020-04-01", "2020-04-02"}, dates)
+	assert.Equal(t, 2, *read)
+	assert.Equal(t, 0, weatherMgr.CacheStats().Entries, "a partly read range is not cached")
+
+	err = weatherMgr.IterateRange("vancouver", weathermanager.DateRange{}, func(string, int) bool { return true })
+	require.NoError(t, err)
+	assert.Equal(t, 32, *read)
+	assert.Equal(t, 1, weatherMgr.CacheStats().Entries)
+}
+
+func TestCached_WithRangeOverMaxBytes_PassThrough(t *testing.T) {
+	weatherMgr, read := newCountedCache(t, 512, 30)
+
+	for i := 0; i < 2; i++ {
+		temperatures := []int{}
+		err := weatherMgr.IterateRange("vancouver", weathermanager.DateRange{}, func(_ string, temperature int) bool {
+			temperatures = append(temperatures, temperature)
+			return true
+		})
+		require.NoError(t, err)
+		assert.Len(t, temperatures, 30)
+	}
+
+	stats := weatherMgr.CacheStats()
+	assert.Equal(t, 60, *read)
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, int64(0), stats.Bytes)
+}
@@ -0,0 +1,199 @@
+package weathermanager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultCitiesLimit = 50
+	MaxCitiesLimit     = 1000
+)
+
+type CitySummary struct {
+	City         string
+	Name         string
+	Country      string
+	Region       string
+	Aliases      []string
+	Coordinates  *Coordinates
+	Observations int
+	FirstDate    string
+	LastDate     string
+}
+
+type ListCitiesOptions struct {
+	Prefix     string
+	SortBy     string
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+type CityPage struct {
+	Cities     []CitySummary
+	NextCursor string
+}
+
+type citiesCursor struct {
+	Key  string `json:"k"`
+	City string `json:"c"`
+}
+
+// SummarizeCity summarizes the observations of a registered city.
+func SummarizeCity(city City, temperatures map[string]int) CitySummary {
+	summary := CitySummary{
+		City:         city.ID,
+		Name:         city.Name,
+		Country:      city.Country,
+		Region:       city.Region,
+		Aliases:      city.Aliases,
+		Coordinates:  city.Coordinates,
+		Observations: len(temperatures),
+	}
+	for date := range temperatures {
+		if summary.FirstDate == "" || date < summary.FirstDate {
+			summary.FirstDate = date
+		}
+		if summary.LastDate == "" || date > summary.LastDate {
+			summary.LastDate = date
+		}
+	}
+	return summary
+}
+
+// cityStats sums up the data of a city for the reads and checks that do not
+// need all of it: listings, nearby cities and retention.
+type cityStats struct {
+	observations    int
+	firstDate       string
+	lastDate        string
+	lastTemperature int
+	// firstReading is the earliest reading of the stations of the city, and
+	// firstAggregate the earliest month rolled up.
+	firstReading   string
+	firstAggregate string
+}
+
+func summarizeStats(city City, stats cityStats) CitySummary {
+	return CitySummary{
+		City:         city.ID,
+		Name:         city.Name,
+		Country:      city.Country,
+		Region:       city.Region,
+		Aliases:      city.Aliases,
+		Coordinates:  city.Coordinates,
+		Observations: stats.observations,
+		FirstDate:    stats.firstDate,
+		LastDate:     stats.lastDate,
+	}
+}
+
+func citySortKey(summary CitySummary, sortBy string) string {
+	switch sortBy {
+	case "observations":
+		// Zero padded so the keys compare as strings in numeric order.
+		return fmt.Sprintf("%020d", summary.Observations)
+	case "first_date":
+		return summary.FirstDate
+	case "last_date":
+		return summary.LastDate
+	}
+	return summary.City
+}
+
+func (c citiesCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCitiesCursor(cursor string) (citiesCursor, error) {
+	var decoded citiesCursor
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return decoded, ValidationError("Invalid cursor")
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return decoded, ValidationError("Invalid cursor")
+	}
+	return decoded, nil
+}
+
+// PageCities filters, sorts and paginates city summaries. It is shared by the
+// WeatherManager implementations so that every backend pages the same way.
+func PageCities(summaries []CitySummary, options ListCitiesOptions) (CityPage, error) {
+	switch options.SortBy {
+	case "":
+		options.SortBy = "city"
+	case "city", "observations", "first_date", "last_date":
+	default:
+		return CityPage{}, ValidationError("Invalid sort field %s", options.SortBy)
+	}
+
+	limit := options.Limit
+	if limit < 0 {
+		return CityPage{}, ValidationError("Invalid limit %d", limit)
+	}
+	if limit == 0 {
+		limit = DefaultCitiesLimit
+	}
+	if limit > MaxCitiesLimit {
+		limit = MaxCitiesLimit
+	}
+
+	prefix := CityKey(options.Prefix)
+	filtered := []CitySummary{}
+	for _, summary := range summaries {
+		if strings.HasPrefix(summary.City, prefix) {
+			filtered = append(filtered, summary)
+		}
+	}
+
+	less := func(a, b CitySummary) bool {
+		keyA, keyB := citySortKey(a, options.SortBy), citySortKey(b, options.SortBy)
+		if keyA != keyB {
+			return (keyA < keyB) != options.Descending
+		}
+		return a.City < b.City
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return less(filtered[i], filtered[j])
+	})
+
+	start := 0
+	if options.Cursor != "" {
+		cursor, err := decodeCitiesCursor(options.Cursor)
+		if err != nil {
+			return CityPage{}, err
+		}
+
+		start = sort.Search(len(filtered), func(i int) bool {
+			keyI := citySortKey(filtered[i], options.SortBy)
+			if keyI != cursor.Key {
+				return (keyI < cursor.Key) == options.Descending
+			}
+			return filtered[i].City > cursor.City
+		})
+	}
+
+	end := start + limit
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+
+	page := CityPage{
+		Cities: filtered[start:end],
+	}
+	if end < len(filtered) {
+		last := filtered[end-1]
+		page.NextCursor = citiesCursor{
+			Key:  citySortKey(last, options.SortBy),
+			City: last.City,
+		}.encode()
+	}
+
+	return page, nil
+}
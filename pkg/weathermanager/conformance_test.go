@@ -0,0 +1,49 @@
+package weathermanager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager/weathermanagertest"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+func newTestDatabase(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "weather-conformance")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "weather.db")
+}
+
+func TestConformance_Memory(t *testing.T) {
+	weathermanagertest.Run(t, func(t *testing.T) weathermanager.WeatherManager {
+		return weathermanager.New()
+	})
+}
+
+func TestConformance_Bolt(t *testing.T) {
+	weathermanagertest.Run(t, func(t *testing.T) weathermanager.WeatherManager {
+		weatherMgr := openTestBolt(t, newTestDatabase(t))
+		t.Cleanup(func() { weatherMgr.Close() })
+		return weatherMgr
+	})
+}
+
+func TestConformance_SQL(t *testing.T) {
+	weathermanagertest.Run(t, func(t *testing.T) weathermanager.WeatherManager {
+		weatherMgr := openTestSQL(t, newTestDatabase(t))
+		t.Cleanup(func() { weatherMgr.Close() })
+		return weatherMgr
+	})
+}
+
+func TestConformance_Cached(t *testing.T) {
+	weathermanagertest.Run(t, func(t *testing.T) weathermanager.WeatherManager {
+		return weathermanager.NewCached(weathermanager.New(), 1<<20)
+	})
+}
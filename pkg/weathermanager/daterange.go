@@ -0,0 +1,115 @@
+package weathermanager
+
+import (
+	"sort"
+	"time"
+)
+
+// DateRange selects the observations between From and To. An empty bound
+// leaves that side of the range open, and each bound is excluded unless
+// marked inclusive.
+type DateRange struct {
+	From          string
+	To            string
+	FromInclusive bool
+	ToInclusive   bool
+}
+
+// Between is the range used by GetWeather and IterateWeather, excluding both
+// dates.
+func Between(from string, to string) DateRange {
+	return DateRange{From: from, To: to}
+}
+
+func SingleDay(date string) DateRange {
+	return DateRange{From: date, To: date, FromInclusive: true, ToInclusive: true}
+}
+
+// LastDays covers the given number of days up to and including the day of
+// now, e.g. the last 30 days.
+func LastDays(days int, now time.Time) DateRange {
+	today := now.UTC()
+	return DateRange{
+		From:          today.AddDate(0, 0, 1-days).Format(dateLayout),
+		To:            today.Format(dateLayout),
+		FromInclusive: true,
+		ToInclusive:   true,
+	}
+}
+
+type dateBounds struct {
+	from, to                   time.Time
+	hasFrom, hasTo             bool
+	fromInclusive, toInclusive bool
+}
+
+func (r DateRange) bounds() (dateBounds, error) {
+	b := dateBounds{fromInclusive: r.FromInclusive, toInclusive: r.ToInclusive}
+
+	var err error
+	if r.From != "" {
+		b.from, err = time.Parse(dateLayout, r.From)
+		if err != nil {
+			return b, ValidationError("Invalid initial date (%s)", err.Error())
+		}
+		b.hasFrom = true
+	}
+
+	if r.To != "" {
+		b.to, err = time.Parse(dateLayout, r.To)
+		if err != nil {
+			return b, ValidationError("Invalid end date (%s)", err.Error())
+		}
+		b.hasTo = true
+	}
+
+	if b.hasFrom && b.hasTo {
+		// A range starting and ending on the same day is only valid when it
+		// includes that day.
+		if b.from.After(b.to) || (b.from.Equal(b.to) && !(b.fromInclusive && b.toInclusive)) {
+			return b, ValidationError("Invalid date range")
+		}
+	}
+
+	return b, nil
+}
+
+func (b dateBounds) contains(date time.Time) bool {
+	if b.hasFrom {
+		if date.Before(b.from) || (!b.fromInclusive && date.Equal(b.from)) {
+			return false
+		}
+	}
+	if b.hasTo {
+		if date.After(b.to) || (!b.toInclusive && date.Equal(b.to)) {
+			return false
+		}
+	}
+	return true
+}
+
+// slice returns the part of dates, sorted, within the range. Dates compare
+// as strings in dateLayout.
+func (r DateRange) slice(dates []string) []string {
+	start, end := 0, len(dates)
+	if r.From != "" {
+		start = sort.Search(len(dates), func(i int) bool {
+			if r.FromInclusive {
+				return dates[i] >= r.From
+			}
+			return dates[i] > r.From
+		})
+	}
+	if r.To != "" {
+		end = sort.Search(len(dates), func(i int) bool {
+			if r.ToInclusive {
+				return dates[i] > r.To
+			}
+			return dates[i] >= r.To
+		})
+	}
+	if end < start {
+		return nil
+	}
+	return dates[start:end]
+}
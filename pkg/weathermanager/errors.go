@@ -0,0 +1,64 @@
+package weathermanager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel kinds of the errors returned by a WeatherManager. Callers match them
+// with errors.Is, the message of the returned error stays human readable.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrValidation = errors.New("validation failed")
+	ErrConflict   = errors.New("conflict")
+	ErrStorage    = errors.New("storage failure")
+)
+
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// NotFoundError reports a missing city or observation.
+func NotFoundError(format string, args ...interface{}) error {
+	return newError(ErrNotFound, format, args...)
+}
+
+// ValidationError reports input the manager refuses to store or query.
+func ValidationError(format string, args ...interface{}) error {
+	return newError(ErrValidation, format, args...)
+}
+
+// ConflictError reports a write that clashes with the stored state.
+func ConflictError(format string, args ...interface{}) error {
+	return newError(ErrConflict, format, args...)
+}
+
+// StorageError wraps a failure of the underlying storage.
+func StorageError(err error, format string, args ...interface{}) error {
+	return &Error{
+		Kind:    ErrStorage,
+		Message: fmt.Sprintf("%s (%s)", fmt.Sprintf(format, args...), err.Error()),
+		Err:     err,
+	}
+}
@@ -0,0 +1,119 @@
+package weathermanager
+
+import (
+	"sort"
+	"time"
+)
+
+// now is the clock revisions are timestamped with.
+var now = time.Now
+
+// Revision is a change of the observation of a city on a date. Old is nil when
+// the observation was created, New when it was deleted.
+type Revision struct {
+	Version int
+	Actor   string
+	Time    time.Time
+	Old     *int
+	New     *int
+}
+
+// WithActor returns a manager sharing the reports of m that records actor as
+// the author of the changes made through it.
+func (m *MainWeatherManager) WithActor(actor string) WeatherManager {
+	return &MainWeatherManager{state: m.state, actor: actor}
+}
+
+// set stores an observation, recording a revision when its value changes.
+// The report of city must exist.
+func (m *MainWeatherManager) set(city string, date string, temperature int) {
+	old, ok := m.weathers[city][date]
+	if ok && old == temperature {
+		return
+	}
+
+	revision := Revision{New: &temperature}
+	if ok {
+		revision.Old = &old
+	} else {
+		m.datesChanged(city)
+	}
+	m.weathers[city][date] = temperature
+	m.record(city, date, revision)
+}
+
+// unset deletes an observation, recording a revision when it existed.
+func (m *MainWeatherManager) unset(city string, date string) {
+	old, ok := m.weathers[city][date]
+	if !ok {
+		return
+	}
+
+	delete(m.weathers[city], date)
+	m.datesChanged(city)
+	m.record(city, date, Revision{Old: &old})
+}
+
+func (m *MainWeatherManager) record(city string, date string, revision Revision) {
+	if m.history[city] == nil {
+		m.history[city] = map[string][]Revision{}
+	}
+
+	revisions := m.history[city][date]
+	revision.Version = len(revisions) + 1
+	revision.Actor = m.actor
+	revision.Time = now().UTC()
+	m.history[city][date] = append(revisions, revision)
+}
+
+// weatherAsOf rebuilds the report of city from the revisions recorded up to
+// asOf.
+func (m *MainWeatherManager) weatherAsOf(city string, asOf time.Time) map[string]int {
+	temperatures := map[string]int{}
+	for date, revisions := range m.history[city] {
+		if temperature := valueAsOf(revisions, nil, asOf); temperature != nil {
+			temperatures[date] = *temperature
+		}
+	}
+	return temperatures
+}
+
+// valueAsOf returns the value an observation had at asOf, nil when it did not
+// exist, from its revisions, oldest first, and its current value. Before its
+// first revision, an observation had the value that revision replaced, and an
+// observation without revisions has not changed since the history started.
+func valueAsOf(revisions []Revision, current *int, asOf time.Time) *int {
+	if len(revisions) == 0 {
+		return current
+	}
+
+	i := sort.Search(len(revisions), func(i int) bool {
+		return revisions[i].Time.After(asOf)
+	})
+	if i == 0 {
+		return revisions[0].Old
+	}
+	return revisions[i-1].New
+}
+
+// ObservationHistory returns every revision of the observation of city on
+// date, oldest first.
+func (m *MainWeatherManager) ObservationHistory(city string, date string) ([]Revision, error) {
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		return nil, ValidationError("Invalid date %s (%s)", date, err.Error())
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := m.history[id][date]
+	if len(revisions) == 0 {
+		return nil, NotFoundError("Observation not found")
+	}
+	return append([]Revision{}, revisions...), nil
+}
@@ -0,0 +1,237 @@
+package weathermanager
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// City is an entry of the city registry. Reports are stored under its ID,
+// while any of its names resolve to it.
+type City struct {
+	ID          string
+	Name        string
+	Country     string
+	Region      string
+	Aliases     []string
+	Coordinates *Coordinates
+}
+
+// NormalizeCityName returns the display form of a city name: Unicode NFC
+// normalized, with surrounding and repeated whitespace removed.
+func NormalizeCityName(name string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(name)), " ")
+}
+
+// CityKey folds a city name into the form used for matching: accents removed,
+// lower cased and with every run of other characters replaced by a dash, so
+// "São Paulo", "Sao Paulo" and "sao-paulo " share the key sao-paulo.
+func CityKey(name string) string {
+	folder := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(folder, name)
+	if err != nil {
+		folded = name
+	}
+
+	key := strings.Builder{}
+	dash := false
+	for _, r := range strings.ToLower(folded) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && key.Len() > 0 {
+				key.WriteRune('-')
+			}
+			key.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return key.String()
+}
+
+// CityID is the canonical identifier of a city, qualified by its region and
+// country when given, e.g. springfield-il-us.
+func CityID(name string, region string, country string) string {
+	return CityKey(strings.Join([]string{name, region, country}, " "))
+}
+
+// CityRegistry resolves city names, IDs and aliases to registered cities. It
+// is not safe for concurrent use; the owning WeatherManager guards it.
+type CityRegistry struct {
+	cities  map[string]*City
+	aliases map[string]string
+	names   map[string][]string
+}
+
+func NewCityRegistry() *CityRegistry {
+	return &CityRegistry{
+		cities:  map[string]*City{},
+		aliases: map[string]string{},
+		names:   map[string][]string{},
+	}
+}
+
+// Resolve finds the city a name refers to: its ID (or qualified name, such as
+// "Springfield, IL, US"), one of its aliases, or its plain name when no other
+// registered city shares it.
+func (r *CityRegistry) Resolve(name string) (City, error) {
+	key := CityKey(name)
+	if key == "" {
+		return City{}, ValidationError("Empty city")
+	}
+
+	if city, ok := r.cities[key]; ok {
+		return r.copy(city), nil
+	}
+	if id, ok := r.aliases[key]; ok {
+		return r.copy(r.cities[id]), nil
+	}
+
+	ids := r.names[key]
+	switch len(ids) {
+	case 0:
+		return City{}, NotFoundError("City %s not found", name)
+	case 1:
+		return r.copy(r.cities[ids[0]]), nil
+	}
+	return City{}, ConflictError("City %s is ambiguous, use one of %s", name, strings.Join(ids, ", "))
+}
+
+// Register adds city to the registry, or adds its aliases (and updates its
+// coordinates, when given) if a city with the same ID already exists, and
+// returns the registered entry.
+func (r *CityRegistry) Register(city City) (City, error) {
+	city.Name = NormalizeCityName(city.Name)
+	city.Country = strings.ToUpper(strings.TrimSpace(city.Country))
+	city.Region = strings.ToUpper(strings.TrimSpace(city.Region))
+	city.ID = CityID(city.Name, city.Region, city.Country)
+	if city.ID == "" {
+		return City{}, ValidationError("Empty city")
+	}
+
+	for _, alias := range city.Aliases {
+		key := CityKey(alias)
+		if key == "" {
+			return City{}, ValidationError("Empty alias")
+		}
+		if id, ok := r.aliases[key]; ok && id != city.ID {
+			return City{}, ConflictError("Alias %s is already used by %s", alias, id)
+		}
+		if _, ok := r.cities[key]; ok && key != city.ID {
+			return City{}, ConflictError("Alias %s is already used by %s", alias, key)
+		}
+		for _, id := range r.names[key] {
+			if id != city.ID {
+				return City{}, ConflictError("Alias %s is already used by %s", alias, id)
+			}
+		}
+	}
+
+	registered, ok := r.cities[city.ID]
+	if !ok {
+		registered = &City{
+			ID:      city.ID,
+			Name:    city.Name,
+			Country: city.Country,
+			Region:  city.Region,
+		}
+		r.cities[city.ID] = registered
+
+		key := CityKey(city.Name)
+		r.names[key] = append(r.names[key], city.ID)
+		sort.Strings(r.names[key])
+	}
+
+	if city.Coordinates != nil {
+		coordinates := *city.Coordinates
+		registered.Coordinates = &coordinates
+	}
+
+	for _, alias := range city.Aliases {
+		key := CityKey(alias)
+		if _, ok := r.aliases[key]; ok || key == city.ID {
+			continue
+		}
+		r.aliases[key] = city.ID
+		registered.Aliases = append(registered.Aliases, NormalizeCityName(alias))
+	}
+
+	return r.copy(registered), nil
+}
+
+// ResolveOrRegister resolves name, registering it as a new city when no city
+// is known by it.
+func (r *CityRegistry) ResolveOrRegister(name string) (City, error) {
+	city, err := r.Resolve(name)
+	if !errors.Is(err, ErrNotFound) {
+		return city, err
+	}
+	return r.Register(City{Name: name})
+}
+
+func (r *CityRegistry) Remove(id string) {
+	city, ok := r.cities[id]
+	if !ok {
+		return
+	}
+
+	delete(r.cities, id)
+	for alias, aliasID := range r.aliases {
+		if aliasID == id {
+			delete(r.aliases, alias)
+		}
+	}
+
+	key := CityKey(city.Name)
+	ids := []string{}
+	for _, other := range r.names[key] {
+		if other != id {
+			ids = append(ids, other)
+		}
+	}
+	if len(ids) == 0 {
+		delete(r.names, key)
+	} else {
+		r.names[key] = ids
+	}
+}
+
+func (r *CityRegistry) Get(id string) (City, bool) {
+	city, ok := r.cities[id]
+	if !ok {
+		return City{}, false
+	}
+	return r.copy(city), true
+}
+
+func (r *CityRegistry) copy(city *City) City {
+	c := *city
+	c.Aliases = append([]string{}, city.Aliases...)
+	if city.Coordinates != nil {
+		coordinates := *city.Coordinates
+		c.Coordinates = &coordinates
+	}
+	return c
+}
+
+// clone returns a registry holding copies of the entries of r, to try changes
+// on without touching r.
+func (r *CityRegistry) clone() *CityRegistry {
+	c := NewCityRegistry()
+	for id, city := range r.cities {
+		copied := r.copy(city)
+		c.cities[id] = &copied
+	}
+	for alias, id := range r.aliases {
+		c.aliases[alias] = id
+	}
+	for name, ids := range r.names {
+		c.names[name] = append([]string{}, ids...)
+	}
+	return c
+}
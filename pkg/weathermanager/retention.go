@@ -0,0 +1,297 @@
+package weathermanager
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const monthLayout = "2006-01"
+
+// RetentionPolicy bounds how long observations are kept, in days counted from
+// their date. Once their whole month is older than RawDays, observations are
+// rolled up into monthly aggregates, which are dropped once their month ended
+// more than AggregateDays ago. Zero keeps the data forever.
+//
+// Observations are daily, so months are the only coarser level they are
+// rolled up to.
+type RetentionPolicy struct {
+	RawDays       int
+	AggregateDays int
+}
+
+func (p RetentionPolicy) validate() error {
+	if p.RawDays < 0 {
+		return ValidationError("Invalid raw retention %d days", p.RawDays)
+	}
+	if p.AggregateDays < 0 {
+		return ValidationError("Invalid aggregate retention %d days", p.AggregateDays)
+	}
+	if p.AggregateDays > 0 && p.AggregateDays < p.RawDays {
+		return ValidationError("Aggregate retention (%d days) can not be shorter than raw retention (%d days)", p.AggregateDays, p.RawDays)
+	}
+	return nil
+}
+
+// Aggregate summarizes the observations of a month rolled up by retention.
+type Aggregate struct {
+	Month string
+	Count int
+	Sum   int
+	Min   int
+	Max   int
+}
+
+func (a Aggregate) Mean() float64 {
+	return math.Round(float64(a.Sum)/float64(a.Count)*10) / 10
+}
+
+func (a *Aggregate) add(temperature int) {
+	if a.Count == 0 || temperature < a.Min {
+		a.Min = temperature
+	}
+	if a.Count == 0 || temperature > a.Max {
+		a.Max = temperature
+	}
+	a.Count++
+	a.Sum += temperature
+}
+
+// RetentionReport tells what a retention run changed.
+type RetentionReport struct {
+	RolledUp           int
+	DroppedAggregates  int
+	DroppedStationData int
+}
+
+// SetDefaultRetention sets the policy of the cities without a policy of their
+// own.
+func (m *MainWeatherManager) SetDefaultRetention(policy RetentionPolicy) error {
+	err := policy.validate()
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.options.Retention = policy
+	return nil
+}
+
+func (m *MainWeatherManager) DefaultRetention() RetentionPolicy {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.options.Retention
+}
+
+// SetRetention overrides the default policy for city, or removes its
+// override when policy is nil.
+func (m *MainWeatherManager) SetRetention(city string, policy *RetentionPolicy) error {
+	if policy != nil {
+		err := policy.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return err
+	}
+
+	if policy == nil {
+		delete(m.retention, id)
+	} else {
+		m.retention[id] = *policy
+	}
+	return nil
+}
+
+// Retention returns the policy applied to city and whether it overrides the
+// default one.
+func (m *MainWeatherManager) Retention(city string) (RetentionPolicy, bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return RetentionPolicy{}, false, err
+	}
+
+	policy, ok := m.retention[id]
+	if !ok {
+		return m.options.Retention, false, nil
+	}
+	return policy, true, nil
+}
+
+// Aggregates returns the monthly aggregates of city, oldest first.
+func (m *MainWeatherManager) Aggregates(city string) ([]Aggregate, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates := []Aggregate{}
+	for _, aggregate := range m.aggregates[id] {
+		aggregates = append(aggregates, *aggregate)
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		return aggregates[i].Month < aggregates[j].Month
+	})
+	return aggregates, nil
+}
+
+// ApplyRetention rolls up and drops the data of every city older than its
+// policy allows. Observations rolled up leave no history behind, as keeping
+// it would defeat the purpose of retention.
+func (m *MainWeatherManager) ApplyRetention() RetentionReport {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	report := RetentionReport{}
+	today := retentionDay()
+	for id := range m.weathers {
+		m.applyRetention(id, today, &report)
+	}
+	return report
+}
+
+// retentionDay is the day retention policies are applied on, in UTC.
+func retentionDay() time.Time {
+	return now().UTC().Truncate(24 * time.Hour)
+}
+
+func (m *MainWeatherManager) policyOf(city string) RetentionPolicy {
+	policy, ok := m.retention[city]
+	if !ok {
+		policy = m.options.Retention
+	}
+	return policy
+}
+
+func aggregateExpired(month string, cutoff time.Time) bool {
+	start, _ := time.Parse(monthLayout, month)
+	return start.AddDate(0, 1, 0).Before(cutoff)
+}
+
+// retentionDue returns the cities ApplyRetention would change on today.
+func (m *MainWeatherManager) retentionDue(today time.Time) []string {
+	due := []string{}
+	for id := range m.weathers {
+		if m.retentionDueFor(id, today) {
+			due = append(due, id)
+		}
+	}
+	return due
+}
+
+func (m *MainWeatherManager) retentionDueFor(city string, today time.Time) bool {
+	return m.policyOf(city).due(m.cityStats(city), today)
+}
+
+// due tells whether the policy would change the data summed up by stats on
+// today. Its oldest observation, reading and aggregate are enough to tell.
+func (p RetentionPolicy) due(stats cityStats, today time.Time) bool {
+	if p.RawDays > 0 {
+		cutoff := today.AddDate(0, 0, -p.RawDays).Format(dateLayout)
+		if stats.firstDate != "" && monthOf(stats.firstDate) < monthOf(cutoff) {
+			return true
+		}
+		if stats.firstReading != "" && stats.firstReading < cutoff {
+			return true
+		}
+	}
+
+	if p.AggregateDays > 0 {
+		cutoff := today.AddDate(0, 0, -p.AggregateDays)
+		if stats.firstAggregate != "" && aggregateExpired(stats.firstAggregate, cutoff) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRetention rolls up and drops the data of city older than its policy
+// allows on today, adding what it did to report.
+func (m *MainWeatherManager) applyRetention(city string, today time.Time, report *RetentionReport) {
+	policy := m.policyOf(city)
+
+	if policy.RawDays > 0 {
+		cutoff := today.AddDate(0, 0, -policy.RawDays).Format(dateLayout)
+		report.RolledUp += m.rollUp(city, cutoff)
+		for _, station := range m.stationsOf(city) {
+			for date := range m.readings[station.ID] {
+				if date < cutoff {
+					delete(m.readings[station.ID], date)
+					report.DroppedStationData++
+				}
+			}
+		}
+	}
+
+	if policy.AggregateDays > 0 {
+		cutoff := today.AddDate(0, 0, -policy.AggregateDays)
+		for month := range m.aggregates[city] {
+			if aggregateExpired(month, cutoff) {
+				delete(m.aggregates[city], month)
+				report.DroppedAggregates++
+			}
+		}
+	}
+}
+
+// rollUp moves the observations of city dated in the months ended before
+// cutoff into its monthly aggregates. Months are only rolled up whole, so the
+// aggregate of a month is never added to again.
+func (m *MainWeatherManager) rollUp(city string, cutoff string) int {
+	rolled := 0
+	for date, temperature := range m.weathers[city] {
+		month := monthOf(date)
+		if month >= monthOf(cutoff) {
+			continue
+		}
+
+		if m.aggregates[city] == nil {
+			m.aggregates[city] = map[string]*Aggregate{}
+		}
+		aggregate, ok := m.aggregates[city][month]
+		if !ok {
+			aggregate = &Aggregate{Month: month}
+			m.aggregates[city][month] = aggregate
+		}
+		aggregate.add(temperature)
+
+		delete(m.weathers[city], date)
+		delete(m.history[city], date)
+		m.datesChanged(city)
+		rolled++
+	}
+	return rolled
+}
+
+func monthOf(date string) string {
+	return date[:len(monthLayout)]
+}
+
+// checkRolledUp refuses observations of city dated in a month already rolled
+// up, as they would be counted twice in its aggregate.
+func (m *MainWeatherManager) checkRolledUp(city string, temperatures map[string]int) error {
+	if len(m.aggregates[city]) == 0 {
+		return nil
+	}
+	for date := range temperatures {
+		if _, ok := m.aggregates[city][monthOf(date)]; ok {
+			return ValidationError("Observation %s is in %s, already rolled up by retention", date, monthOf(date))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package weathermanager
+
+import (
+	"sort"
+	"time"
+)
+
+// Snapshot is a consistent copy of every city, with its observations,
+// aggregates and stations. Revision history and retention policies are not
+// part of it.
+type Snapshot struct {
+	CreatedAt time.Time
+	Cities    []SnapshotCity
+}
+
+type SnapshotCity struct {
+	City         City
+	Observations map[string]int
+	Aggregates   []Aggregate
+	Stations     []SnapshotStation
+}
+
+type SnapshotStation struct {
+	Station      Station
+	Observations map[string]int
+}
+
+// RestoreMode tells what happens to the data missing from a restored
+// snapshot: replace deletes it (cities can still be undeleted), merge keeps
+// it.
+type RestoreMode string
+
+const (
+	RestoreReplace RestoreMode = "replace"
+	RestoreMerge   RestoreMode = "merge"
+)
+
+const (
+	CityAdded     = "added"
+	CityRemoved   = "removed"
+	CityChanged   = "changed"
+	CityUnchanged = "unchanged"
+)
+
+// CityDiff counts the observations of a city a restore adds, changes and
+// removes.
+type CityDiff struct {
+	City    string
+	Status  string
+	Added   int
+	Changed int
+	Removed int
+}
+
+type RestoreDiff struct {
+	Mode    RestoreMode
+	DryRun  bool
+	Cities  []CityDiff
+	Added   int
+	Changed int
+	Removed int
+}
+
+func copyTemperatures(temperatures map[string]int) map[string]int {
+	copied := map[string]int{}
+	for k, v := range temperatures {
+		copied[k] = v
+	}
+	return copied
+}
+
+// Snapshot copies every city while holding the lock, so the snapshot reflects
+// a single point in time.
+func (m *MainWeatherManager) Snapshot() (Snapshot, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	snapshot := Snapshot{CreatedAt: now().UTC(), Cities: []SnapshotCity{}}
+	for id := range m.weathers {
+		snapshot.Cities = append(snapshot.Cities, m.snapshotCity(id))
+	}
+
+	sort.Slice(snapshot.Cities, func(i, j int) bool {
+		return snapshot.Cities[i].City.ID < snapshot.Cities[j].City.ID
+	})
+	return snapshot, nil
+}
+
+func (m *MainWeatherManager) snapshotCity(id string) SnapshotCity {
+	city, _ := m.cities.Get(id)
+	snapshotCity := SnapshotCity{
+		City:         city,
+		Observations: copyTemperatures(m.weathers[id]),
+		Aggregates:   []Aggregate{},
+		Stations:     []SnapshotStation{},
+	}
+	for _, aggregate := range m.aggregates[id] {
+		snapshotCity.Aggregates = append(snapshotCity.Aggregates, *aggregate)
+	}
+	sort.Slice(snapshotCity.Aggregates, func(i, j int) bool {
+		return snapshotCity.Aggregates[i].Month < snapshotCity.Aggregates[j].Month
+	})
+	for _, station := range m.stationsOf(id) {
+		snapshotCity.Stations = append(snapshotCity.Stations, SnapshotStation{
+			Station:      station,
+			Observations: copyTemperatures(m.readings[station.ID]),
+		})
+	}
+	return snapshotCity
+}
+
+func (s Snapshot) validate() error {
+	for _, city := range s.Cities {
+		err := validateDates(city.Observations)
+		if err != nil {
+			return err
+		}
+		if city.City.Coordinates != nil {
+			err := validateCoordinates(*city.City.Coordinates)
+			if err != nil {
+				return err
+			}
+		}
+		months := map[string]bool{}
+		for _, aggregate := range city.Aggregates {
+			_, err := time.Parse(monthLayout, aggregate.Month)
+			if err != nil || aggregate.Count <= 0 {
+				return ValidationError("Invalid aggregate %s of %s", aggregate.Month, city.City.Name)
+			}
+			months[aggregate.Month] = true
+		}
+		for date := range city.Observations {
+			if months[monthOf(date)] {
+				return ValidationError("Observation %s of %s is in %s, already rolled up by retention", date, city.City.Name, monthOf(date))
+			}
+		}
+		for _, station := range city.Stations {
+			if CityKey(station.Station.ID) == "" {
+				return ValidationError("Empty station of %s", city.City.Name)
+			}
+			err := validateDates(station.Observations)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Restore loads snapshot, or only reports what it would change when dryRun is
+// set. Every city of the snapshot is checked before anything is changed, so a
+// snapshot that can not be restored leaves the manager untouched.
+func (m *MainWeatherManager) Restore(snapshot Snapshot, mode RestoreMode, dryRun bool) (RestoreDiff, error) {
+	if mode != RestoreReplace && mode != RestoreMerge {
+		return RestoreDiff{}, ValidationError("Invalid restore mode %s", mode)
+	}
+	err := snapshot.validate()
+	if err != nil {
+		return RestoreDiff{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	registry := NewCityRegistry()
+	if mode == RestoreMerge {
+		registry = m.cities.clone()
+	}
+
+	cities := map[string]SnapshotCity{}
+	stations := map[string]string{}
+	for _, city := range snapshot.Cities {
+		registered, err := registry.Register(city.City)
+		if err != nil {
+			return RestoreDiff{}, err
+		}
+		if _, ok := cities[registered.ID]; ok {
+			return RestoreDiff{}, ConflictError("City %s is repeated in the snapshot", registered.ID)
+		}
+		cities[registered.ID] = city
+		if mode == RestoreMerge {
+			err := m.checkRolledUp(registered.ID, city.Observations)
+			if err != nil {
+				return RestoreDiff{}, err
+			}
+		}
+
+		for _, station := range city.Stations {
+			id := CityKey(station.Station.ID)
+			if other, ok := stations[id]; ok {
+				return RestoreDiff{}, ConflictError("Station %s belongs to both %s and %s", id, other, registered.ID)
+			}
+			if existing, ok := m.stations[id]; ok && mode == RestoreMerge && existing.City != registered.ID {
+				return RestoreDiff{}, ConflictError("Station %s already belongs to %s", id, existing.City)
+			}
+			stations[id] = registered.ID
+		}
+	}
+
+	diff := m.restoreDiff(cities, mode)
+	diff.DryRun = dryRun
+	if dryRun {
+		return diff, nil
+	}
+
+	if mode == RestoreReplace {
+		for id := range m.weathers {
+			city, _ := m.cities.Get(id)
+			if _, ok := cities[id]; !ok {
+				m.softDelete(city)
+				continue
+			}
+			// Registered again below with exactly the aliases and location of
+			// the snapshot.
+			m.cities.Remove(id)
+			m.locations.remove(id)
+		}
+	}
+
+	for _, city := range snapshot.Cities {
+		m.restoreCity(city, mode)
+	}
+	return diff, nil
+}
+
+func (m *MainWeatherManager) restoreCity(city SnapshotCity, mode RestoreMode) {
+	registered, _ := m.cities.Register(city.City)
+	id := registered.ID
+	if registered.Coordinates != nil {
+		m.locations.put(id, *registered.Coordinates)
+	}
+
+	if _, ok := m.weathers[id]; !ok {
+		m.weathers[id] = map[string]int{}
+	}
+	if mode == RestoreReplace {
+		for date := range m.weathers[id] {
+			if _, ok := city.Observations[date]; !ok {
+				m.unset(id, date)
+			}
+		}
+		delete(m.aggregates, id)
+	}
+	for date, temperature := range city.Observations {
+		m.set(id, date, temperature)
+	}
+
+	if len(city.Aggregates) > 0 && m.aggregates[id] == nil {
+		m.aggregates[id] = map[string]*Aggregate{}
+	}
+	for i := range city.Aggregates {
+		aggregate := city.Aggregates[i]
+		m.aggregates[id][aggregate.Month] = &aggregate
+	}
+
+	restored := map[string]bool{}
+	for _, s := range city.Stations {
+		station := s.Station
+		station.ID = CityKey(station.ID)
+		station.City = id
+		restored[station.ID] = true
+
+		copied := copyStation(&station)
+		m.stations[station.ID] = &copied
+		if mode == RestoreReplace || m.readings[station.ID] == nil {
+			m.readings[station.ID] = map[string]int{}
+		}
+		for date, temperature := range s.Observations {
+			m.readings[station.ID][date] = temperature
+		}
+	}
+	if mode == RestoreReplace {
+		for _, station := range m.stationsOf(id) {
+			if !restored[station.ID] {
+				delete(m.stations, station.ID)
+				delete(m.readings, station.ID)
+			}
+		}
+	}
+}
+
+// restoreDiff compares the observations of the restored cities, by ID, with
+// the current ones.
+func (m *MainWeatherManager) restoreDiff(cities map[string]SnapshotCity, mode RestoreMode) RestoreDiff {
+	diff := RestoreDiff{Mode: mode, Cities: []CityDiff{}}
+
+	for id, city := range cities {
+		current, exists := m.weathers[id]
+		cityDiff := CityDiff{City: id, Status: CityUnchanged}
+		for date, temperature := range city.Observations {
+			old, ok := current[date]
+			if !ok {
+				cityDiff.Added++
+			} else if old != temperature {
+				cityDiff.Changed++
+			}
+		}
+		if mode == RestoreReplace {
+			for date := range current {
+				if _, ok := city.Observations[date]; !ok {
+					cityDiff.Removed++
+				}
+			}
+		}
+
+		if !exists {
+			cityDiff.Status = CityAdded
+		} else if cityDiff.Added+cityDiff.Changed+cityDiff.Removed > 0 {
+			cityDiff.Status = CityChanged
+		}
+		diff.Cities = append(diff.Cities, cityDiff)
+	}
+
+	if mode == RestoreReplace {
+		for id, current := range m.weathers {
+			if _, ok := cities[id]; !ok {
+				diff.Cities = append(diff.Cities, CityDiff{City: id, Status: CityRemoved, Removed: len(current)})
+			}
+		}
+	}
+
+	sort.Slice(diff.Cities, func(i, j int) bool {
+		return diff.Cities[i].City < diff.Cities[j].City
+	})
+	for _, cityDiff := range diff.Cities {
+		diff.Added += cityDiff.Added
+		diff.Changed += cityDiff.Changed
+		diff.Removed += cityDiff.Removed
+	}
+	return diff
+}
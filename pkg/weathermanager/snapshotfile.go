@@ -0,0 +1,259 @@
+package weathermanager
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A snapshot file is a gzip compressed JSON envelope naming its format and
+// version, with the SHA-256 checksum of the exact bytes of its data.
+const (
+	SnapshotFormat  = "weather-reporting-snapshot"
+	SnapshotVersion = 1
+)
+
+// ErrSnapshotTooLarge is matched by the error of ReadSnapshot when the
+// decompressed snapshot is larger than allowed.
+var ErrSnapshotTooLarge = errors.New("snapshot too large")
+
+// snapshotLimitReader fails with ErrSnapshotTooLarge once more than remaining
+// bytes are read, so a small file decompressing into a huge one is stopped.
+type snapshotLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *snapshotLimitReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, ErrSnapshotTooLarge
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+type snapshotEnvelope struct {
+	Format    string          `json:"format"`
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Checksum  string          `json:"checksum"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type snapshotData struct {
+	Cities []snapshotCityModel `json:"cities"`
+}
+
+type snapshotCoordinatesModel struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Elevation float64 `json:"elevation,omitempty"`
+}
+
+type snapshotAggregateModel struct {
+	Month string `json:"month"`
+	Count int    `json:"count"`
+	Sum   int    `json:"sum"`
+	Min   int    `json:"min"`
+	Max   int    `json:"max"`
+}
+
+type snapshotStationModel struct {
+	ID           string                    `json:"id"`
+	Name         string                    `json:"name,omitempty"`
+	Owner        string                    `json:"owner,omitempty"`
+	Coordinates  *snapshotCoordinatesModel `json:"coordinates,omitempty"`
+	Observations map[string]int            `json:"observations"`
+}
+
+type snapshotCityModel struct {
+	ID           string                    `json:"id"`
+	Name         string                    `json:"name"`
+	Country      string                    `json:"country,omitempty"`
+	Region       string                    `json:"region,omitempty"`
+	Aliases      []string                  `json:"aliases,omitempty"`
+	Coordinates  *snapshotCoordinatesModel `json:"coordinates,omitempty"`
+	Observations map[string]int            `json:"observations"`
+	Aggregates   []snapshotAggregateModel  `json:"aggregates,omitempty"`
+	Stations     []snapshotStationModel    `json:"stations,omitempty"`
+}
+
+func toSnapshotCoordinates(c *Coordinates) *snapshotCoordinatesModel {
+	if c == nil {
+		return nil
+	}
+	return &snapshotCoordinatesModel{Latitude: c.Latitude, Longitude: c.Longitude, Elevation: c.Elevation}
+}
+
+func fromSnapshotCoordinates(c *snapshotCoordinatesModel) *Coordinates {
+	if c == nil {
+		return nil
+	}
+	return &Coordinates{Latitude: c.Latitude, Longitude: c.Longitude, Elevation: c.Elevation}
+}
+
+func toSnapshotCityModel(city SnapshotCity) snapshotCityModel {
+	model := snapshotCityModel{
+		ID:           city.City.ID,
+		Name:         city.City.Name,
+		Country:      city.City.Country,
+		Region:       city.City.Region,
+		Aliases:      city.City.Aliases,
+		Coordinates:  toSnapshotCoordinates(city.City.Coordinates),
+		Observations: city.Observations,
+	}
+	for _, a := range city.Aggregates {
+		model.Aggregates = append(model.Aggregates, snapshotAggregateModel{
+			Month: a.Month,
+			Count: a.Count,
+			Sum:   a.Sum,
+			Min:   a.Min,
+			Max:   a.Max,
+		})
+	}
+	for _, s := range city.Stations {
+		model.Stations = append(model.Stations, snapshotStationModel{
+			ID:           s.Station.ID,
+			Name:         s.Station.Name,
+			Owner:        s.Station.Owner,
+			Coordinates:  toSnapshotCoordinates(s.Station.Coordinates),
+			Observations: s.Observations,
+		})
+	}
+	return model
+}
+
+func fromSnapshotCityModel(model snapshotCityModel) SnapshotCity {
+	city := SnapshotCity{
+		City: City{
+			ID:          model.ID,
+			Name:        model.Name,
+			Country:     model.Country,
+			Region:      model.Region,
+			Aliases:     model.Aliases,
+			Coordinates: fromSnapshotCoordinates(model.Coordinates),
+		},
+		Observations: model.Observations,
+	}
+	if city.Observations == nil {
+		city.Observations = map[string]int{}
+	}
+	for _, a := range model.Aggregates {
+		city.Aggregates = append(city.Aggregates, Aggregate{
+			Month: a.Month,
+			Count: a.Count,
+			Sum:   a.Sum,
+			Min:   a.Min,
+			Max:   a.Max,
+		})
+	}
+	for _, s := range model.Stations {
+		observations := s.Observations
+		if observations == nil {
+			observations = map[string]int{}
+		}
+		city.Stations = append(city.Stations, SnapshotStation{
+			Station: Station{
+				ID:          s.ID,
+				Name:        s.Name,
+				City:        model.ID,
+				Owner:       s.Owner,
+				Coordinates: fromSnapshotCoordinates(s.Coordinates),
+			},
+			Observations: observations,
+		})
+	}
+	return city
+}
+
+func snapshotChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// WriteSnapshot writes snapshot to w in the snapshot file format.
+func WriteSnapshot(w io.Writer, snapshot Snapshot) error {
+	data := snapshotData{Cities: []snapshotCityModel{}}
+	for _, city := range snapshot.Cities {
+		data.Cities = append(data.Cities, toSnapshotCityModel(city))
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	compressed := gzip.NewWriter(w)
+	err = json.NewEncoder(compressed).Encode(snapshotEnvelope{
+		Format:    SnapshotFormat,
+		Version:   SnapshotVersion,
+		CreatedAt: snapshot.CreatedAt,
+		Checksum:  snapshotChecksum(encoded),
+		Data:      encoded,
+	})
+	if err != nil {
+		compressed.Close()
+		return err
+	}
+	return compressed.Close()
+}
+
+// ReadSnapshot reads a snapshot file, rejecting it when its format or version
+// is unknown or its checksum does not match. A snapshot decompressing into
+// more than maxBytes is rejected with an error matching ErrSnapshotTooLarge;
+// maxBytes of zero reads snapshots of any size.
+func ReadSnapshot(r io.Reader, maxBytes int64) (Snapshot, error) {
+	decompressed, err := gzip.NewReader(r)
+	if err != nil {
+		return Snapshot{}, ValidationError("Invalid snapshot, expected a gzip compressed file (%s)", err.Error())
+	}
+	defer decompressed.Close()
+
+	var contents io.Reader = decompressed
+	if maxBytes > 0 {
+		contents = &snapshotLimitReader{r: decompressed, remaining: maxBytes}
+	}
+
+	var envelope snapshotEnvelope
+	err = json.NewDecoder(contents).Decode(&envelope)
+	if errors.Is(err, ErrSnapshotTooLarge) {
+		return Snapshot{}, &Error{
+			Kind:    ErrValidation,
+			Message: fmt.Sprintf("Snapshot is larger than %d bytes once decompressed", maxBytes),
+			Err:     ErrSnapshotTooLarge,
+		}
+	}
+	if err != nil {
+		return Snapshot{}, ValidationError("Invalid snapshot (%s)", err.Error())
+	}
+	if envelope.Format != SnapshotFormat {
+		return Snapshot{}, ValidationError("Invalid snapshot format %s", envelope.Format)
+	}
+	if envelope.Version != SnapshotVersion {
+		return Snapshot{}, ValidationError("Unsupported snapshot version %d, expected %d", envelope.Version, SnapshotVersion)
+	}
+	if checksum := snapshotChecksum(envelope.Data); checksum != envelope.Checksum {
+		return Snapshot{}, ValidationError("Snapshot checksum mismatch, expected %s but got %s", envelope.Checksum, checksum)
+	}
+
+	var data snapshotData
+	err = json.Unmarshal(envelope.Data, &data)
+	if err != nil {
+		return Snapshot{}, ValidationError("Invalid snapshot data (%s)", err.Error())
+	}
+
+	snapshot := Snapshot{CreatedAt: envelope.CreatedAt, Cities: []SnapshotCity{}}
+	for _, model := range data.Cities {
+		snapshot.Cities = append(snapshot.Cities, fromSnapshotCityModel(model))
+	}
+	return snapshot, nil
+}
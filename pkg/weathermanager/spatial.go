@@ -0,0 +1,231 @@
+package weathermanager
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	earthRadiusKm = 6371.0
+	// Half the circumference of the Earth, the farthest two points can be.
+	maxDistanceKm = math.Pi * earthRadiusKm
+
+	spatialCellDegrees = 1.0
+	initialSearchKm    = 50.0
+)
+
+// Coordinates locate a city, elevation being in meters above sea level.
+type Coordinates struct {
+	Latitude  float64
+	Longitude float64
+	Elevation float64
+}
+
+// BoundingBox selects the coordinates between its corners. A box with West
+// greater than East crosses the antimeridian.
+type BoundingBox struct {
+	West  float64
+	South float64
+	East  float64
+	North float64
+}
+
+// NearbyCity is a city found by a spatial query, with its distance to the
+// queried point (zero for bounding boxes), its number of observations and the
+// latest of them.
+type NearbyCity struct {
+	City              City
+	DistanceKm        float64
+	Observations      int
+	LatestDate        string
+	LatestTemperature int
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// DistanceKm is the great-circle distance between two points.
+func DistanceKm(a Coordinates, b Coordinates) float64 {
+	latA, latB := toRadians(a.Latitude), toRadians(b.Latitude)
+	dLat := latB - latA
+	dLon := toRadians(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(latA)*math.Cos(latB)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func (b BoundingBox) contains(c Coordinates) bool {
+	if c.Latitude < b.South || c.Latitude > b.North {
+		return false
+	}
+	if b.West <= b.East {
+		return c.Longitude >= b.West && c.Longitude <= b.East
+	}
+	return c.Longitude >= b.West || c.Longitude <= b.East
+}
+
+// boxAround returns a bounding box containing every point within radiusKm of
+// center.
+func boxAround(center Coordinates, radiusKm float64) BoundingBox {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	box := BoundingBox{
+		South: math.Max(-90, center.Latitude-dLat),
+		North: math.Min(90, center.Latitude+dLat),
+		West:  -180,
+		East:  180,
+	}
+
+	// Near the poles every longitude is within reach.
+	if box.South == -90 || box.North == 90 {
+		return box
+	}
+
+	maxLatitude := math.Max(math.Abs(box.South), math.Abs(box.North))
+	dLon := dLat / math.Cos(toRadians(maxLatitude))
+	if dLon >= 180 {
+		return box
+	}
+
+	box.West = math.Mod(center.Longitude-dLon+540, 360) - 180
+	box.East = math.Mod(center.Longitude+dLon+540, 360) - 180
+	return box
+}
+
+func validateCoordinates(c Coordinates) error {
+	if math.IsNaN(c.Latitude) || c.Latitude < -90 || c.Latitude > 90 {
+		return ValidationError("Invalid latitude %g", c.Latitude)
+	}
+	if math.IsNaN(c.Longitude) || c.Longitude < -180 || c.Longitude > 180 {
+		return ValidationError("Invalid longitude %g", c.Longitude)
+	}
+	return nil
+}
+
+func validateBoundingBox(b BoundingBox) error {
+	err := validateCoordinates(Coordinates{Latitude: b.South, Longitude: b.West})
+	if err != nil {
+		return err
+	}
+	err = validateCoordinates(Coordinates{Latitude: b.North, Longitude: b.East})
+	if err != nil {
+		return err
+	}
+	if b.South > b.North {
+		return ValidationError("Invalid bounding box, south is above north")
+	}
+	return nil
+}
+
+type spatialCell struct {
+	latitude, longitude int
+}
+
+func cellOf(latitude float64, longitude float64) spatialCell {
+	return spatialCell{
+		latitude:  int(math.Floor(latitude / spatialCellDegrees)),
+		longitude: int(math.Floor(longitude / spatialCellDegrees)),
+	}
+}
+
+// spatialIndex is a grid of cells of one degree, holding the coordinates of
+// the cities located in each of them.
+type spatialIndex struct {
+	cells     map[spatialCell]map[string]Coordinates
+	locations map[string]Coordinates
+}
+
+func newSpatialIndex() *spatialIndex {
+	return &spatialIndex{
+		cells:     map[spatialCell]map[string]Coordinates{},
+		locations: map[string]Coordinates{},
+	}
+}
+
+func (s *spatialIndex) put(id string, c Coordinates) {
+	s.remove(id)
+
+	cell := cellOf(c.Latitude, c.Longitude)
+	if s.cells[cell] == nil {
+		s.cells[cell] = map[string]Coordinates{}
+	}
+	s.cells[cell][id] = c
+	s.locations[id] = c
+}
+
+func (s *spatialIndex) remove(id string) {
+	c, ok := s.locations[id]
+	if !ok {
+		return
+	}
+
+	cell := cellOf(c.Latitude, c.Longitude)
+	delete(s.cells[cell], id)
+	if len(s.cells[cell]) == 0 {
+		delete(s.cells, cell)
+	}
+	delete(s.locations, id)
+}
+
+func (s *spatialIndex) within(box BoundingBox) map[string]Coordinates {
+	found := map[string]Coordinates{}
+
+	collect := func(west float64, east float64) {
+		from, to := cellOf(box.South, west), cellOf(box.North, east)
+		for latitude := from.latitude; latitude <= to.latitude; latitude++ {
+			for longitude := from.longitude; longitude <= to.longitude; longitude++ {
+				for id, c := range s.cells[spatialCell{latitude, longitude}] {
+					if box.contains(c) {
+						found[id] = c
+					}
+				}
+			}
+		}
+	}
+
+	if box.West <= box.East {
+		collect(box.West, box.East)
+	} else {
+		collect(box.West, 180)
+		collect(-180, box.East)
+	}
+	return found
+}
+
+// withinRadius returns the cities within radiusKm of center, closest first.
+func (s *spatialIndex) withinRadius(center Coordinates, radiusKm float64) []NearbyCity {
+	found := []NearbyCity{}
+	for id, c := range s.within(boxAround(center, radiusKm)) {
+		distance := DistanceKm(center, c)
+		if distance <= radiusKm {
+			found = append(found, NearbyCity{City: City{ID: id}, DistanceKm: distance})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].DistanceKm != found[j].DistanceKm {
+			return found[i].DistanceKm < found[j].DistanceKm
+		}
+		return found[i].City.ID < found[j].City.ID
+	})
+	return found
+}
+
+// nearest returns up to limit cities closest to center, no farther than
+// radiusKm when it is positive. The search radius doubles until enough cities
+// are found: every city outside of it is farther than the ones inside.
+func (s *spatialIndex) nearest(center Coordinates, limit int, radiusKm float64) []NearbyCity {
+	if radiusKm <= 0 || radiusKm > maxDistanceKm {
+		radiusKm = maxDistanceKm
+	}
+
+	for searchKm := math.Min(initialSearchKm, radiusKm); ; searchKm = math.Min(searchKm*2, radiusKm) {
+		found := s.withinRadius(center, searchKm)
+		if len(found) >= limit || searchKm == radiusKm {
+			if len(found) > limit {
+				found = found[:limit]
+			}
+			return found
+		}
+	}
+}
@@ -0,0 +1,734 @@
+package weathermanager
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	sqlDefaultRetentionSetting = "default_retention"
+	sqlHistorySinceSetting     = "history_since"
+)
+
+// sqlQueryer is implemented by both *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type sqlStore struct {
+	db *sql.DB
+}
+
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+// OpenSQL migrates the schema of db to the latest version and loads its
+// cities. Queries are written for SQLite, and db is closed by Close.
+func OpenSQL(db *sql.DB, options Options) (*StoredWeatherManager, error) {
+	_, err := MigrateSQL(db)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`INSERT INTO settings (name, value) VALUES (?, ?) ON CONFLICT (name) DO NOTHING`,
+		sqlHistorySinceSetting, now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, StorageError(err, "Error starting the history")
+	}
+
+	m, err := openStored(&sqlStore{db: db}, options)
+	if err != nil {
+		return nil, StorageError(err, "Error loading the database")
+	}
+	return m, nil
+}
+
+func sqlCoordinates(latitude, longitude, elevation sql.NullFloat64) *Coordinates {
+	if !latitude.Valid || !longitude.Valid {
+		return nil
+	}
+	return &Coordinates{Latitude: latitude.Float64, Longitude: longitude.Float64, Elevation: elevation.Float64}
+}
+
+// sqlCoordinateArgs returns the latitude, longitude and elevation columns of
+// c, all NULL when c is nil.
+func sqlCoordinateArgs(c *Coordinates) []interface{} {
+	if c == nil {
+		return []interface{}{nil, nil, nil}
+	}
+	return []interface{}{c.Latitude, c.Longitude, c.Elevation}
+}
+
+// queryTemperatures reads the rows of (key, date, temperature) returned by
+// query into a map of temperatures by date for each key.
+func queryTemperatures(q sqlQueryer, query string, args ...interface{}) (map[string]map[string]int, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	temperatures := map[string]map[string]int{}
+	for rows.Next() {
+		var key, date string
+		var temperature int
+		err := rows.Scan(&key, &date, &temperature)
+		if err != nil {
+			return nil, err
+		}
+		if temperatures[key] == nil {
+			temperatures[key] = map[string]int{}
+		}
+		temperatures[key][date] = temperature
+	}
+	return temperatures, rows.Err()
+}
+
+func queryStrings(q sqlQueryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+func (s *sqlStore) load() ([]storedCity, []storedDeletedCity, *RetentionPolicy, error) {
+	var retention *RetentionPolicy
+	var setting string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE name = ?`, sqlDefaultRetentionSetting).Scan(&setting)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, nil, nil, err
+	}
+	if err == nil {
+		var policy retentionModel
+		err := json.Unmarshal([]byte(setting), &policy)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		retention = policy.policy()
+	}
+
+	cities, err := s.loadCities("")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	deleted, err := s.loadDeletedCities()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cities, deleted, retention, nil
+}
+
+func (s *sqlStore) historySince() (time.Time, error) {
+	var since string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE name = ?`, sqlHistorySinceSetting).Scan(&since)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, since)
+}
+
+// sqlCityCondition returns the condition on column that selects the city id,
+// none when id is empty, and its arguments.
+func sqlCityCondition(column, id string) (string, []interface{}) {
+	if id == "" {
+		return "", nil
+	}
+	return ` WHERE ` + column + ` = ?`, []interface{}{id}
+}
+
+// loadCities reads the city id, or all of them when it is empty, with their
+// aliases and stations.
+func (s *sqlStore) loadCities(id string) ([]storedCity, error) {
+	where, args := sqlCityCondition("id", id)
+	rows, err := s.db.Query(`SELECT id, name, country, region, latitude, longitude, elevation, raw_retention_days, aggregate_retention_days FROM cities`+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := []storedCity{}
+	for rows.Next() {
+		var city City
+		var latitude, longitude, elevation sql.NullFloat64
+		var rawDays, aggregateDays sql.NullInt64
+		err := rows.Scan(&city.ID, &city.Name, &city.Country, &city.Region, &latitude, &longitude, &elevation, &rawDays, &aggregateDays)
+		if err != nil {
+			return nil, err
+		}
+		city.Coordinates = sqlCoordinates(latitude, longitude, elevation)
+
+		stored := storedCity{city: SnapshotCity{City: city}}
+		if rawDays.Valid && aggregateDays.Valid {
+			stored.retention = &RetentionPolicy{RawDays: int(rawDays.Int64), AggregateDays: int(aggregateDays.Int64)}
+		}
+		cities = append(cities, stored)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	aliases, err := s.loadAliases(id)
+	if err != nil {
+		return nil, err
+	}
+	stations, err := s.loadStations(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range cities {
+		city := &cities[i].city
+		id := city.City.ID
+		city.City.Aliases = aliases[id]
+		city.Stations = stations[id]
+	}
+	return cities, nil
+}
+
+func (s *sqlStore) loadAliases(city string) (map[string][]string, error) {
+	where, args := sqlCityCondition("city_id", city)
+	rows, err := s.db.Query(`SELECT city_id, alias FROM city_aliases`+where+` ORDER BY city_id, alias`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := map[string][]string{}
+	for rows.Next() {
+		var city, alias string
+		err := rows.Scan(&city, &alias)
+		if err != nil {
+			return nil, err
+		}
+		aliases[city] = append(aliases[city], alias)
+	}
+	return aliases, rows.Err()
+}
+
+func (s *sqlStore) loadStations(city string) (map[string][]SnapshotStation, error) {
+	where, args := sqlCityCondition("city_id", city)
+	rows, err := s.db.Query(`SELECT id, city_id, name, owner, latitude, longitude, elevation FROM stations`+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stations := map[string][]SnapshotStation{}
+	for rows.Next() {
+		var station Station
+		var latitude, longitude, elevation sql.NullFloat64
+		err := rows.Scan(&station.ID, &station.City, &station.Name, &station.Owner, &latitude, &longitude, &elevation)
+		if err != nil {
+			return nil, err
+		}
+		station.Coordinates = sqlCoordinates(latitude, longitude, elevation)
+		stations[station.City] = append(stations[station.City], SnapshotStation{Station: station})
+	}
+	return stations, rows.Err()
+}
+
+func (s *sqlStore) loadDeletedCities() ([]storedDeletedCity, error) {
+	rows, err := s.db.Query(`SELECT data FROM deleted_cities ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deleted := []storedDeletedCity{}
+	for rows.Next() {
+		var data string
+		err := rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+
+		var record deletedCityModel
+		err = json.Unmarshal([]byte(data), &record)
+		if err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, record.deletedCity())
+	}
+	return deleted, rows.Err()
+}
+
+func (s *sqlStore) loadCity(id string) (*storedCity, error) {
+	cities, err := s.loadCities(id)
+	if err != nil || len(cities) == 0 {
+		return nil, err
+	}
+	city := cities[0]
+
+	observations, err := queryTemperatures(s.db, `SELECT city_id, date, temperature FROM observations WHERE city_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	city.city.Observations = observations[id]
+	if city.city.Observations == nil {
+		city.city.Observations = map[string]int{}
+	}
+
+	city.city.Aggregates, err = s.aggregates(id)
+	if err != nil {
+		return nil, err
+	}
+
+	readings, err := queryTemperatures(s.db, `SELECT o.station_id, o.date, o.temperature
+		FROM station_observations o JOIN stations s ON s.id = o.station_id
+		WHERE s.city_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range city.city.Stations {
+		station := &city.city.Stations[i]
+		station.Observations = readings[station.Station.ID]
+		if station.Observations == nil {
+			station.Observations = map[string]int{}
+		}
+	}
+	return &city, nil
+}
+
+func (s *sqlStore) loadDeleted(id string) (*storedDeletedCity, error) {
+	var entry, data string
+	err := s.db.QueryRow(`SELECT d.data, c.data FROM deleted_cities d JOIN deleted_city_data c ON c.id = d.id WHERE d.id = ?`, id).Scan(&entry, &data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record deletedCityModel
+	err = json.Unmarshal([]byte(entry), &record)
+	if err != nil {
+		return nil, err
+	}
+	var city snapshotCityModel
+	err = json.Unmarshal([]byte(data), &city)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := record.deletedCity()
+	deleted.city = fromSnapshotCityModel(city)
+	return &deleted, nil
+}
+
+func (s *sqlStore) stats(ids []string) (map[string]cityStats, error) {
+	stats := map[string]cityStats{}
+	for _, id := range ids {
+		var city cityStats
+		var firstDate, lastDate, firstReading, firstAggregate sql.NullString
+		var lastTemperature sql.NullInt64
+		err := s.db.QueryRow(`SELECT
+				(SELECT COUNT(*) FROM observations WHERE city_id = ?1),
+				(SELECT MIN(date) FROM observations WHERE city_id = ?1),
+				(SELECT MAX(date) FROM observations WHERE city_id = ?1),
+				(SELECT temperature FROM observations WHERE city_id = ?1 ORDER BY date DESC LIMIT 1),
+				(SELECT MIN(o.date) FROM station_observations o JOIN stations s ON s.id = o.station_id WHERE s.city_id = ?1),
+				(SELECT MIN(month) FROM aggregates WHERE city_id = ?1)`, id).
+			Scan(&city.observations, &firstDate, &lastDate, &lastTemperature, &firstReading, &firstAggregate)
+		if err != nil {
+			return nil, err
+		}
+		city.firstDate, city.lastDate = firstDate.String, lastDate.String
+		city.lastTemperature = int(lastTemperature.Int64)
+		city.firstReading, city.firstAggregate = firstReading.String, firstAggregate.String
+		stats[id] = city
+	}
+	return stats, nil
+}
+
+func (s *sqlStore) update(fn func(storeTx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&sqlTx{tx: tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlRangeConditions returns the conditions on the date column that select
+// dateRange, and their arguments.
+func sqlRangeConditions(dateRange DateRange) ([]string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if dateRange.From != "" {
+		if dateRange.FromInclusive {
+			conditions = append(conditions, "date >= ?")
+		} else {
+			conditions = append(conditions, "date > ?")
+		}
+		args = append(args, dateRange.From)
+	}
+	if dateRange.To != "" {
+		if dateRange.ToInclusive {
+			conditions = append(conditions, "date <= ?")
+		} else {
+			conditions = append(conditions, "date < ?")
+		}
+		args = append(args, dateRange.To)
+	}
+	return conditions, args
+}
+
+// scanTable reads at most limit temperatures of key, in the column of table,
+// within dateRange.
+func (s *sqlStore) scanTable(table, column, key string, dateRange DateRange, limit int) ([]string, []int, error) {
+	conditions, args := sqlRangeConditions(dateRange)
+	conditions = append([]string{column + " = ?"}, conditions...)
+	args = append(append([]interface{}{key}, args...), limit)
+
+	rows, err := s.db.Query(`SELECT date, temperature FROM `+table+` WHERE `+strings.Join(conditions, " AND ")+` ORDER BY date LIMIT ?`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	dates := []string{}
+	temperatures := []int{}
+	for rows.Next() {
+		var date string
+		var temperature int
+		err := rows.Scan(&date, &temperature)
+		if err != nil {
+			return nil, nil, err
+		}
+		dates = append(dates, date)
+		temperatures = append(temperatures, temperature)
+	}
+	return dates, temperatures, rows.Err()
+}
+
+func (s *sqlStore) scan(city string, dateRange DateRange, limit int) ([]string, []int, error) {
+	return s.scanTable("observations", "city_id", city, dateRange, limit)
+}
+
+func (s *sqlStore) scanReadings(station string, dateRange DateRange, limit int) ([]string, []int, error) {
+	return s.scanTable("station_observations", "station_id", station, dateRange, limit)
+}
+
+func (s *sqlStore) aggregates(city string) ([]Aggregate, error) {
+	rows, err := s.db.Query(`SELECT month, observations, total, minimum, maximum FROM aggregates WHERE city_id = ? ORDER BY month`, city)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aggregates := []Aggregate{}
+	for rows.Next() {
+		var a Aggregate
+		err := rows.Scan(&a.Month, &a.Count, &a.Sum, &a.Min, &a.Max)
+		if err != nil {
+			return nil, err
+		}
+		aggregates = append(aggregates, a)
+	}
+	return aggregates, rows.Err()
+}
+
+func (s *sqlStore) revisions(city string, dateRange DateRange) (map[string][]Revision, error) {
+	conditions, args := sqlRangeConditions(dateRange)
+	conditions = append([]string{"city_id = ?"}, conditions...)
+	args = append([]interface{}{city}, args...)
+
+	rows, err := s.db.Query(`SELECT date, version, actor, time, old_temperature, new_temperature FROM revisions
+		WHERE `+strings.Join(conditions, " AND ")+` ORDER BY date, version`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := map[string][]Revision{}
+	for rows.Next() {
+		var date, at string
+		var revision Revision
+		var old, new sql.NullInt64
+		err := rows.Scan(&date, &revision.Version, &revision.Actor, &at, &old, &new)
+		if err != nil {
+			return nil, err
+		}
+		revision.Time, err = time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			return nil, err
+		}
+		revision.Old, revision.New = sqlTemperature(old), sqlTemperature(new)
+		history[date] = append(history[date], revision)
+	}
+	return history, rows.Err()
+}
+
+func sqlTemperature(temperature sql.NullInt64) *int {
+	if !temperature.Valid {
+		return nil
+	}
+	value := int(temperature.Int64)
+	return &value
+}
+
+func (s *sqlStore) saveDefaultRetention(policy RetentionPolicy) error {
+	v, err := json.Marshal(toRetentionModel(&policy))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO settings (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`, sqlDefaultRetentionSetting, string(v))
+	return err
+}
+
+func (s *sqlStore) close() error {
+	return s.db.Close()
+}
+
+func (t *sqlTx) cityIDs() ([]string, error) {
+	return queryStrings(t.tx, `SELECT id FROM cities UNION SELECT id FROM deleted_cities`)
+}
+
+// writeTemperatures puts and deletes the dates of key in table that changed.
+func (t *sqlTx) writeTemperatures(table, column, key string, changes temperatureChanges) error {
+	for _, date := range changes.deleted {
+		_, err := t.tx.Exec(`DELETE FROM `+table+` WHERE `+column+` = ? AND date = ?`, key, date)
+		if err != nil {
+			return err
+		}
+	}
+	for date, temperature := range changes.put {
+		_, err := t.tx.Exec(`INSERT INTO `+table+` (`+column+`, date, temperature) VALUES (?, ?, ?)
+			ON CONFLICT (`+column+`, date) DO UPDATE SET temperature = excluded.temperature`, key, date, temperature)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteStation deletes station, and its observations, when it is still
+// stored with city.
+func (t *sqlTx) deleteStation(city, station string) error {
+	result, err := t.tx.Exec(`DELETE FROM stations WHERE id = ? AND city_id = ?`, station, city)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil || deleted == 0 {
+		return err
+	}
+	_, err = t.tx.Exec(`DELETE FROM station_observations WHERE station_id = ?`, station)
+	return err
+}
+
+func (t *sqlTx) putEntry(stored storedCity) error {
+	city := stored.city.City
+
+	var rawDays, aggregateDays interface{}
+	if stored.retention != nil {
+		rawDays, aggregateDays = stored.retention.RawDays, stored.retention.AggregateDays
+	}
+	args := append([]interface{}{city.ID, city.Name, city.Country, city.Region}, sqlCoordinateArgs(city.Coordinates)...)
+	args = append(args, rawDays, aggregateDays)
+	_, err := t.tx.Exec(`INSERT INTO cities (id, name, country, region, latitude, longitude, elevation, raw_retention_days, aggregate_retention_days)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			country = excluded.country,
+			region = excluded.region,
+			latitude = excluded.latitude,
+			longitude = excluded.longitude,
+			elevation = excluded.elevation,
+			raw_retention_days = excluded.raw_retention_days,
+			aggregate_retention_days = excluded.aggregate_retention_days`, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.tx.Exec(`DELETE FROM city_aliases WHERE city_id = ?`, city.ID)
+	if err != nil {
+		return err
+	}
+	for _, alias := range city.Aliases {
+		_, err := t.tx.Exec(`INSERT INTO city_aliases (city_id, alias) VALUES (?, ?) ON CONFLICT DO NOTHING`, city.ID, alias)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sqlTx) putCity(change cityChange) error {
+	id := change.city.city.City.ID
+	if change.entry {
+		err := t.putEntry(change.city)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := t.writeTemperatures("observations", "city_id", id, change.observations)
+	if err != nil {
+		return err
+	}
+
+	for _, month := range change.deletedAggregates {
+		_, err := t.tx.Exec(`DELETE FROM aggregates WHERE city_id = ? AND month = ?`, id, month)
+		if err != nil {
+			return err
+		}
+	}
+	for _, a := range change.aggregates {
+		_, err := t.tx.Exec(`INSERT INTO aggregates (city_id, month, observations, total, minimum, maximum) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (city_id, month) DO UPDATE SET
+				observations = excluded.observations,
+				total = excluded.total,
+				minimum = excluded.minimum,
+				maximum = excluded.maximum`, id, a.Month, a.Count, a.Sum, a.Min, a.Max)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, station := range change.deletedStations {
+		err := t.deleteStation(id, station)
+		if err != nil {
+			return err
+		}
+	}
+	for _, station := range change.stations {
+		args := append([]interface{}{station.ID, id, station.Name, station.Owner}, sqlCoordinateArgs(station.Coordinates)...)
+		_, err := t.tx.Exec(`INSERT INTO stations (id, city_id, name, owner, latitude, longitude, elevation)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				city_id = excluded.city_id,
+				name = excluded.name,
+				owner = excluded.owner,
+				latitude = excluded.latitude,
+				longitude = excluded.longitude,
+				elevation = excluded.elevation`, args...)
+		if err != nil {
+			return err
+		}
+	}
+	for station, readings := range change.readings {
+		if change.newStations[station] {
+			// Readings left by a city the station belonged to before.
+			_, err := t.tx.Exec(`DELETE FROM station_observations WHERE station_id = ?`, station)
+			if err != nil {
+				return err
+			}
+		}
+		err := t.writeTemperatures("station_observations", "station_id", station, readings)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sqlTx) deleteCity(id string) error {
+	stations, err := queryStrings(t.tx, `SELECT id FROM stations WHERE city_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	for _, station := range stations {
+		err := t.deleteStation(id, station)
+		if err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		`DELETE FROM observations WHERE city_id = ?`,
+		`DELETE FROM aggregates WHERE city_id = ?`,
+		`DELETE FROM city_aliases WHERE city_id = ?`,
+		`DELETE FROM cities WHERE id = ?`,
+	} {
+		_, err := t.tx.Exec(query, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sqlTx) putDeleted(deleted storedDeletedCity) error {
+	v, err := json.Marshal(toDeletedCityModel(deleted))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(toSnapshotCityModel(deleted.city))
+	if err != nil {
+		return err
+	}
+
+	id := deleted.city.City.ID
+	_, err = t.tx.Exec(`INSERT INTO deleted_cities (id, deleted_at, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET deleted_at = excluded.deleted_at, data = excluded.data`,
+		id, deleted.deletedAt.UTC().Format(time.RFC3339Nano), string(v))
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.Exec(`INSERT INTO deleted_city_data (id, data) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`, id, string(data))
+	return err
+}
+
+func (t *sqlTx) deleteDeleted(id string) error {
+	for _, query := range []string{
+		`DELETE FROM deleted_city_data WHERE id = ?`,
+		`DELETE FROM deleted_cities WHERE id = ?`,
+	} {
+		_, err := t.tx.Exec(query, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sqlTx) putRevisions(city string, revisions map[string][]Revision) error {
+	for date, list := range revisions {
+		for _, revision := range list {
+			_, err := t.tx.Exec(`INSERT INTO revisions (city_id, date, version, actor, time, old_temperature, new_temperature)
+				SELECT ?1, ?2, COALESCE(MAX(version), 0) + 1, ?3, ?4, ?5, ?6 FROM revisions WHERE city_id = ?1 AND date = ?2`,
+				city, date, revision.Actor, revision.Time.UTC().Format(time.RFC3339Nano), revision.Old, revision.New)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *sqlTx) deleteHistory(city string, dates []string) error {
+	if dates == nil {
+		_, err := t.tx.Exec(`DELETE FROM revisions WHERE city_id = ?`, city)
+		return err
+	}
+	for _, date := range dates {
+		_, err := t.tx.Exec(`DELETE FROM revisions WHERE city_id = ? AND date = ?`, city, date)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
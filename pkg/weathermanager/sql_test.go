@@ -0,0 +1,136 @@
+package weathermanager_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestSQLDatabase(t *testing.T, path string) *sql.DB {
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestSQL_WriteOnlyChangedRows(t *testing.T) {
+	db := openTestSQLDatabase(t, newTestDatabase(t))
+	weatherMgr, err := weathermanager.OpenSQL(db, weathermanager.DefaultOptions())
+	require.NoError(t, err)
+	defer weatherMgr.Close()
+
+	temperatures := map[string]int{}
+	for day := 1; day <= 30; day++ {
+		temperatures[fmt.Sprintf("2020-04-%02d", day)] = day
+	}
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", temperatures))
+	_, err = weatherMgr.RegisterCity(weathermanager.City{Name: "Vancouver", Aliases: []string{"yvr"}})
+	require.NoError(t, err)
+	_, err = weatherMgr.RegisterStation(weathermanager.Station{ID: "yvr-1", City: "vancouver"})
+	require.NoError(t, err)
+	require.NoError(t, weatherMgr.SaveStationObservations("yvr-1", temperatures))
+
+	changes := func() int {
+		var changes int
+		require.NoError(t, db.QueryRow("SELECT total_changes()").Scan(&changes))
+		return changes
+	}
+
+	before := changes()
+	require.NoError(t, weatherMgr.SaveObservation("vancouver", "2020-04-15", 20))
+	assert.Equal(t, 2, changes()-before, "the observation and its revision are written")
+
+	before = changes()
+	require.NoError(t, weatherMgr.DeleteObservation("vancouver", "2020-04-16"))
+	assert.Equal(t, 2, changes()-before, "the observation is deleted and its revision written")
+
+	before = changes()
+	require.NoError(t, weatherMgr.SaveStationObservations("yvr-1", map[string]int{"2020-04-15": 21, "2020-04-16": 16}))
+	assert.Equal(t, 1, changes()-before, "only the changed reading is written")
+}
+
+func TestSQL_MigrateOnce(t *testing.T) {
+	db := openTestSQLDatabase(t, newTestDatabase(t))
+	defer db.Close()
+
+	applied, err := weathermanager.MigrateSQL(db)
+	assert.NoError(t, err)
+	assert.Equal(t, weathermanager.SQLSchemaVersion(), applied)
+
+	applied, err = weathermanager.MigrateSQL(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	var versions, latest int
+	err = db.QueryRow("SELECT COUNT(*), MAX(version) FROM schema_migrations").Scan(&versions, &latest)
+	assert.NoError(t, err)
+	assert.Equal(t, weathermanager.SQLSchemaVersion(), versions)
+	assert.Equal(t, weathermanager.SQLSchemaVersion(), latest)
+}
+
+func TestSQL_RefuseNewerSchema(t *testing.T) {
+	db := openTestSQLDatabase(t, newTestDatabase(t))
+	defer db.Close()
+
+	_, err := weathermanager.MigrateSQL(db)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from the future', '')", weathermanager.SQLSchemaVersion()+1)
+	require.NoError(t, err)
+
+	_, err = weathermanager.OpenSQL(db, weathermanager.DefaultOptions())
+	assert.True(t, errors.Is(err, weathermanager.ErrStorage))
+}
+
+func TestSQL_MigrateDeletedCities_SplitTheirData(t *testing.T) {
+	db := openTestSQLDatabase(t, newTestDatabase(t))
+
+	// A database at version 2 recorded deleted cities with all their data.
+	deletedAt := time.Now().UTC().Format(time.RFC3339)
+	_, err := weathermanager.MigrateSQL(db)
+	require.NoError(t, err)
+	for _, statement := range []string{
+		`DROP TABLE revisions`,
+		`DROP TABLE deleted_city_data`,
+		`DELETE FROM schema_migrations WHERE version > 2`,
+		`INSERT INTO deleted_cities (id, deleted_at, data) VALUES ('toronto', '` + deletedAt + `', '{
+			"city": {
+				"id": "toronto",
+				"name": "toronto",
+				"observations": {"2020-04-18": 9, "2020-04-19": 10},
+				"aggregates": [{"month": "2000-01", "count": 2, "sum": 12, "min": 5, "max": 7}],
+				"stations": [{"id": "yyz-1", "observations": {"2020-04-18": 8}}]
+			},
+			"deleted_at": "` + deletedAt + `"
+		}')`,
+	} {
+		_, err := db.Exec(statement)
+		require.NoError(t, err)
+	}
+
+	weatherMgr, err := weathermanager.OpenSQL(db, weathermanager.DefaultOptions())
+	require.NoError(t, err)
+	defer weatherMgr.Close()
+
+	deleted, err := weatherMgr.ListDeleted()
+	assert.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, 2, deleted[0].Observations)
+	var stations string
+	require.NoError(t, db.QueryRow(`SELECT json_extract(data, '$.city.stations') FROM deleted_cities`).Scan(&stations))
+	assert.JSONEq(t, `[{"id": "yyz-1"}]`, stations, "only the data to restore holds the readings")
+
+	_, err = weatherMgr.UndeleteWeather("toronto")
+	require.NoError(t, err)
+	temperatures, ok := weatherMgr.GetAllWeather("toronto")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int{"2020-04-18": 9, "2020-04-19": 10}, temperatures)
+	observations, err := weatherMgr.StationObservations("toronto", weathermanager.DateRange{})
+	assert.NoError(t, err)
+	assert.Equal(t, []weathermanager.StationObservation{{Station: "yyz-1", Date: "2020-04-18", Temperature: 8}}, observations)
+}
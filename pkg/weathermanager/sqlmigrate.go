@@ -0,0 +1,182 @@
+package weathermanager
+
+import (
+	"database/sql"
+	"time"
+)
+
+type sqlMigration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// sqlMigrations evolve the schema of SQL databases. Migrations are only ever
+// appended: a database records the versions applied to it, and the missing
+// ones are applied in order when it is opened.
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		name:    "create tables",
+		statements: []string{
+			`CREATE TABLE cities (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				country TEXT NOT NULL,
+				region TEXT NOT NULL,
+				latitude REAL,
+				longitude REAL,
+				elevation REAL,
+				raw_retention_days INTEGER,
+				aggregate_retention_days INTEGER
+			)`,
+			`CREATE TABLE city_aliases (
+				city_id TEXT NOT NULL,
+				alias TEXT NOT NULL,
+				PRIMARY KEY (city_id, alias)
+			)`,
+			`CREATE TABLE observations (
+				city_id TEXT NOT NULL,
+				date TEXT NOT NULL,
+				temperature INTEGER NOT NULL,
+				PRIMARY KEY (city_id, date)
+			)`,
+			`CREATE TABLE aggregates (
+				city_id TEXT NOT NULL,
+				month TEXT NOT NULL,
+				observations INTEGER NOT NULL,
+				total INTEGER NOT NULL,
+				minimum INTEGER NOT NULL,
+				maximum INTEGER NOT NULL,
+				PRIMARY KEY (city_id, month)
+			)`,
+			`CREATE TABLE stations (
+				id TEXT PRIMARY KEY,
+				city_id TEXT NOT NULL,
+				name TEXT NOT NULL,
+				owner TEXT NOT NULL,
+				latitude REAL,
+				longitude REAL,
+				elevation REAL
+			)`,
+			`CREATE TABLE station_observations (
+				station_id TEXT NOT NULL,
+				date TEXT NOT NULL,
+				temperature INTEGER NOT NULL,
+				PRIMARY KEY (station_id, date)
+			)`,
+			`CREATE TABLE deleted_cities (
+				id TEXT PRIMARY KEY,
+				deleted_at TEXT NOT NULL,
+				data TEXT NOT NULL
+			)`,
+			`CREATE TABLE settings (
+				name TEXT PRIMARY KEY,
+				value TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		// Ranges of a city are read through the primary key of observations,
+		// these serve queries across cities.
+		version: 2,
+		name:    "index dates and stations",
+		statements: []string{
+			`CREATE INDEX observations_date ON observations (date, city_id)`,
+			`CREATE INDEX station_observations_date ON station_observations (date, station_id)`,
+			`CREATE INDEX stations_city ON stations (city_id)`,
+		},
+	},
+	{
+		// Deleted cities are listed without reading the data they are restored
+		// with, which moves to a table of its own.
+		version: 3,
+		name:    "keep revisions and deleted city data apart",
+		statements: []string{
+			`CREATE TABLE revisions (
+				city_id TEXT NOT NULL,
+				date TEXT NOT NULL,
+				version INTEGER NOT NULL,
+				actor TEXT NOT NULL,
+				time TEXT NOT NULL,
+				old_temperature INTEGER,
+				new_temperature INTEGER,
+				PRIMARY KEY (city_id, date, version)
+			)`,
+			`CREATE TABLE deleted_city_data (
+				id TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			)`,
+			`INSERT INTO deleted_city_data (id, data) SELECT id, json_extract(data, '$.city') FROM deleted_cities`,
+			`UPDATE deleted_cities SET data = json_set(
+				json_remove(data, '$.city.observations', '$.city.aggregates'),
+				'$.observations', (SELECT COUNT(*) FROM json_each(data, '$.city.observations')),
+				'$.city.stations', json(COALESCE((SELECT json_group_array(json_remove(value, '$.observations')) FROM json_each(data, '$.city.stations')), '[]'))
+			)`,
+		},
+	},
+}
+
+// SQLSchemaVersion is the version of the schema created by MigrateSQL.
+func SQLSchemaVersion() int {
+	return sqlMigrations[len(sqlMigrations)-1].version
+}
+
+// MigrateSQL applies the migrations db is missing, each in a transaction of
+// its own, and returns how many were applied. A database migrated by a newer
+// version of the API is refused.
+func MigrateSQL(db *sql.DB) (int, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return 0, StorageError(err, "Error creating schema_migrations")
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return 0, StorageError(err, "Error reading schema version")
+	}
+	if current > SQLSchemaVersion() {
+		return 0, newError(ErrStorage, "Database schema version %d is newer than the supported version %d", current, SQLSchemaVersion())
+	}
+
+	applied := 0
+	for _, migration := range sqlMigrations {
+		if migration.version <= current {
+			continue
+		}
+
+		err := applySQLMigration(db, migration)
+		if err != nil {
+			return applied, StorageError(err, "Error applying migration %d (%s)", migration.version, migration.name)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+func applySQLMigration(db *sql.DB, migration sqlMigration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range migration.statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		migration.version, migration.name, now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,301 @@
+package weathermanager
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Station is a sensor reporting observations for a city. Each station keeps
+// its own values, so stations feeding the same city do not overwrite each
+// other.
+type Station struct {
+	ID          string
+	Name        string
+	City        string
+	Owner       string
+	Coordinates *Coordinates
+}
+
+type StationObservation struct {
+	Station     string
+	Date        string
+	Temperature int
+}
+
+// CombinedObservation is the value of a date reduced from the observations of
+// Stations stations.
+type CombinedObservation struct {
+	Date        string
+	Temperature int
+	Stations    int
+}
+
+// Reducer combines the temperatures reported by several stations for the
+// same date into one.
+type Reducer func([]int) int
+
+var reducers = map[string]Reducer{
+	"mean":   reduceMean,
+	"median": reduceMedian,
+	"min":    reduceMin,
+	"max":    reduceMax,
+}
+
+// ReducerByName returns one of the mean, median, min and max reducers.
+func ReducerByName(name string) (Reducer, error) {
+	reducer, ok := reducers[name]
+	if !ok {
+		return nil, ValidationError("Invalid reducer %s, expected one of %s", name, strings.Join(ReducerNames(), ", "))
+	}
+	return reducer, nil
+}
+
+func ReducerNames() []string {
+	names := []string{}
+	for name := range reducers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func reduceMean(temperatures []int) int {
+	sum := 0
+	for _, t := range temperatures {
+		sum += t
+	}
+	return int(math.Round(float64(sum) / float64(len(temperatures))))
+}
+
+// reduceMedian rounds the mean of the two middle values of an even number of
+// temperatures.
+func reduceMedian(temperatures []int) int {
+	sorted := append([]int{}, temperatures...)
+	sort.Ints(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[middle]
+	}
+	return reduceMean(sorted[middle-1 : middle+1])
+}
+
+func reduceMin(temperatures []int) int {
+	min := temperatures[0]
+	for _, t := range temperatures[1:] {
+		if t < min {
+			min = t
+		}
+	}
+	return min
+}
+
+func reduceMax(temperatures []int) int {
+	max := temperatures[0]
+	for _, t := range temperatures[1:] {
+		if t > max {
+			max = t
+		}
+	}
+	return max
+}
+
+func copyStation(station *Station) Station {
+	s := *station
+	if station.Coordinates != nil {
+		coordinates := *station.Coordinates
+		s.Coordinates = &coordinates
+	}
+	return s
+}
+
+// RegisterStation creates or updates a station of a city, registering the city
+// when no city is known by that name. A station can not be moved to another
+// city, as its observations would move with it.
+func (m *MainWeatherManager) RegisterStation(station Station) (Station, error) {
+	station.ID = CityKey(station.ID)
+	if station.ID == "" {
+		return Station{}, ValidationError("Empty station")
+	}
+	if station.Coordinates != nil {
+		err := validateCoordinates(*station.Coordinates)
+		if err != nil {
+			return Station{}, err
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	city, err := m.cities.ResolveOrRegister(station.City)
+	if err != nil {
+		return Station{}, err
+	}
+	if existing, ok := m.stations[station.ID]; ok && existing.City != city.ID {
+		return Station{}, ConflictError("Station %s already belongs to %s", station.ID, existing.City)
+	}
+
+	station.City = city.ID
+	station.Name = NormalizeCityName(station.Name)
+	if station.Name == "" {
+		station.Name = station.ID
+	}
+	if _, ok := m.weathers[city.ID]; !ok {
+		m.weathers[city.ID] = map[string]int{}
+	}
+	if _, ok := m.readings[station.ID]; !ok {
+		m.readings[station.ID] = map[string]int{}
+	}
+
+	registered := copyStation(&station)
+	m.stations[station.ID] = &registered
+	return copyStation(&registered), nil
+}
+
+func (m *MainWeatherManager) GetStation(id string) (Station, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	station, ok := m.stations[CityKey(id)]
+	if !ok {
+		return Station{}, NotFoundError("Station not found")
+	}
+	return copyStation(station), nil
+}
+
+// ListStations returns the stations of city sorted by ID.
+func (m *MainWeatherManager) ListStations(city string) ([]Station, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return nil, err
+	}
+	return m.stationsOf(id), nil
+}
+
+func (m *MainWeatherManager) stationsOf(city string) []Station {
+	stations := []Station{}
+	for _, station := range m.stations {
+		if station.City == city {
+			stations = append(stations, copyStation(station))
+		}
+	}
+	sort.Slice(stations, func(i, j int) bool {
+		return stations[i].ID < stations[j].ID
+	})
+	return stations
+}
+
+// DeleteStation removes a station and its observations.
+func (m *MainWeatherManager) DeleteStation(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	id = CityKey(id)
+	if _, ok := m.stations[id]; !ok {
+		return NotFoundError("Station not found")
+	}
+
+	delete(m.stations, id)
+	delete(m.readings, id)
+	return nil
+}
+
+// SaveStationObservations merges observations into those of a station.
+func (m *MainWeatherManager) SaveStationObservations(id string, temperatures map[string]int) error {
+	err := validateDates(temperatures)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	readings, ok := m.readings[CityKey(id)]
+	if !ok {
+		return NotFoundError("Station not found")
+	}
+	for k, v := range temperatures {
+		readings[k] = v
+	}
+	return nil
+}
+
+// StationObservations returns the observations of every station of city within
+// dateRange, sorted by date and station.
+func (m *MainWeatherManager) StationObservations(city string, dateRange DateRange) ([]StationObservation, error) {
+	if city == "" {
+		return nil, ValidationError("Empty city")
+	}
+
+	bounds, err := dateRange.bounds()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return nil, err
+	}
+
+	observations := []StationObservation{}
+	for _, station := range m.stationsOf(id) {
+		for date, temperature := range m.readings[station.ID] {
+			observationDate, _ := time.Parse(dateLayout, date)
+			if bounds.contains(observationDate) {
+				observations = append(observations, StationObservation{
+					Station:     station.ID,
+					Date:        date,
+					Temperature: temperature,
+				})
+			}
+		}
+	}
+
+	sort.Slice(observations, func(i, j int) bool {
+		if observations[i].Date != observations[j].Date {
+			return observations[i].Date < observations[j].Date
+		}
+		return observations[i].Station < observations[j].Station
+	})
+	return observations, nil
+}
+
+// CombineStationObservations reduces the observations of the stations of city
+// within dateRange to one value per date.
+func (m *MainWeatherManager) CombineStationObservations(city string, dateRange DateRange, reducer Reducer) ([]CombinedObservation, error) {
+	observations, err := m.StationObservations(city, dateRange)
+	if err != nil {
+		return nil, err
+	}
+	return combineObservations(observations, reducer), nil
+}
+
+// combineObservations reduces station observations, sorted by date, to one
+// value per date.
+func combineObservations(observations []StationObservation, reducer Reducer) []CombinedObservation {
+	combined := []CombinedObservation{}
+	for start := 0; start < len(observations); {
+		end := start
+		temperatures := []int{}
+		for end < len(observations) && observations[end].Date == observations[start].Date {
+			temperatures = append(temperatures, observations[end].Temperature)
+			end++
+		}
+
+		combined = append(combined, CombinedObservation{
+			Date:        observations[start].Date,
+			Temperature: reducer(temperatures),
+			Stations:    len(temperatures),
+		})
+		start = end
+	}
+	return combined
+}
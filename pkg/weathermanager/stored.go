@@ -0,0 +1,1305 @@
+package weathermanager
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// store persists the state of a StoredWeatherManager. Only the registry
+// entries, stations and retention of the cities are loaded when it is opened;
+// their observations, readings, aggregates and history are read when needed.
+type store interface {
+	// load reads every city and deleted city, without their observations,
+	// readings and aggregates, and the default retention, which is nil when
+	// it was never saved.
+	load() ([]storedCity, []storedDeletedCity, *RetentionPolicy, error)
+	// historySince returns when the store started keeping the revision
+	// history.
+	historySince() (time.Time, error)
+	// loadCity reads everything stored for a city, nil when it is not.
+	loadCity(id string) (*storedCity, error)
+	// loadDeleted reads everything stored for a deleted city, nil when it is
+	// not.
+	loadDeleted(id string) (*storedDeletedCity, error)
+	// stats sums up the data of the stored cities with the given IDs.
+	stats(ids []string) (map[string]cityStats, error)
+	// scan reads at most limit observations of a city within dateRange,
+	// sorted by date.
+	scan(city string, dateRange DateRange, limit int) ([]string, []int, error)
+	// scanReadings reads at most limit readings of a station within
+	// dateRange, sorted by date.
+	scanReadings(station string, dateRange DateRange, limit int) ([]string, []int, error)
+	// aggregates reads the aggregates of a city, oldest first.
+	aggregates(city string) ([]Aggregate, error)
+	// revisions reads the revisions of the observations of a city within
+	// dateRange, oldest first.
+	revisions(city string, dateRange DateRange) (map[string][]Revision, error)
+	// update runs fn in a single transaction, committed when fn succeeds.
+	update(fn func(storeTx) error) error
+	saveDefaultRetention(RetentionPolicy) error
+	close() error
+}
+
+// storeTx writes to a store within a transaction.
+type storeTx interface {
+	// cityIDs lists the IDs of the stored cities and deleted cities.
+	cityIDs() ([]string, error)
+	// putCity writes what a write changed in a city. Deleted stations are
+	// only deleted when they are still stored with the city.
+	putCity(change cityChange) error
+	deleteCity(id string) error
+	putDeleted(city storedDeletedCity) error
+	deleteDeleted(id string) error
+	// putRevisions appends revisions to the history of a city. They are
+	// numbered from 1 for each date, and stored after the revisions of the
+	// date already stored.
+	putRevisions(city string, revisions map[string][]Revision) error
+	// deleteHistory deletes the revisions of a city on dates, or all of them
+	// when dates is nil.
+	deleteHistory(city string, dates []string) error
+}
+
+type storedCity struct {
+	city      SnapshotCity
+	retention *RetentionPolicy
+}
+
+type storedDeletedCity struct {
+	storedCity
+	observations int
+	deletedAt    time.Time
+}
+
+// cityChange is what a write changed in a stored city, so stores only write
+// the rows it touched.
+type cityChange struct {
+	// city is the state of the city after the write.
+	city storedCity
+	// entry is set when the registry entry of the city or its retention
+	// changed.
+	entry             bool
+	observations      temperatureChanges
+	aggregates        []Aggregate
+	deletedAggregates []string
+	// stations are the new or changed stations, and newStations the ones
+	// that were not stored with the city before, whose readings are written
+	// from scratch.
+	stations        []Station
+	newStations     map[string]bool
+	deletedStations []string
+	readings        map[string]temperatureChanges
+}
+
+// recordChanged tells whether anything but observations and readings changed.
+func (c cityChange) recordChanged() bool {
+	return c.entry || len(c.aggregates) > 0 || len(c.deletedAggregates) > 0 || len(c.stations) > 0 || len(c.deletedStations) > 0
+}
+
+// temperatureChanges are the dates a write put or deleted.
+type temperatureChanges struct {
+	put     map[string]int
+	deleted []string
+}
+
+func diffTemperatures(before, after map[string]int) temperatureChanges {
+	changes := temperatureChanges{put: map[string]int{}}
+	for date := range before {
+		if _, ok := after[date]; !ok {
+			changes.deleted = append(changes.deleted, date)
+		}
+	}
+	for date, temperature := range after {
+		if previous, ok := before[date]; !ok || previous != temperature {
+			changes.put[date] = temperature
+		}
+	}
+	return changes
+}
+
+// diffCity compares the state of a city before a write, nil when it was not
+// stored, with its state after.
+func diffCity(before *storedCity, after storedCity) cityChange {
+	if before == nil {
+		before = &storedCity{}
+	}
+	change := cityChange{
+		city:         after,
+		entry:        !reflect.DeepEqual(before.city.City, after.city.City) || !reflect.DeepEqual(before.retention, after.retention),
+		observations: diffTemperatures(before.city.Observations, after.city.Observations),
+		newStations:  map[string]bool{},
+		readings:     map[string]temperatureChanges{},
+	}
+
+	aggregates := map[string]Aggregate{}
+	for _, aggregate := range before.city.Aggregates {
+		aggregates[aggregate.Month] = aggregate
+	}
+	for _, aggregate := range after.city.Aggregates {
+		if previous, ok := aggregates[aggregate.Month]; !ok || previous != aggregate {
+			change.aggregates = append(change.aggregates, aggregate)
+		}
+		delete(aggregates, aggregate.Month)
+	}
+	for month := range aggregates {
+		change.deletedAggregates = append(change.deletedAggregates, month)
+	}
+
+	stations := map[string]SnapshotStation{}
+	for _, s := range before.city.Stations {
+		stations[s.Station.ID] = s
+	}
+	for _, s := range after.city.Stations {
+		previous, ok := stations[s.Station.ID]
+		if !ok {
+			change.newStations[s.Station.ID] = true
+		}
+		if !ok || !reflect.DeepEqual(previous.Station, s.Station) {
+			change.stations = append(change.stations, s.Station)
+		}
+		change.readings[s.Station.ID] = diffTemperatures(previous.Observations, s.Observations)
+		delete(stations, s.Station.ID)
+	}
+	for id := range stations {
+		change.deletedStations = append(change.deletedStations, id)
+	}
+	return change
+}
+
+type retentionModel struct {
+	RawDays       int `json:"raw_days"`
+	AggregateDays int `json:"aggregate_days"`
+}
+
+func toRetentionModel(policy *RetentionPolicy) *retentionModel {
+	if policy == nil {
+		return nil
+	}
+	return &retentionModel{RawDays: policy.RawDays, AggregateDays: policy.AggregateDays}
+}
+
+func (m *retentionModel) policy() *RetentionPolicy {
+	if m == nil {
+		return nil
+	}
+	return &RetentionPolicy{RawDays: m.RawDays, AggregateDays: m.AggregateDays}
+}
+
+// deletedCityModel is how stores record a deleted city: what is needed to
+// list it and to tell whether it can be restored. What it is restored with is
+// recorded apart, as a snapshotCityModel.
+type deletedCityModel struct {
+	City         snapshotCityModel `json:"city"`
+	Retention    *retentionModel   `json:"retention,omitempty"`
+	DeletedAt    time.Time         `json:"deleted_at"`
+	Observations int               `json:"observations"`
+}
+
+func toDeletedCityModel(deleted storedDeletedCity) deletedCityModel {
+	return deletedCityModel{
+		City:         cityEntryModel(deleted.city),
+		Retention:    toRetentionModel(deleted.retention),
+		DeletedAt:    deleted.deletedAt,
+		Observations: deleted.observations,
+	}
+}
+
+func (m deletedCityModel) deletedCity() storedDeletedCity {
+	return storedDeletedCity{
+		storedCity:   storedCity{city: fromSnapshotCityModel(m.City), retention: m.Retention.policy()},
+		observations: m.Observations,
+		deletedAt:    m.DeletedAt,
+	}
+}
+
+// cityEntryModel returns the model of city without its observations,
+// aggregates and readings.
+func cityEntryModel(city SnapshotCity) snapshotCityModel {
+	model := toSnapshotCityModel(city)
+	model.Observations = nil
+	model.Aggregates = nil
+	for i := range model.Stations {
+		model.Stations[i].Observations = nil
+	}
+	return model
+}
+
+// StoredWeatherManager keeps reports in a store, such as a bbolt or SQL
+// database, so they survive restarts. Only the names, locations, stations and
+// retention policies of the cities are kept in memory, indexed as by
+// MainWeatherManager. Observations, readings, aggregates and the revision
+// history are read from the store, ranges with a scan.
+//
+// Writes run one at a time: each loads the data of the cities it touches from
+// the store, applies the change in memory as MainWeatherManager does, and
+// persists it in a single transaction, writing only the rows it changed and
+// the revisions it recorded. The data is dropped from memory once the write is
+// done. A write that can not be persisted fails with ErrStorage and the cities
+// are put back in memory as they were before it.
+type StoredWeatherManager struct {
+	*MainWeatherManager
+	store  store
+	writes *sync.Mutex
+}
+
+func openStored(s store, options Options) (*StoredWeatherManager, error) {
+	m := &StoredWeatherManager{MainWeatherManager: NewWithOptions(options), store: s, writes: &sync.Mutex{}}
+
+	since, err := s.historySince()
+	if err != nil {
+		return nil, err
+	}
+	m.historySince = since
+
+	cities, deleted, retention, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if retention != nil {
+		m.options.Retention = *retention
+	}
+	for _, city := range cities {
+		err := m.loadCity(city)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, city := range deleted {
+		m.loadDeleted(city)
+	}
+	return m, nil
+}
+
+func (m *StoredWeatherManager) Close() error {
+	return m.store.close()
+}
+
+// loadCity puts the registry entry, stations and retention of a stored city
+// in memory. Its report stays empty, but while a write has its data loaded.
+func (m *StoredWeatherManager) loadCity(stored storedCity) error {
+	registered, err := m.cities.Register(stored.city.City)
+	if err != nil {
+		return err
+	}
+
+	id := registered.ID
+	m.weathers[id] = map[string]int{}
+	m.datesChanged(id)
+	if registered.Coordinates != nil {
+		m.locations.put(id, *registered.Coordinates)
+	}
+	if stored.retention != nil {
+		m.retention[id] = *stored.retention
+	}
+	for _, s := range stored.city.Stations {
+		station := s.Station
+		station.City = id
+		m.stations[station.ID] = &station
+	}
+	return nil
+}
+
+// loadDeleted puts the tombstone of a stored deleted city in memory, without
+// the data it is restored with.
+func (m *StoredWeatherManager) loadDeleted(stored storedDeletedCity) {
+	t := &tombstone{
+		city:         stored.city.City,
+		observations: stored.observations,
+		stations:     []Station{},
+		retention:    stored.retention,
+		deletedAt:    stored.deletedAt,
+	}
+	for _, s := range stored.city.Stations {
+		t.stations = append(t.stations, s.Station)
+	}
+	m.deleted[stored.city.City.ID] = t
+}
+
+func (m *StoredWeatherManager) storedDeleted(t *tombstone) storedDeletedCity {
+	city := SnapshotCity{
+		City:         t.city,
+		Observations: t.weathers,
+		Aggregates:   []Aggregate{},
+		Stations:     []SnapshotStation{},
+	}
+	for _, aggregate := range t.aggregates {
+		city.Aggregates = append(city.Aggregates, *aggregate)
+	}
+	for _, station := range t.stations {
+		city.Stations = append(city.Stations, SnapshotStation{Station: station, Observations: t.readings[station.ID]})
+	}
+	return storedDeletedCity{
+		storedCity:   storedCity{city: city, retention: t.retention},
+		observations: t.observations,
+		deletedAt:    t.deletedAt,
+	}
+}
+
+func aggregatesByMonth(aggregates []Aggregate) map[string]*Aggregate {
+	if len(aggregates) == 0 {
+		return nil
+	}
+	byMonth := map[string]*Aggregate{}
+	for i := range aggregates {
+		aggregate := aggregates[i]
+		byMonth[aggregate.Month] = &aggregate
+	}
+	return byMonth
+}
+
+// cityBackup is the state of a city before a write: what is stored for it,
+// nil when it does not exist, and its tombstone in memory.
+type cityBackup struct {
+	id      string
+	city    *storedCity
+	deleted *tombstone
+}
+
+// loadWrite reads the data of the cities with the given IDs, or of every
+// city when all is set, from the store and puts it in memory for a write. It
+// returns what is stored for each city, to tell what the write changed.
+func (m *StoredWeatherManager) loadWrite(ids []string, all bool) ([]cityBackup, error) {
+	if all {
+		m.mutex.RLock()
+		for id := range m.weathers {
+			ids = append(ids, id)
+		}
+		for id := range m.deleted {
+			ids = append(ids, id)
+		}
+		m.mutex.RUnlock()
+	}
+
+	backups := []cityBackup{}
+	deleted := map[string]*storedDeletedCity{}
+	loaded := map[string]bool{"": true}
+	for _, id := range ids {
+		if loaded[id] {
+			continue
+		}
+		loaded[id] = true
+
+		city, err := m.store.loadCity(id)
+		if err != nil {
+			return nil, err
+		}
+		deleted[id], err = m.store.loadDeleted(id)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, cityBackup{id: id, city: city})
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i := range backups {
+		b := &backups[i]
+		if _, ok := m.weathers[b.id]; ok && b.city != nil {
+			m.putData(b.id, b.city.city)
+		}
+		b.deleted = m.deleted[b.id]
+		if b.deleted != nil && deleted[b.id] != nil {
+			putTombstoneData(b.deleted, deleted[b.id].city)
+		}
+	}
+	return backups, nil
+}
+
+// putData puts the observations, aggregates and readings of a stored city in
+// memory, copied as the write changes them.
+func (m *StoredWeatherManager) putData(id string, city SnapshotCity) {
+	m.weathers[id] = copyTemperatures(city.Observations)
+	m.datesChanged(id)
+	if aggregates := aggregatesByMonth(city.Aggregates); aggregates != nil {
+		m.aggregates[id] = aggregates
+	}
+
+	readings := map[string]map[string]int{}
+	for _, s := range city.Stations {
+		readings[s.Station.ID] = s.Observations
+	}
+	for _, station := range m.stationsOf(id) {
+		m.readings[station.ID] = copyTemperatures(readings[station.ID])
+	}
+}
+
+func putTombstoneData(t *tombstone, city SnapshotCity) {
+	t.weathers = city.Observations
+	t.aggregates = aggregatesByMonth(city.Aggregates)
+	t.readings = map[string]map[string]int{}
+	for _, s := range city.Stations {
+		t.readings[s.Station.ID] = s.Observations
+	}
+}
+
+// unload drops the data loaded for a write from memory once it is persisted
+// or rolled back.
+func (m *StoredWeatherManager) unload(backups []cityBackup) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, b := range backups {
+		if _, ok := m.weathers[b.id]; ok {
+			m.weathers[b.id] = map[string]int{}
+		}
+		m.datesChanged(b.id)
+		if t := m.deleted[b.id]; t != nil {
+			t.weathers, t.aggregates, t.readings = nil, nil, nil
+		}
+	}
+	m.readings = map[string]map[string]int{}
+	m.aggregates = map[string]map[string]*Aggregate{}
+	m.history = map[string]map[string][]Revision{}
+}
+
+// persist writes what changed in the backed up cities, in a single
+// transaction. When all is set, the cities stored but no longer known are
+// deleted too.
+func (m *StoredWeatherManager) persist(backups []cityBackup, all bool) error {
+	err := m.store.update(func(tx storeTx) error {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+
+		persisted := map[string]bool{}
+		for _, b := range backups {
+			persisted[b.id] = true
+			err := m.persistCity(tx, b)
+			if err != nil {
+				return err
+			}
+		}
+		if !all {
+			return nil
+		}
+
+		stored, err := tx.cityIDs()
+		if err != nil {
+			return err
+		}
+		for _, id := range stored {
+			if persisted[id] || m.known(id) {
+				continue
+			}
+			persisted[id] = true
+
+			err := tx.deleteCity(id)
+			if err != nil {
+				return err
+			}
+			err = tx.deleteDeleted(id)
+			if err != nil {
+				return err
+			}
+			err = tx.deleteHistory(id, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return StorageError(err, "Error saving weather")
+	}
+	return nil
+}
+
+// known tells whether a city is in memory, live or deleted.
+func (m *StoredWeatherManager) known(id string) bool {
+	_, live := m.weathers[id]
+	_, deleted := m.deleted[id]
+	return live || deleted
+}
+
+func (m *StoredWeatherManager) persistCity(tx storeTx, b cityBackup) error {
+	var err error
+	if _, ok := m.weathers[b.id]; ok {
+		err = tx.putCity(diffCity(b.city, m.storedCity(b.id)))
+	} else if b.city != nil {
+		err = tx.deleteCity(b.id)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = m.persistHistory(tx, b)
+	if err != nil {
+		return err
+	}
+
+	t := m.deleted[b.id]
+	switch {
+	case t == b.deleted:
+		return nil
+	case t != nil:
+		return tx.putDeleted(m.storedDeleted(t))
+	default:
+		return tx.deleteDeleted(b.id)
+	}
+}
+
+// persistHistory writes the revisions a write recorded for a city, and
+// deletes the history it dropped: that of the observations rolled up by
+// retention, which are removed without a revision, or all of it once the city
+// is purged.
+func (m *StoredWeatherManager) persistHistory(tx storeTx, b cityBackup) error {
+	history := m.history[b.id]
+	if len(history) > 0 {
+		err := tx.putRevisions(b.id, history)
+		if err != nil {
+			return err
+		}
+	}
+
+	saved, live := m.weathers[b.id]
+	if !m.known(b.id) && (b.city != nil || b.deleted != nil) {
+		return tx.deleteHistory(b.id, nil)
+	}
+	if !live || b.city == nil {
+		return nil
+	}
+
+	rolledUp := []string{}
+	for date := range b.city.city.Observations {
+		if _, ok := saved[date]; !ok && len(history[date]) == 0 {
+			rolledUp = append(rolledUp, date)
+		}
+	}
+	if len(rolledUp) == 0 {
+		return nil
+	}
+	return tx.deleteHistory(b.id, rolledUp)
+}
+
+func (m *StoredWeatherManager) storedCity(id string) storedCity {
+	city := storedCity{city: m.snapshotCity(id)}
+	if policy, ok := m.retention[id]; ok {
+		city.retention = &policy
+	}
+	return city
+}
+
+// write applies change, a write to the cities with the IDs resolve returns
+// (or to any city when all is set), in memory and persists them. The IDs are
+// resolved once no other write can run, so they are the cities change
+// touches, and their data is loaded from the store for change. When they can
+// not be persisted, the cities are put back as they were before change.
+func (m *StoredWeatherManager) write(resolve func() ([]string, error), all bool, change func() error) error {
+	m.writes.Lock()
+	defer m.writes.Unlock()
+
+	ids, err := resolve()
+	if err != nil {
+		return err
+	}
+
+	backups, err := m.loadWrite(ids, all)
+	if err != nil {
+		return StorageError(err, "Error reading weather")
+	}
+	defer m.unload(backups)
+
+	err = change()
+	if err != nil || len(backups) == 0 {
+		return err
+	}
+
+	err = m.persist(backups, all)
+	if err != nil {
+		m.mutex.Lock()
+		m.rollBack(backups)
+		m.mutex.Unlock()
+	}
+	return err
+}
+
+// rollBack puts the cities back as they were when backed up. Every city is
+// removed before any is loaded again, as a write may move stations between
+// them. Their data is dropped by unload.
+func (m *StoredWeatherManager) rollBack(backups []cityBackup) {
+	for _, b := range backups {
+		for _, station := range m.stationsOf(b.id) {
+			delete(m.stations, station.ID)
+		}
+		delete(m.weathers, b.id)
+		delete(m.retention, b.id)
+		m.cities.Remove(b.id)
+		m.locations.remove(b.id)
+	}
+
+	for _, b := range backups {
+		if b.city != nil {
+			// Registered before the write, so it registers again.
+			m.loadCity(*b.city)
+		}
+		if b.deleted != nil {
+			m.deleted[b.id] = b.deleted
+		} else {
+			delete(m.deleted, b.id)
+		}
+	}
+}
+
+// cityID returns the ID city resolves to, or "" when it does not resolve.
+func (m *StoredWeatherManager) cityID(city string) string {
+	registered, err := m.ResolveCity(city)
+	if err != nil {
+		return ""
+	}
+	return registered.ID
+}
+
+// writeID returns the ID of the city a write to city touches: the city it
+// resolves to or, when none does, the city the write registers.
+func (m *StoredWeatherManager) writeID(city string) string {
+	id := m.cityID(city)
+	if id == "" {
+		return CityKey(city)
+	}
+	return id
+}
+
+// writeIDs resolves the IDs of the cities writes to cities touch.
+func (m *StoredWeatherManager) writeIDs(cities ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		ids := []string{}
+		for _, city := range cities {
+			ids = append(ids, m.writeID(city))
+		}
+		return ids, nil
+	}
+}
+
+// cityIDs resolves the IDs of the existing cities named cities.
+func (m *StoredWeatherManager) cityIDs(cities ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		ids := []string{}
+		for _, city := range cities {
+			ids = append(ids, m.cityID(city))
+		}
+		return ids, nil
+	}
+}
+
+// staticIDs returns ids as they are, for writes whose cities are known
+// beforehand.
+func staticIDs(ids ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		return ids, nil
+	}
+}
+
+// stationCityID resolves the ID of the city the station with the given ID
+// belongs to.
+func (m *StoredWeatherManager) stationCityID(id string) func() ([]string, error) {
+	return func() ([]string, error) {
+		station, err := m.GetStation(id)
+		if err != nil {
+			return nil, err
+		}
+		return []string{station.City}, nil
+	}
+}
+
+// liveIDs returns the IDs of the cities in memory that are not deleted.
+func (m *StoredWeatherManager) liveIDs() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	ids := []string{}
+	for id := range m.weathers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// lookupID returns the ID of the city a read is about.
+func (m *StoredWeatherManager) lookupID(city string) (string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.lookup(city, "Weather report not found")
+}
+
+// scanner reads the dates of key with scan, a scan of the store, for
+// iterateBatches.
+func scanner(scan func(string, DateRange, int) ([]string, []int, error), key string) func(DateRange, int) ([]string, []int, error) {
+	return func(dateRange DateRange, limit int) ([]string, []int, error) {
+		dates, temperatures, err := scan(key, dateRange, limit)
+		if err != nil {
+			return nil, nil, StorageError(err, "Error reading weather")
+		}
+		return dates, temperatures, nil
+	}
+}
+
+func (m *StoredWeatherManager) WithActor(actor string) WeatherManager {
+	return &StoredWeatherManager{
+		MainWeatherManager: &MainWeatherManager{state: m.state, actor: actor},
+		store:              m.store,
+		writes:             m.writes,
+	}
+}
+
+func (m *StoredWeatherManager) SaveWeather(city string, temperatures map[string]int) error {
+	return m.write(m.writeIDs(city), false, func() error {
+		return m.MainWeatherManager.SaveWeather(city, temperatures)
+	})
+}
+
+func (m *StoredWeatherManager) MergeWeather(city string, temperatures map[string]int) error {
+	return m.write(m.writeIDs(city), false, func() error {
+		return m.MainWeatherManager.MergeWeather(city, temperatures)
+	})
+}
+
+// ImportWeather persists the cities merged before a failure too, as they
+// stay merged in memory.
+func (m *StoredWeatherManager) ImportWeather(weathers map[string]map[string]int) error {
+	cities := []string{}
+	for city := range weathers {
+		cities = append(cities, city)
+	}
+
+	var err error
+	persistErr := m.write(m.writeIDs(cities...), false, func() error {
+		err = m.MainWeatherManager.ImportWeather(weathers)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return persistErr
+}
+
+func (m *StoredWeatherManager) GetWeather(city string, initialDate string, endDate string) (map[string]int, error) {
+	return getWeather(m, city, initialDate, endDate)
+}
+
+func (m *StoredWeatherManager) IterateWeather(city string, initialDate string, endDate string, fn func(string, int) bool) error {
+	return iterateWeather(m, city, initialDate, endDate, fn)
+}
+
+func (m *StoredWeatherManager) IterateRange(city string, dateRange DateRange, fn func(string, int) bool) error {
+	return m.IterateRangeAsOf(city, dateRange, time.Time{}, fn)
+}
+
+// IterateRangeAsOf scans the observations of city from the store. Past
+// observations are rebuilt from the revisions stored.
+func (m *StoredWeatherManager) IterateRangeAsOf(city string, dateRange DateRange, asOf time.Time, fn func(string, int) bool) error {
+	if city == "" {
+		return ValidationError("Empty city")
+	}
+
+	id, err := m.lookupID(city)
+	if err != nil {
+		return err
+	}
+
+	_, err = dateRange.bounds()
+	if err != nil {
+		return err
+	}
+	err = m.checkAsOf(asOf)
+	if err != nil {
+		return err
+	}
+
+	if !asOf.IsZero() {
+		dates, temperatures, err := m.readStoredAsOf(id, dateRange, asOf)
+		if err != nil {
+			return err
+		}
+		for i, date := range dates {
+			if !fn(date, temperatures[i]) {
+				break
+			}
+		}
+		return nil
+	}
+
+	// As for MainWeatherManager, the callback runs between batches, so a slow
+	// consumer does not hold a transaction open.
+	return iterateBatches(dateRange, scanner(m.store.scan, id), fn)
+}
+
+// readStoredAsOf returns the observations of city within dateRange as they
+// were at asOf, sorted by date, from their current values and revisions. The
+// values are read first, so a write in between only adds revisions, which
+// take precedence.
+func (m *StoredWeatherManager) readStoredAsOf(city string, dateRange DateRange, asOf time.Time) ([]string, []int, error) {
+	current := map[string]int{}
+	err := iterateBatches(dateRange, scanner(m.store.scan, city), func(date string, temperature int) bool {
+		current[date] = temperature
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history, err := m.store.revisions(city, dateRange)
+	if err != nil {
+		return nil, nil, StorageError(err, "Error reading history")
+	}
+
+	saved := map[string]int{}
+	for date, temperature := range current {
+		temperature := temperature
+		if value := valueAsOf(history[date], &temperature, asOf); value != nil {
+			saved[date] = *value
+		}
+	}
+	for date, revisions := range history {
+		if _, ok := current[date]; ok {
+			continue
+		}
+		if value := valueAsOf(revisions, nil, asOf); value != nil {
+			saved[date] = *value
+		}
+	}
+
+	dates := sortedKeys(saved)
+	return dates, temperaturesOf(saved, dates), nil
+}
+
+func (m *StoredWeatherManager) GetAllWeather(city string) (map[string]int, bool) {
+	id, err := m.lookupID(city)
+	if err != nil {
+		return nil, false
+	}
+
+	temperatures := map[string]int{}
+	err = iterateBatches(DateRange{}, scanner(m.store.scan, id), func(date string, temperature int) bool {
+		temperatures[date] = temperature
+		return true
+	})
+	if err != nil {
+		log.Printf("Error reading %s (%s)", id, err.Error())
+		return nil, false
+	}
+	return temperatures, true
+}
+
+func (m *StoredWeatherManager) GetObservation(city string, date string) (int, bool) {
+	id, err := m.lookupID(city)
+	if err != nil {
+		return 0, false
+	}
+
+	dates, temperatures, err := m.store.scan(id, SingleDay(date), 1)
+	if err != nil {
+		log.Printf("Error reading %s on %s (%s)", id, date, err.Error())
+		return 0, false
+	}
+	if len(dates) == 0 {
+		return 0, false
+	}
+	return temperatures[0], true
+}
+
+func (m *StoredWeatherManager) DeleteWeather(city string) error {
+	return m.write(m.cityIDs(city), false, func() error {
+		return m.MainWeatherManager.DeleteWeather(city)
+	})
+}
+
+func (m *StoredWeatherManager) SaveObservation(city string, date string, temperature int) error {
+	return m.MergeWeather(city, map[string]int{date: temperature})
+}
+
+func (m *StoredWeatherManager) DeleteObservation(city string, date string) error {
+	return m.write(m.cityIDs(city), false, func() error {
+		return m.MainWeatherManager.DeleteObservation(city, date)
+	})
+}
+
+func (m *StoredWeatherManager) ListCities(options ListCitiesOptions) (CityPage, error) {
+	ids := m.liveIDs()
+	stats, err := m.store.stats(ids)
+	if err != nil {
+		return CityPage{}, StorageError(err, "Error reading weather")
+	}
+
+	m.mutex.RLock()
+	summaries := []CitySummary{}
+	for _, id := range ids {
+		if city, ok := m.cities.Get(id); ok {
+			summaries = append(summaries, summarizeStats(city, stats[id]))
+		}
+	}
+	m.mutex.RUnlock()
+
+	return PageCities(summaries, options)
+}
+
+func (m *StoredWeatherManager) RegisterCity(city City) (City, error) {
+	var registered City
+	id := CityID(city.Name, city.Region, city.Country)
+	err := m.write(staticIDs(id), false, func() error {
+		var err error
+		registered, err = m.MainWeatherManager.RegisterCity(city)
+		return err
+	})
+	if err != nil {
+		return City{}, err
+	}
+	return registered, nil
+}
+
+func (m *StoredWeatherManager) NearestCities(point Coordinates, limit int, radiusKm float64) ([]NearbyCity, error) {
+	found, err := m.nearestCities(point, limit, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+	return m.completeNearbyFromStore(found)
+}
+
+func (m *StoredWeatherManager) CitiesWithin(box BoundingBox) ([]NearbyCity, error) {
+	found, err := m.citiesWithin(box)
+	if err != nil {
+		return nil, err
+	}
+	return m.completeNearbyFromStore(found)
+}
+
+func (m *StoredWeatherManager) completeNearbyFromStore(found []NearbyCity) ([]NearbyCity, error) {
+	ids := []string{}
+	for _, city := range found {
+		ids = append(ids, city.City.ID)
+	}
+	stats, err := m.store.stats(ids)
+	if err != nil {
+		return nil, StorageError(err, "Error reading weather")
+	}
+	return completeNearby(found, func(id string) cityStats {
+		return stats[id]
+	}), nil
+}
+
+func (m *StoredWeatherManager) RegisterStation(station Station) (Station, error) {
+	var registered Station
+	err := m.write(m.writeIDs(station.City), false, func() error {
+		var err error
+		registered, err = m.MainWeatherManager.RegisterStation(station)
+		return err
+	})
+	if err != nil {
+		return Station{}, err
+	}
+	return registered, nil
+}
+
+func (m *StoredWeatherManager) DeleteStation(id string) error {
+	return m.write(m.stationCityID(id), false, func() error {
+		return m.MainWeatherManager.DeleteStation(id)
+	})
+}
+
+func (m *StoredWeatherManager) SaveStationObservations(id string, temperatures map[string]int) error {
+	return m.write(m.stationCityID(id), false, func() error {
+		return m.MainWeatherManager.SaveStationObservations(id, temperatures)
+	})
+}
+
+// StationObservations scans the readings of each station of city from the
+// store.
+func (m *StoredWeatherManager) StationObservations(city string, dateRange DateRange) ([]StationObservation, error) {
+	if city == "" {
+		return nil, ValidationError("Empty city")
+	}
+
+	_, err := dateRange.bounds()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	id, err := m.lookup(city, "Weather report not found")
+	stations := m.stationsOf(id)
+	m.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	observations := []StationObservation{}
+	for _, station := range stations {
+		err := iterateBatches(dateRange, scanner(m.store.scanReadings, station.ID), func(date string, temperature int) bool {
+			observations = append(observations, StationObservation{
+				Station:     station.ID,
+				Date:        date,
+				Temperature: temperature,
+			})
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(observations, func(i, j int) bool {
+		return observations[i].Date < observations[j].Date
+	})
+	return observations, nil
+}
+
+func (m *StoredWeatherManager) CombineStationObservations(city string, dateRange DateRange, reducer Reducer) ([]CombinedObservation, error) {
+	observations, err := m.StationObservations(city, dateRange)
+	if err != nil {
+		return nil, err
+	}
+	return combineObservations(observations, reducer), nil
+}
+
+// ObservationHistory reads the revisions of the observation from the store.
+// An observation saved before the store kept history has no revisions to
+// list.
+func (m *StoredWeatherManager) ObservationHistory(city string, date string) ([]Revision, error) {
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		return nil, ValidationError("Invalid date %s (%s)", date, err.Error())
+	}
+
+	id, err := m.lookupID(city)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := m.store.revisions(id, SingleDay(date))
+	if err != nil {
+		return nil, StorageError(err, "Error reading history")
+	}
+	if revisions := history[date]; len(revisions) > 0 {
+		return revisions, nil
+	}
+
+	dates, _, err := m.store.scan(id, SingleDay(date), 1)
+	if err != nil {
+		return nil, StorageError(err, "Error reading weather")
+	}
+	if len(dates) == 0 {
+		return nil, NotFoundError("Observation not found")
+	}
+	return []Revision{}, nil
+}
+
+// UndeleteWeather persists the deleted cities purged on the way too.
+func (m *StoredWeatherManager) UndeleteWeather(city string) (City, error) {
+	resolve := func() ([]string, error) {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+		return append(m.expiredDeleted(), CityKey(city)), nil
+	}
+
+	var registered City
+	err := m.write(resolve, false, func() error {
+		var err error
+		registered, err = m.MainWeatherManager.UndeleteWeather(city)
+		return err
+	})
+	if err != nil {
+		return City{}, err
+	}
+	return registered, nil
+}
+
+func (m *StoredWeatherManager) SetDefaultRetention(policy RetentionPolicy) error {
+	m.writes.Lock()
+	defer m.writes.Unlock()
+
+	previous := m.DefaultRetention()
+	err := m.MainWeatherManager.SetDefaultRetention(policy)
+	if err != nil {
+		return err
+	}
+
+	err = m.store.saveDefaultRetention(policy)
+	if err != nil {
+		m.MainWeatherManager.SetDefaultRetention(previous)
+		return StorageError(err, "Error saving retention")
+	}
+	return nil
+}
+
+func (m *StoredWeatherManager) SetRetention(city string, policy *RetentionPolicy) error {
+	return m.write(m.cityIDs(city), false, func() error {
+		return m.MainWeatherManager.SetRetention(city, policy)
+	})
+}
+
+func (m *StoredWeatherManager) Aggregates(city string) ([]Aggregate, error) {
+	id, err := m.lookupID(city)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates, err := m.store.aggregates(id)
+	if err != nil {
+		return nil, StorageError(err, "Error reading aggregates")
+	}
+	return aggregates, nil
+}
+
+// Snapshot reads every city from the store, holding writes off meanwhile so
+// the snapshot reflects a single point in time.
+func (m *StoredWeatherManager) Snapshot() (Snapshot, error) {
+	m.writes.Lock()
+	defer m.writes.Unlock()
+
+	m.mutex.RLock()
+	entries := []City{}
+	for id := range m.weathers {
+		city, _ := m.cities.Get(id)
+		entries = append(entries, city)
+	}
+	m.mutex.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	snapshot := Snapshot{CreatedAt: now().UTC(), Cities: []SnapshotCity{}}
+	for _, entry := range entries {
+		stored, err := m.store.loadCity(entry.ID)
+		if err != nil {
+			return Snapshot{}, StorageError(err, "Error reading weather")
+		}
+		if stored == nil {
+			continue
+		}
+
+		city := stored.city
+		city.City = entry
+		if city.Aggregates == nil {
+			city.Aggregates = []Aggregate{}
+		}
+		if city.Stations == nil {
+			city.Stations = []SnapshotStation{}
+		}
+		snapshot.Cities = append(snapshot.Cities, city)
+	}
+	return snapshot, nil
+}
+
+// Restore loads every city from the store, as restoring a snapshot may
+// change or delete any of them.
+func (m *StoredWeatherManager) Restore(snapshot Snapshot, mode RestoreMode, dryRun bool) (RestoreDiff, error) {
+	if dryRun {
+		m.writes.Lock()
+		defer m.writes.Unlock()
+
+		backups, err := m.loadWrite(nil, true)
+		if err != nil {
+			return RestoreDiff{}, StorageError(err, "Error reading weather")
+		}
+		defer m.unload(backups)
+		return m.MainWeatherManager.Restore(snapshot, mode, dryRun)
+	}
+
+	ids := []string{}
+	for _, city := range snapshot.Cities {
+		ids = append(ids, CityID(city.City.Name, city.City.Region, city.City.Country))
+	}
+
+	var diff RestoreDiff
+	err := m.write(staticIDs(ids...), true, func() error {
+		var err error
+		diff, err = m.MainWeatherManager.Restore(snapshot, mode, dryRun)
+		return err
+	})
+	if err != nil {
+		return RestoreDiff{}, err
+	}
+	return diff, nil
+}
+
+// ApplyRetention tells the cities due from their stats in the store, and
+// persists those it rolled up or dropped data of. When they can not be read
+// or persisted, the error is logged and they are retried by the next run.
+func (m *StoredWeatherManager) ApplyRetention() RetentionReport {
+	today := retentionDay()
+	var ids []string
+	resolve := func() ([]string, error) {
+		var err error
+		ids, err = m.retentionDue(today)
+		return ids, err
+	}
+
+	report := RetentionReport{}
+	err := m.write(resolve, false, func() error {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		for _, id := range ids {
+			m.applyRetention(id, today, &report)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error applying retention (%s)", err.Error())
+		return RetentionReport{}
+	}
+	return report
+}
+
+// retentionDue returns the cities ApplyRetention would change on today. Only
+// the stats of the cities with a policy are read.
+func (m *StoredWeatherManager) retentionDue(today time.Time) ([]string, error) {
+	m.mutex.RLock()
+	ids := []string{}
+	for id := range m.weathers {
+		if m.policyOf(id) != (RetentionPolicy{}) {
+			ids = append(ids, id)
+		}
+	}
+	m.mutex.RUnlock()
+
+	stats, err := m.store.stats(ids)
+	if err != nil {
+		return nil, StorageError(err, "Error reading weather")
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	due := []string{}
+	for _, id := range ids {
+		if m.policyOf(id).due(stats[id], today) {
+			due = append(due, id)
+		}
+	}
+	return due, nil
+}
+
+// PurgeDeleted persists the deleted cities it purged. When they can not be
+// persisted, the error is logged and they are retried by the next run.
+func (m *StoredWeatherManager) PurgeDeleted() int {
+	var ids []string
+	resolve := func() ([]string, error) {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+		ids = m.expiredDeleted()
+		return ids, nil
+	}
+
+	purged := 0
+	err := m.write(resolve, false, func() error {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		purged = m.purge(ids)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error purging deleted cities (%s)", err.Error())
+		return 0
+	}
+	return purged
+}
+
+func (m *StoredWeatherManager) RunMaintenance(interval time.Duration) func() {
+	return runEvery(interval, func() {
+		m.PurgeDeleted()
+		m.ApplyRetention()
+	})
+}
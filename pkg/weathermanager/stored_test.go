@@ -0,0 +1,263 @@
+package weathermanager_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestBolt(t *testing.T, path string) *weathermanager.StoredWeatherManager {
+	weatherMgr, err := weathermanager.OpenBolt(path, weathermanager.DefaultOptions())
+	require.NoError(t, err)
+	return weatherMgr
+}
+
+func openTestSQL(t *testing.T, path string) *weathermanager.StoredWeatherManager {
+	weatherMgr, err := weathermanager.OpenSQL(openTestSQLDatabase(t, path), weathermanager.DefaultOptions())
+	require.NoError(t, err)
+	return weatherMgr
+}
+
+// persistentBackends runs test against every store, with the function opening
+// it.
+func persistentBackends(t *testing.T, test func(t *testing.T, open func(t *testing.T, path string) *weathermanager.StoredWeatherManager)) {
+	t.Run("bolt", func(t *testing.T) {
+		test(t, openTestBolt)
+	})
+	t.Run("sql", func(t *testing.T) {
+		test(t, openTestSQL)
+	})
+}
+
+func TestStored_KeepDataAcrossRestarts(t *testing.T) {
+	persistentBackends(t, func(t *testing.T, open func(t *testing.T, path string) *weathermanager.StoredWeatherManager) {
+		path := newTestDatabase(t)
+
+		weatherMgr := open(t, path)
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+		weatherMgr.RegisterCity(weathermanager.City{
+			Name:        "São Paulo",
+			Country:     "BR",
+			Aliases:     []string{"sampa"},
+			Coordinates: &weathermanager.Coordinates{Latitude: -23.55, Longitude: -46.63},
+		})
+		weatherMgr.SaveObservation("sampa", "2020-04-18", 25)
+		weatherMgr.RegisterStation(weathermanager.Station{ID: "yvr-1", City: "vancouver"})
+		weatherMgr.SaveStationObservations("yvr-1", map[string]int{"2020-04-18": 14})
+		weatherMgr.SaveWeather("toronto", map[string]int{"2020-04-18": 9})
+		weatherMgr.DeleteWeather("toronto")
+		require.NoError(t, weatherMgr.SetDefaultRetention(weathermanager.RetentionPolicy{RawDays: 3650}))
+		require.NoError(t, weatherMgr.Close())
+
+		weatherMgr = open(t, path)
+		defer weatherMgr.Close()
+
+		temperatures, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"2020-04-18": 15, "2020-04-19": 16}, temperatures)
+
+		city, err := weatherMgr.ResolveCity("sampa")
+		assert.NoError(t, err)
+		assert.Equal(t, "sao-paulo-br", city.ID)
+		nearby, err := weatherMgr.NearestCities(weathermanager.Coordinates{Latitude: -23.5, Longitude: -46.6}, 1, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(nearby))
+		assert.Equal(t, "2020-04-18", nearby[0].LatestDate)
+
+		observations, err := weatherMgr.StationObservations("vancouver", weathermanager.DateRange{})
+		assert.NoError(t, err)
+		assert.Equal(t, []weathermanager.StationObservation{{Station: "yvr-1", Date: "2020-04-18", Temperature: 14}}, observations)
+
+		assert.Equal(t, weathermanager.RetentionPolicy{RawDays: 3650}, weatherMgr.DefaultRetention())
+
+		_, err = weatherMgr.UndeleteWeather("toronto")
+		assert.NoError(t, err)
+		temperatures, ok := weatherMgr.GetAllWeather("toronto")
+		assert.True(t, ok)
+		assert.Equal(t, map[string]int{"2020-04-18": 9}, temperatures)
+	})
+}
+
+func TestStored_KeepHistoryAcrossRestarts(t *testing.T) {
+	persistentBackends(t, func(t *testing.T, open func(t *testing.T, path string) *weathermanager.StoredWeatherManager) {
+		path := newTestDatabase(t)
+
+		beforeHistory := time.Now()
+		time.Sleep(time.Millisecond)
+		weatherMgr := open(t, path)
+		weatherMgr.WithActor("alice").SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+		beforeRestart := time.Now()
+		require.NoError(t, weatherMgr.Close())
+
+		weatherMgr = open(t, path)
+		defer weatherMgr.Close()
+		time.Sleep(time.Millisecond)
+		weatherMgr.WithActor("bob").SaveObservation("vancouver", "2020-04-18", 20)
+
+		temperatures := map[string]int{}
+		err := weatherMgr.IterateRangeAsOf("vancouver", weathermanager.DateRange{}, beforeRestart, func(date string, temperature int) bool {
+			temperatures[date] = temperature
+			return true
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"2020-04-18": 15, "2020-04-19": 16}, temperatures)
+
+		history, err := weatherMgr.ObservationHistory("vancouver", "2020-04-18")
+		assert.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, 1, history[0].Version)
+		assert.Equal(t, "alice", history[0].Actor)
+		assert.Equal(t, 2, history[1].Version)
+		assert.Equal(t, "bob", history[1].Actor)
+
+		err = weatherMgr.IterateRangeAsOf("vancouver", weathermanager.DateRange{}, beforeHistory, func(string, int) bool { return true })
+		assert.True(t, errors.Is(err, weathermanager.ErrValidation), "the database did not keep history then")
+	})
+}
+
+func TestStored_ReplaceRemovesStoredData(t *testing.T) {
+	persistentBackends(t, func(t *testing.T, open func(t *testing.T, path string) *weathermanager.StoredWeatherManager) {
+		path := newTestDatabase(t)
+
+		weatherMgr := open(t, path)
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15, "2020-04-19": 16})
+		weatherMgr.RegisterStation(weathermanager.Station{ID: "yvr-1", City: "vancouver"})
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-19": 17})
+		weatherMgr.DeleteStation("yvr-1")
+		require.NoError(t, weatherMgr.Close())
+
+		weatherMgr = open(t, path)
+		defer weatherMgr.Close()
+
+		temperatures, ok := weatherMgr.GetAllWeather("vancouver")
+		assert.True(t, ok)
+		assert.Equal(t, map[string]int{"2020-04-19": 17}, temperatures)
+		_, err := weatherMgr.GetStation("yvr-1")
+		assert.Error(t, err)
+	})
+}
+
+func TestStored_WithStorageFailure_KeepMemoryUnchanged(t *testing.T) {
+	persistentBackends(t, func(t *testing.T, open func(t *testing.T, path string) *weathermanager.StoredWeatherManager) {
+		path := newTestDatabase(t)
+		weatherMgr := open(t, path)
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+		weatherMgr.RegisterStation(weathermanager.Station{ID: "yvr-1", City: "vancouver"})
+		require.NoError(t, weatherMgr.Close())
+
+		err := weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-19": 16})
+		assert.True(t, errors.Is(err, weathermanager.ErrStorage))
+
+		err = weatherMgr.DeleteWeather("vancouver")
+		assert.True(t, errors.Is(err, weathermanager.ErrStorage))
+		_, err = weatherMgr.ResolveCity("vancouver")
+		assert.NoError(t, err)
+		_, err = weatherMgr.GetStation("yvr-1")
+		assert.NoError(t, err)
+		deleted, err := weatherMgr.ListDeleted()
+		assert.NoError(t, err)
+		assert.Empty(t, deleted)
+
+		_, err = weatherMgr.RegisterCity(weathermanager.City{Name: "Toronto", Aliases: []string{"the six"}})
+		assert.True(t, errors.Is(err, weathermanager.ErrStorage))
+		_, err = weatherMgr.ResolveCity("the six")
+		assert.True(t, errors.Is(err, weathermanager.ErrNotFound))
+
+		err = weatherMgr.SetDefaultRetention(weathermanager.RetentionPolicy{RawDays: 30})
+		assert.True(t, errors.Is(err, weathermanager.ErrStorage))
+		assert.Equal(t, weathermanager.DefaultOptions().Retention, weatherMgr.DefaultRetention())
+
+		weatherMgr = open(t, path)
+		defer weatherMgr.Close()
+
+		temperatures, ok := weatherMgr.GetAllWeather("vancouver")
+		assert.True(t, ok)
+		assert.Equal(t, map[string]int{"2020-04-18": 15}, temperatures)
+		_, err = weatherMgr.ObservationHistory("vancouver", "2020-04-19")
+		assert.True(t, errors.Is(err, weathermanager.ErrNotFound))
+	})
+}
+
+func TestStored_RestoreMovingStation_KeepDataAcrossRestarts(t *testing.T) {
+	persistentBackends(t, func(t *testing.T, open func(t *testing.T, path string) *weathermanager.StoredWeatherManager) {
+		path := newTestDatabase(t)
+
+		weatherMgr := open(t, path)
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15})
+		weatherMgr.RegisterStation(weathermanager.Station{ID: "border-1", City: "vancouver"})
+		weatherMgr.SaveStationObservations("border-1", map[string]int{"2020-04-17": 13, "2020-04-18": 14})
+		_, err := weatherMgr.Restore(weathermanager.Snapshot{Cities: []weathermanager.SnapshotCity{{
+			City:         weathermanager.City{Name: "Seattle"},
+			Observations: map[string]int{"2020-04-18": 12},
+			Stations: []weathermanager.SnapshotStation{{
+				Station:      weathermanager.Station{ID: "border-1"},
+				Observations: map[string]int{"2020-04-18": 11},
+			}},
+		}}}, weathermanager.RestoreReplace, false)
+		require.NoError(t, err)
+		require.NoError(t, weatherMgr.Close())
+
+		weatherMgr = open(t, path)
+		defer weatherMgr.Close()
+
+		_, ok := weatherMgr.GetAllWeather("vancouver")
+		assert.False(t, ok)
+		observations, err := weatherMgr.StationObservations("seattle", weathermanager.DateRange{})
+		assert.NoError(t, err)
+		assert.Equal(t, []weathermanager.StationObservation{{Station: "border-1", Date: "2020-04-18", Temperature: 11}}, observations)
+
+		_, err = weatherMgr.UndeleteWeather("vancouver")
+		assert.True(t, errors.Is(err, weathermanager.ErrConflict), "the station now belongs to seattle")
+	})
+}
+
+func TestStored_ApplyRetention_KeepDataAcrossRestarts(t *testing.T) {
+	persistentBackends(t, func(t *testing.T, open func(t *testing.T, path string) *weathermanager.StoredWeatherManager) {
+		path := newTestDatabase(t)
+
+		weatherMgr := open(t, path)
+		require.NoError(t, weatherMgr.SetDefaultRetention(weathermanager.RetentionPolicy{RawDays: 30}))
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2000-01-15": 5, "2000-01-16": 7})
+		weatherMgr.SaveWeather("toronto", map[string]int{time.Now().UTC().Format("2006-01-02"): 9})
+		report := weatherMgr.ApplyRetention()
+		assert.Equal(t, 2, report.RolledUp)
+		require.NoError(t, weatherMgr.Close())
+
+		weatherMgr = open(t, path)
+		defer weatherMgr.Close()
+
+		temperatures, ok := weatherMgr.GetAllWeather("vancouver")
+		assert.True(t, ok)
+		assert.Empty(t, temperatures)
+		aggregates, err := weatherMgr.Aggregates("vancouver")
+		assert.NoError(t, err)
+		assert.Equal(t, []weathermanager.Aggregate{{Month: "2000-01", Count: 2, Sum: 12, Min: 5, Max: 7}}, aggregates)
+		temperatures, _ = weatherMgr.GetAllWeather("toronto")
+		assert.Len(t, temperatures, 1)
+	})
+}
+
+func TestStored_ApplyRetention_WithStorageFailure_KeepDataUnchanged(t *testing.T) {
+	persistentBackends(t, func(t *testing.T, open func(t *testing.T, path string) *weathermanager.StoredWeatherManager) {
+		path := newTestDatabase(t)
+		weatherMgr := open(t, path)
+		require.NoError(t, weatherMgr.SetDefaultRetention(weathermanager.RetentionPolicy{RawDays: 30}))
+		weatherMgr.SaveWeather("vancouver", map[string]int{"2000-01-15": 5})
+		require.NoError(t, weatherMgr.Close())
+
+		assert.Equal(t, weathermanager.RetentionReport{}, weatherMgr.ApplyRetention())
+
+		weatherMgr = open(t, path)
+		defer weatherMgr.Close()
+
+		temperatures, _ := weatherMgr.GetAllWeather("vancouver")
+		assert.Equal(t, map[string]int{"2000-01-15": 5}, temperatures)
+		aggregates, err := weatherMgr.Aggregates("vancouver")
+		assert.NoError(t, err)
+		assert.Empty(t, aggregates)
+	})
+}
@@ -0,0 +1,201 @@
+package weathermanager
+
+import (
+	"sort"
+	"time"
+)
+
+// DeletedCity is a deleted city that can still be restored until PurgeAt.
+type DeletedCity struct {
+	City         City
+	Observations int
+	DeletedAt    time.Time
+	PurgeAt      time.Time
+}
+
+// tombstone keeps what DeleteWeather removed, so it can be put back.
+type tombstone struct {
+	city         City
+	observations int
+	weathers     map[string]int
+	stations     []Station
+	readings     map[string]map[string]int
+	aggregates   map[string]*Aggregate
+	retention    *RetentionPolicy
+	deletedAt    time.Time
+}
+
+func (m *MainWeatherManager) tombstone(city City) *tombstone {
+	t := &tombstone{
+		city:         city,
+		observations: len(m.weathers[city.ID]),
+		weathers:     map[string]int{},
+		stations:     m.stationsOf(city.ID),
+		readings:     map[string]map[string]int{},
+		aggregates:   m.aggregates[city.ID],
+		deletedAt:    now().UTC(),
+	}
+	if policy, ok := m.retention[city.ID]; ok {
+		t.retention = &policy
+	}
+	for date, temperature := range m.weathers[city.ID] {
+		t.weathers[date] = temperature
+	}
+	for _, station := range t.stations {
+		t.readings[station.ID] = m.readings[station.ID]
+	}
+	return t
+}
+
+func (m *MainWeatherManager) purgeAt(t *tombstone) time.Time {
+	return t.deletedAt.Add(m.options.DeletionRetention)
+}
+
+// UndeleteWeather restores a deleted city, given by its ID or name, with its
+// observations and stations.
+func (m *MainWeatherManager) UndeleteWeather(city string) (City, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.purgeDeleted()
+
+	id := CityKey(city)
+	t, ok := m.deleted[id]
+	if !ok {
+		return City{}, NotFoundError("Deleted city %s not found", city)
+	}
+	if _, ok := m.cities.Get(id); ok {
+		return City{}, ConflictError("City %s was created again after it was deleted", id)
+	}
+	for _, station := range t.stations {
+		if _, ok := m.stations[station.ID]; ok {
+			return City{}, ConflictError("Station %s was created again after it was deleted", station.ID)
+		}
+	}
+
+	registered, err := m.cities.Register(t.city)
+	if err != nil {
+		return City{}, err
+	}
+
+	m.weathers[registered.ID] = map[string]int{}
+	m.datesChanged(registered.ID)
+	for date, temperature := range t.weathers {
+		m.set(registered.ID, date, temperature)
+	}
+	if registered.Coordinates != nil {
+		m.locations.put(registered.ID, *registered.Coordinates)
+	}
+	if t.aggregates != nil {
+		m.aggregates[registered.ID] = t.aggregates
+	}
+	if t.retention != nil {
+		m.retention[registered.ID] = *t.retention
+	}
+	for i := range t.stations {
+		station := t.stations[i]
+		m.stations[station.ID] = &station
+		m.readings[station.ID] = t.readings[station.ID]
+	}
+
+	delete(m.deleted, id)
+	return registered, nil
+}
+
+// ListDeleted returns the deleted cities that can still be restored, sorted
+// by ID.
+func (m *MainWeatherManager) ListDeleted() ([]DeletedCity, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	deleted := []DeletedCity{}
+	for _, t := range m.deleted {
+		purgeAt := m.purgeAt(t)
+		if !now().Before(purgeAt) {
+			continue
+		}
+
+		deleted = append(deleted, DeletedCity{
+			City:         t.city,
+			Observations: t.observations,
+			DeletedAt:    t.deletedAt,
+			PurgeAt:      purgeAt,
+		})
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i].City.ID < deleted[j].City.ID
+	})
+	return deleted, nil
+}
+
+// PurgeDeleted permanently removes the deleted cities whose retention has
+// passed, returning how many were purged.
+func (m *MainWeatherManager) PurgeDeleted() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.purgeDeleted()
+}
+
+func (m *MainWeatherManager) purgeDeleted() int {
+	return m.purge(m.expiredDeleted())
+}
+
+// expiredDeleted returns the deleted cities whose retention has passed.
+func (m *MainWeatherManager) expiredDeleted() []string {
+	expired := []string{}
+	for id, t := range m.deleted {
+		if !now().Before(m.purgeAt(t)) {
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
+
+func (m *MainWeatherManager) purge(ids []string) int {
+	purged := 0
+	for _, id := range ids {
+		if _, ok := m.deleted[id]; !ok {
+			continue
+		}
+
+		delete(m.deleted, id)
+		if _, ok := m.cities.Get(id); !ok {
+			delete(m.history, id)
+		}
+		purged++
+	}
+	return purged
+}
+
+// RunMaintenance runs the background jobs of the manager, purging deleted
+// cities and applying retention policies, every interval until the returned
+// function is called.
+func (m *MainWeatherManager) RunMaintenance(interval time.Duration) func() {
+	return runEvery(interval, func() {
+		m.PurgeDeleted()
+		m.ApplyRetention()
+	})
+}
+
+// runEvery calls job every interval until the returned function is called.
+func runEvery(interval time.Duration, job func()) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				job()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -2,88 +2,667 @@ package weathermanager
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"errors"
+	"sort"
+	"sync"
 	"time"
 )
 
+const dateLayout = "2006-01-02"
+
 type WeatherManager interface {
 	SaveWeather(string, map[string]int) error
+	MergeWeather(string, map[string]int) error
+	ImportWeather(map[string]map[string]int) error
 	GetWeather(string, string, string) (map[string]int, error)
+	IterateWeather(string, string, string, func(string, int) bool) error
+	IterateRange(string, DateRange, func(string, int) bool) error
+	IterateRangeAsOf(string, DateRange, time.Time, func(string, int) bool) error
+	GetAllWeather(string) (map[string]int, bool)
 	DeleteWeather(string) error
+	SaveObservation(string, string, int) error
+	GetObservation(string, string) (int, bool)
+	DeleteObservation(string, string) error
+	ListCities(ListCitiesOptions) (CityPage, error)
+	RegisterCity(City) (City, error)
+	ResolveCity(string) (City, error)
+	NearestCities(Coordinates, int, float64) ([]NearbyCity, error)
+	CitiesWithin(BoundingBox) ([]NearbyCity, error)
+	RegisterStation(Station) (Station, error)
+	GetStation(string) (Station, error)
+	ListStations(string) ([]Station, error)
+	DeleteStation(string) error
+	SaveStationObservations(string, map[string]int) error
+	StationObservations(string, DateRange) ([]StationObservation, error)
+	CombineStationObservations(string, DateRange, Reducer) ([]CombinedObservation, error)
+	ObservationHistory(string, string) ([]Revision, error)
+	UndeleteWeather(string) (City, error)
+	ListDeleted() ([]DeletedCity, error)
+	SetDefaultRetention(RetentionPolicy) error
+	DefaultRetention() RetentionPolicy
+	SetRetention(string, *RetentionPolicy) error
+	Retention(string) (RetentionPolicy, bool, error)
+	Aggregates(string) ([]Aggregate, error)
+	Snapshot() (Snapshot, error)
+	Restore(Snapshot, RestoreMode, bool) (RestoreDiff, error)
+	WithActor(string) WeatherManager
 }
 
+// MainWeatherManager keeps every report in memory. Managers returned by
+// WithActor share the state of the one they were created from.
 type MainWeatherManager struct {
+	*state
+	actor string
+}
+
+type state struct {
+	options    Options
 	validToken string
 	weathers   map[string]map[string]int
+	history    map[string]map[string][]Revision
+	cities     *CityRegistry
+	locations  *spatialIndex
+	stations   map[string]*Station
+	readings   map[string]map[string]int
+	deleted    map[string]*tombstone
+	retention  map[string]RetentionPolicy
+	aggregates map[string]map[string]*Aggregate
+	mutex      sync.RWMutex
+
+	// historySince is when the revision history starts, zero when it holds
+	// every change made.
+	historySince time.Time
+
+	// dates caches the sorted dates of each city's observations for range
+	// reads. Readers fill it under the read lock, hence its own mutex.
+	dates      map[string][]string
+	datesMutex sync.Mutex
 }
 
-func (m *MainWeatherManager) SaveWeather(city string, temperatures map[string]int) error {
-	dateLayout := "2006-01-02"
-	for k, _ := range temperatures {
+func validateDates(temperatures map[string]int) error {
+	for k := range temperatures {
 		_, err := time.Parse(dateLayout, k)
 		if err != nil {
-			return fmt.Errorf("Invalid date %s (%s)", k, err.Error())
+			return ValidationError("Invalid date %s (%s)", k, err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *MainWeatherManager) SaveWeather(city string, temperatures map[string]int) error {
+	err := validateDates(temperatures)
+	if err != nil {
+		return err
+	}
+
+	saved := map[string]int{}
+	for k, v := range temperatures {
+		saved[k] = v
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	registered, err := m.cities.ResolveOrRegister(city)
+	if err != nil {
+		return err
+	}
+	err = m.checkRolledUp(registered.ID, saved)
+	if err != nil {
+		return err
+	}
+
+	for date := range m.weathers[registered.ID] {
+		if _, ok := saved[date]; !ok {
+			m.unset(registered.ID, date)
+		}
+	}
+	if _, ok := m.weathers[registered.ID]; !ok {
+		m.weathers[registered.ID] = map[string]int{}
+	}
+	for date, temperature := range saved {
+		m.set(registered.ID, date, temperature)
+	}
+	return nil
+}
+
+func (m *MainWeatherManager) MergeWeather(city string, temperatures map[string]int) error {
+	err := validateDates(temperatures)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.merge(city, temperatures)
+}
+
+func (m *MainWeatherManager) ImportWeather(weathers map[string]map[string]int) error {
+	for _, temperatures := range weathers {
+		err := validateDates(temperatures)
+		if err != nil {
+			return err
 		}
 	}
 
-	m.weathers[strings.ToLower(city)] = temperatures
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Every city is resolved and checked before anything is merged, so an
+	// ambiguous name or a rolled up date leaves the import unapplied.
+	for city, temperatures := range weathers {
+		registered, err := m.cities.Resolve(city)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = m.checkRolledUp(registered.ID, temperatures)
+		if err != nil {
+			return err
+		}
+	}
+
+	for city, temperatures := range weathers {
+		err := m.merge(city, temperatures)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (m *MainWeatherManager) merge(city string, temperatures map[string]int) error {
+	registered, err := m.cities.ResolveOrRegister(city)
+	if err != nil {
+		return err
+	}
+	err = m.checkRolledUp(registered.ID, temperatures)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := m.weathers[registered.ID]; !ok {
+		m.weathers[registered.ID] = map[string]int{}
+	}
+	for k, v := range temperatures {
+		m.set(registered.ID, k, v)
+	}
+	return nil
+}
+
+// lookup returns the ID of the report of city. Unknown cities are reported
+// with notFoundMessage.
+func (m *MainWeatherManager) lookup(city string, notFoundMessage string) (string, error) {
+	registered, err := m.cities.Resolve(city)
+	if errors.Is(err, ErrNotFound) {
+		return "", NotFoundError(notFoundMessage)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := m.weathers[registered.ID]; !ok {
+		return "", NotFoundError(notFoundMessage)
+	}
+	return registered.ID, nil
+}
+
 func (m *MainWeatherManager) GetWeather(city string, initialDate string, endDate string) (map[string]int, error) {
+	return getWeather(m, city, initialDate, endDate)
+}
+
+func (m *MainWeatherManager) IterateWeather(city string, initialDate string, endDate string, fn func(string, int) bool) error {
+	return iterateWeather(m, city, initialDate, endDate, fn)
+}
+
+// getWeather and iterateWeather implement GetWeather and IterateWeather on top
+// of the IterateRange of a manager.
+func getWeather(m WeatherManager, city string, initialDate string, endDate string) (map[string]int, error) {
+	temperatures := map[string]int{}
+	err := m.IterateWeather(city, initialDate, endDate, func(date string, temperature int) bool {
+		temperatures[date] = temperature
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return temperatures, nil
+}
+
+func iterateWeather(m WeatherManager, city string, initialDate string, endDate string, fn func(string, int) bool) error {
 	if city == "" {
-		return nil, fmt.Errorf("Empty city")
+		return ValidationError("Empty city")
 	}
 
 	if initialDate == "" {
-		return nil, fmt.Errorf("Empty initial date")
+		return ValidationError("Empty initial date")
 	}
 
 	if endDate == "" {
-		return nil, fmt.Errorf("Empty end date")
+		return ValidationError("Empty end date")
 	}
 
-	_, ok := m.weathers[strings.ToLower(city)]
-	if !ok {
-		return nil, fmt.Errorf("Weather report not found")
+	return m.IterateRange(city, Between(initialDate, endDate), fn)
+}
+
+func (m *MainWeatherManager) IterateRange(city string, dateRange DateRange, fn func(string, int) bool) error {
+	return m.IterateRangeAsOf(city, dateRange, time.Time{}, fn)
+}
+
+// IterateRangeAsOf iterates the observations of city as they were at asOf,
+// or as they are now when asOf is zero.
+func (m *MainWeatherManager) IterateRangeAsOf(city string, dateRange DateRange, asOf time.Time, fn func(string, int) bool) error {
+	if city == "" {
+		return ValidationError("Empty city")
 	}
 
-	dateLayout := "2006-01-02"
-	initial, err := time.Parse(dateLayout, initialDate)
+	m.mutex.RLock()
+	id, err := m.lookup(city, "Weather report not found")
+	m.mutex.RUnlock()
 	if err != nil {
-		return nil, fmt.Errorf("Invalid initial date (%s)", err.Error())
+		return err
 	}
 
-	end, err := time.Parse(dateLayout, endDate)
+	_, err = dateRange.bounds()
 	if err != nil {
-		return nil, fmt.Errorf("Invalid end date (%s)", err.Error())
+		return err
+	}
+	err = m.checkAsOf(asOf)
+	if err != nil {
+		return err
 	}
 
-	if !initial.Before(end) {
-		return nil, fmt.Errorf("Invalid date range")
+	// The callback runs without holding the lock, so a slow consumer (e.g. a
+	// streamed response) does not block writers.
+	if !asOf.IsZero() {
+		dates, temperatures := m.readRangeAsOf(id, dateRange, asOf)
+		for i, date := range dates {
+			if !fn(date, temperatures[i]) {
+				break
+			}
+		}
+		return nil
 	}
+	return iterateBatches(dateRange, func(batch DateRange, limit int) ([]string, []int, error) {
+		dates, temperatures := m.readRange(id, batch, limit)
+		return dates, temperatures, nil
+	}, fn)
+}
 
-	temperatures := map[string]int{}
-	for k, e := range m.weathers[strings.ToLower(city)] {
-		temperatureDate, _ := time.Parse(dateLayout, k)
-		if temperatureDate.After(initial) && temperatureDate.Before(end) {
-			temperatures[k] = e
+// checkAsOf refuses to read as of a time earlier than the history.
+func (m *MainWeatherManager) checkAsOf(asOf time.Time) error {
+	if !asOf.IsZero() && asOf.Before(m.historySince) {
+		return ValidationError("The history starts at %s, as_of can not be earlier", m.historySince.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// readRange returns at most limit observations of city within dateRange,
+// sorted by date.
+func (m *MainWeatherManager) readRange(city string, dateRange DateRange, limit int) ([]string, []int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	dates := dateRange.slice(m.sortedDates(city))
+	if len(dates) > limit {
+		dates = dates[:limit]
+	}
+	return dates, temperaturesOf(m.weathers[city], dates)
+}
+
+// readRangeAsOf returns the observations of city within dateRange as they
+// were at asOf, sorted by date. The past state is rebuilt from the history,
+// so it is read at once rather than by batch.
+func (m *MainWeatherManager) readRangeAsOf(city string, dateRange DateRange, asOf time.Time) ([]string, []int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	saved := m.weatherAsOf(city, asOf)
+	dates := dateRange.slice(sortedKeys(saved))
+	return dates, temperaturesOf(saved, dates)
+}
+
+func temperaturesOf(saved map[string]int, dates []string) []int {
+
+	temperatures := make([]int, 0, len(dates))
+	for _, date := range dates {
+		temperatures = append(temperatures, saved[date])
+	}
+	return temperatures
+}
+
+// sortedDates returns the dates of the observations of city in order. The
+// slice is shared until a date is added or removed and must not be modified.
+func (m *MainWeatherManager) sortedDates(city string) []string {
+	m.datesMutex.Lock()
+	defer m.datesMutex.Unlock()
+
+	dates, ok := m.dates[city]
+	if !ok {
+		dates = sortedKeys(m.weathers[city])
+		m.dates[city] = dates
+	}
+	return dates
+}
+
+// datesChanged drops the sorted dates of city once a date is added or
+// removed. Callers hold the write lock.
+func (m *MainWeatherManager) datesChanged(city string) {
+	m.datesMutex.Lock()
+	defer m.datesMutex.Unlock()
+
+	delete(m.dates, city)
+}
+
+func sortedKeys(temperatures map[string]int) []string {
+	dates := make([]string, 0, len(temperatures))
+	for date := range temperatures {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// rangeBatchSize is the number of observations read at a time when iterating
+// a range, so a consumer stopping early (e.g. at the end of a page) does not
+// read the rest of the range.
+const rangeBatchSize = 500
+
+// iterateBatches calls fn with the observations of dateRange in date order,
+// reading them with read rangeBatchSize at a time, each batch starting after
+// the last date of the previous one.
+func iterateBatches(dateRange DateRange, read func(DateRange, int) ([]string, []int, error), fn func(string, int) bool) error {
+	for {
+		dates, temperatures, err := read(dateRange, rangeBatchSize)
+		if err != nil {
+			return err
 		}
+		for i, date := range dates {
+			if !fn(date, temperatures[i]) {
+				return nil
+			}
+		}
+		if len(dates) < rangeBatchSize {
+			return nil
+		}
+		dateRange.From = dates[len(dates)-1]
+		dateRange.FromInclusive = false
 	}
+}
 
-	return temperatures, nil
+func (m *MainWeatherManager) GetAllWeather(city string) (map[string]int, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return nil, false
+	}
+
+	saved := m.weathers[id]
+	temperatures := map[string]int{}
+	for k, v := range saved {
+		temperatures[k] = v
+	}
+	return temperatures, true
 }
 
+// DeleteWeather deletes a city along with its observations and stations. The
+// city is kept aside and can be restored with UndeleteWeather until it is
+// purged, once the deletion retention has passed.
 func (m *MainWeatherManager) DeleteWeather(city string) error {
-	delete(m.weathers, strings.ToLower(city))
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	registered, err := m.cities.Resolve(city)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.softDelete(registered)
 	return nil
 }
 
-func New() *MainWeatherManager {
-	return &MainWeatherManager{
-		weathers: map[string]map[string]int{},
+// softDelete keeps city aside in a tombstone and removes it.
+func (m *MainWeatherManager) softDelete(city City) {
+	m.deleted[city.ID] = m.tombstone(city)
+	for date := range m.weathers[city.ID] {
+		m.unset(city.ID, date)
+	}
+	delete(m.weathers, city.ID)
+	delete(m.aggregates, city.ID)
+	delete(m.retention, city.ID)
+	m.cities.Remove(city.ID)
+	m.locations.remove(city.ID)
+	for _, station := range m.stationsOf(city.ID) {
+		delete(m.stations, station.ID)
+		delete(m.readings, station.ID)
+	}
+}
+
+func (m *MainWeatherManager) SaveObservation(city string, date string, temperature int) error {
+	return m.MergeWeather(city, map[string]int{date: temperature})
+}
+
+func (m *MainWeatherManager) GetObservation(city string, date string) (int, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return 0, false
+	}
+
+	temperature, ok := m.weathers[id][date]
+	return temperature, ok
+}
+
+func (m *MainWeatherManager) DeleteObservation(city string, date string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	id, err := m.lookup(city, "Weather report not found")
+	if err != nil {
+		return err
+	}
+
+	if _, ok := m.weathers[id][date]; !ok {
+		return NotFoundError("Observation not found")
+	}
+
+	m.unset(id, date)
+	return nil
+}
+
+func (m *MainWeatherManager) ListCities(options ListCitiesOptions) (CityPage, error) {
+	m.mutex.RLock()
+	summaries := []CitySummary{}
+	for id, temperatures := range m.weathers {
+		city, _ := m.cities.Get(id)
+		summaries = append(summaries, SummarizeCity(city, temperatures))
+	}
+	m.mutex.RUnlock()
+
+	return PageCities(summaries, options)
+}
+
+// RegisterCity registers a city, qualified by its region and country and with
+// its aliases, so reports can be saved and found under any of its names.
+func (m *MainWeatherManager) RegisterCity(city City) (City, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if city.Coordinates != nil {
+		err := validateCoordinates(*city.Coordinates)
+		if err != nil {
+			return City{}, err
+		}
+	}
+
+	registered, err := m.cities.Register(city)
+	if err != nil {
+		return City{}, err
+	}
+	if _, ok := m.weathers[registered.ID]; !ok {
+		m.weathers[registered.ID] = map[string]int{}
+	}
+	if registered.Coordinates != nil {
+		m.locations.put(registered.ID, *registered.Coordinates)
+	}
+	return registered, nil
+}
+
+func (m *MainWeatherManager) ResolveCity(name string) (City, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.cities.Resolve(name)
+}
+
+// NearestCities returns up to limit located cities closest to point, no
+// farther than radiusKm when it is positive.
+func (m *MainWeatherManager) NearestCities(point Coordinates, limit int, radiusKm float64) ([]NearbyCity, error) {
+	found, err := m.nearestCities(point, limit, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return completeNearby(found, m.cityStats), nil
+}
+
+// CitiesWithin returns the located cities inside box, sorted by ID.
+func (m *MainWeatherManager) CitiesWithin(box BoundingBox) ([]NearbyCity, error) {
+	found, err := m.citiesWithin(box)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return completeNearby(found, m.cityStats), nil
+}
+
+// nearestCities finds the cities of NearestCities, with their registry entry.
+func (m *MainWeatherManager) nearestCities(point Coordinates, limit int, radiusKm float64) ([]NearbyCity, error) {
+	err := validateCoordinates(point)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, ValidationError("Invalid limit %d", limit)
+	}
+	if radiusKm < 0 {
+		return nil, ValidationError("Invalid radius %g", radiusKm)
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.registered(m.locations.nearest(point, limit, radiusKm)), nil
+}
+
+// citiesWithin finds the cities of CitiesWithin, with their registry entry.
+func (m *MainWeatherManager) citiesWithin(box BoundingBox) ([]NearbyCity, error) {
+	err := validateBoundingBox(box)
+	if err != nil {
+		return nil, err
 	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	found := []NearbyCity{}
+	for id := range m.locations.within(box) {
+		found = append(found, NearbyCity{City: City{ID: id}})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].City.ID < found[j].City.ID
+	})
+	return m.registered(found), nil
+}
+
+// registered completes the cities found by the spatial index with their
+// registry entry.
+func (m *MainWeatherManager) registered(found []NearbyCity) []NearbyCity {
+	for i := range found {
+		found[i].City, _ = m.cities.Get(found[i].City.ID)
+	}
+	return found
+}
+
+// completeNearby completes found with the latest observation of each city,
+// taken from its stats.
+func completeNearby(found []NearbyCity, stats func(string) cityStats) []NearbyCity {
+	for i := range found {
+		s := stats(found[i].City.ID)
+		found[i].Observations = s.observations
+		found[i].LatestDate, found[i].LatestTemperature = s.lastDate, s.lastTemperature
+	}
+	return found
+}
+
+// cityStats sums up the data of city in memory.
+func (m *MainWeatherManager) cityStats(city string) cityStats {
+	stats := cityStats{observations: len(m.weathers[city])}
+	if dates := m.sortedDates(city); len(dates) > 0 {
+		stats.firstDate, stats.lastDate = dates[0], dates[len(dates)-1]
+		stats.lastTemperature = m.weathers[city][stats.lastDate]
+	}
+	for _, station := range m.stationsOf(city) {
+		for date := range m.readings[station.ID] {
+			if stats.firstReading == "" || date < stats.firstReading {
+				stats.firstReading = date
+			}
+		}
+	}
+	for month := range m.aggregates[city] {
+		if stats.firstAggregate == "" || month < stats.firstAggregate {
+			stats.firstAggregate = month
+		}
+	}
+	return stats
+}
+
+// Options configure a MainWeatherManager.
+type Options struct {
+	// DeletionRetention is how long deleted cities can be restored before
+	// they are purged.
+	DeletionRetention time.Duration
+	// Retention is the policy of the cities without a policy of their own.
+	Retention RetentionPolicy
+}
+
+const DefaultDeletionRetention = 30 * 24 * time.Hour
+
+func DefaultOptions() Options {
+	return Options{DeletionRetention: DefaultDeletionRetention}
+}
+
+func New() *MainWeatherManager {
+	return NewWithOptions(DefaultOptions())
+}
+
+func NewWithOptions(options Options) *MainWeatherManager {
+	return &MainWeatherManager{state: &state{
+		options:    options,
+		weathers:   map[string]map[string]int{},
+		history:    map[string]map[string][]Revision{},
+		cities:     NewCityRegistry(),
+		locations:  newSpatialIndex(),
+		stations:   map[string]*Station{},
+		readings:   map[string]map[string]int{},
+		deleted:    map[string]*tombstone{},
+		retention:  map[string]RetentionPolicy{},
+		aggregates: map[string]map[string]*Aggregate{},
+		dates:      map[string][]string{},
+	}}
 }
 
 type contextKey struct{}
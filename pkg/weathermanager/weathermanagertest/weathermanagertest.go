@@ -0,0 +1,400 @@
+// Package weathermanagertest checks that an implementation of WeatherManager
+// behaves like MainWeatherManager, so the API works the same on top of any
+// storage.
+package weathermanagertest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/felipecurvelo/weather-reporting-api/pkg/weathermanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty WeatherManager for a single test. Resources it
+// opens are released with t.Cleanup.
+type Factory func(t *testing.T) weathermanager.WeatherManager
+
+// Run runs the conformance suite against the managers returned by factory,
+// each check in a subtest of its own.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, weatherMgr weathermanager.WeatherManager)
+	}{
+		{"SaveAndGetWeather", testSaveAndGetWeather},
+		{"SaveReplacesWeather", testSaveReplacesWeather},
+		{"MergeWeather", testMergeWeather},
+		{"ImportWeather", testImportWeather},
+		{"CopyWeather", testCopyWeather},
+		{"DeleteWeather", testDeleteWeather},
+		{"Observations", testObservations},
+		{"DateBoundaries", testDateBoundaries},
+		{"IterateInOrder", testIterateInOrder},
+		{"IterateLongRange", testIterateLongRange},
+		{"CaseInsensitivity", testCaseInsensitivity},
+		{"Errors", testErrors},
+		{"RejectInvalidWrites", testRejectInvalidWrites},
+		{"Concurrency", testConcurrency},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, factory(t))
+		})
+	}
+}
+
+func assertKind(t *testing.T, kind error, err error, msgAndArgs ...interface{}) {
+	t.Helper()
+	if assert.Error(t, err, msgAndArgs...) {
+		assert.True(t, errors.Is(err, kind), "expected %v, got %v", kind, err)
+	}
+}
+
+func testSaveAndGetWeather(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 14, "2020-04-18": 15, "2020-04-19": 16}))
+
+	temperatures, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-17": 14, "2020-04-18": 15, "2020-04-19": 16}, temperatures)
+
+	temperatures, err = weatherMgr.GetWeather("vancouver", "2020-05-01", "2020-05-31")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{}, temperatures)
+
+	temperatures, ok := weatherMgr.GetAllWeather("vancouver")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int{"2020-04-17": 14, "2020-04-18": 15, "2020-04-19": 16}, temperatures)
+
+	require.NoError(t, weatherMgr.SaveWeather("toronto", map[string]int{}))
+	temperatures, err = weatherMgr.GetWeather("toronto", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{}, temperatures)
+}
+
+func testSaveReplacesWeather(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 14, "2020-04-18": 15}))
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 20, "2020-04-19": 16}))
+
+	temperatures, ok := weatherMgr.GetAllWeather("vancouver")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int{"2020-04-18": 20, "2020-04-19": 16}, temperatures)
+
+	temperatures, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-18": 20, "2020-04-19": 16}, temperatures)
+}
+
+func testMergeWeather(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 14, "2020-04-18": 15}))
+	require.NoError(t, weatherMgr.MergeWeather("vancouver", map[string]int{"2020-04-18": 20, "2020-04-19": 16}))
+	require.NoError(t, weatherMgr.MergeWeather("toronto", map[string]int{"2020-04-18": 9}))
+
+	temperatures, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-17": 14, "2020-04-18": 20, "2020-04-19": 16}, temperatures)
+
+	temperatures, err = weatherMgr.GetWeather("toronto", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-18": 9}, temperatures)
+}
+
+func testImportWeather(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-17": 14}))
+	require.NoError(t, weatherMgr.ImportWeather(map[string]map[string]int{
+		"vancouver": {"2020-04-18": 15},
+		"toronto":   {"2020-04-18": 9},
+	}))
+
+	temperatures, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-17": 14, "2020-04-18": 15}, temperatures)
+
+	temperatures, err = weatherMgr.GetWeather("toronto", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-18": 9}, temperatures)
+}
+
+// testCopyWeather checks that maps passed to or returned by the manager are
+// not shared with its state.
+func testCopyWeather(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	saved := map[string]int{"2020-04-18": 15}
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", saved))
+	saved["2020-04-18"] = 30
+	saved["2020-04-19"] = 31
+
+	temperatures, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-18": 15}, temperatures)
+	temperatures["2020-04-18"] = 40
+
+	all, ok := weatherMgr.GetAllWeather("vancouver")
+	require.True(t, ok)
+	assert.Equal(t, map[string]int{"2020-04-18": 15}, all)
+	all["2020-04-18"] = 50
+
+	temperature, ok := weatherMgr.GetObservation("vancouver", "2020-04-18")
+	assert.True(t, ok)
+	assert.Equal(t, 15, temperature)
+}
+
+func testDeleteWeather(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15}))
+	require.NoError(t, weatherMgr.SaveWeather("toronto", map[string]int{"2020-04-18": 9}))
+
+	assert.NoError(t, weatherMgr.DeleteWeather("vancouver"))
+
+	_, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+	assertKind(t, weathermanager.ErrNotFound, err)
+	_, ok := weatherMgr.GetAllWeather("vancouver")
+	assert.False(t, ok)
+	_, ok = weatherMgr.GetObservation("vancouver", "2020-04-18")
+	assert.False(t, ok)
+
+	temperatures, err := weatherMgr.GetWeather("toronto", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-18": 9}, temperatures)
+
+	assert.NoError(t, weatherMgr.DeleteWeather("vancouver"), "deleting a deleted city")
+	assert.NoError(t, weatherMgr.DeleteWeather("montreal"), "deleting an unknown city")
+
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-19": 16}))
+	temperatures, err = weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-19": 16}, temperatures, "saving a deleted city starts over")
+}
+
+func testObservations(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15}))
+
+	require.NoError(t, weatherMgr.SaveObservation("vancouver", "2020-04-19", 16))
+	require.NoError(t, weatherMgr.SaveObservation("vancouver", "2020-04-18", 17))
+	temperature, ok := weatherMgr.GetObservation("vancouver", "2020-04-18")
+	assert.True(t, ok)
+	assert.Equal(t, 17, temperature)
+
+	_, ok = weatherMgr.GetObservation("vancouver", "2020-04-20")
+	assert.False(t, ok)
+	_, ok = weatherMgr.GetObservation("montreal", "2020-04-18")
+	assert.False(t, ok)
+
+	assert.NoError(t, weatherMgr.DeleteObservation("vancouver", "2020-04-18"))
+	assertKind(t, weathermanager.ErrNotFound, weatherMgr.DeleteObservation("vancouver", "2020-04-18"))
+	assertKind(t, weathermanager.ErrNotFound, weatherMgr.DeleteObservation("montreal", "2020-04-18"))
+
+	temperatures, err := weatherMgr.GetWeather("vancouver", "2020-04-01", "2020-04-30")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-04-19": 16}, temperatures)
+
+	require.NoError(t, weatherMgr.SaveObservation("toronto", "2020-04-18", 9))
+	temperature, ok = weatherMgr.GetObservation("toronto", "2020-04-18")
+	assert.True(t, ok, "saving an observation creates its city")
+	assert.Equal(t, 9, temperature)
+}
+
+func testDateBoundaries(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{
+		"2019-12-31": 1,
+		"2020-01-01": 2,
+		"2020-02-28": 3,
+		"2020-02-29": 4,
+		"2020-03-01": 5,
+	}))
+
+	cases := []struct {
+		name      string
+		dateRange weathermanager.DateRange
+		expected  map[string]int
+	}{
+		{"exclusive", weathermanager.Between("2019-12-31", "2020-02-29"), map[string]int{"2020-01-01": 2, "2020-02-28": 3}},
+		{"inclusive from", weathermanager.DateRange{From: "2019-12-31", To: "2020-02-29", FromInclusive: true}, map[string]int{"2019-12-31": 1, "2020-01-01": 2, "2020-02-28": 3}},
+		{"inclusive to", weathermanager.DateRange{From: "2019-12-31", To: "2020-02-29", ToInclusive: true}, map[string]int{"2020-01-01": 2, "2020-02-28": 3, "2020-02-29": 4}},
+		{"inclusive", weathermanager.DateRange{From: "2019-12-31", To: "2020-02-29", FromInclusive: true, ToInclusive: true}, map[string]int{"2019-12-31": 1, "2020-01-01": 2, "2020-02-28": 3, "2020-02-29": 4}},
+		{"single day", weathermanager.SingleDay("2020-02-29"), map[string]int{"2020-02-29": 4}},
+		{"open from", weathermanager.DateRange{To: "2020-01-01"}, map[string]int{"2019-12-31": 1}},
+		{"open to", weathermanager.DateRange{From: "2020-02-29"}, map[string]int{"2020-03-01": 5}},
+		{"open", weathermanager.DateRange{}, map[string]int{"2019-12-31": 1, "2020-01-01": 2, "2020-02-28": 3, "2020-02-29": 4, "2020-03-01": 5}},
+		{"adjacent days", weathermanager.Between("2020-02-28", "2020-02-29"), map[string]int{}},
+		{"before every date", weathermanager.Between("2019-01-01", "2019-12-31"), map[string]int{}},
+		{"after every date", weathermanager.DateRange{From: "2020-03-01"}, map[string]int{}},
+	}
+	for _, c := range cases {
+		temperatures := map[string]int{}
+		err := weatherMgr.IterateRange("vancouver", c.dateRange, func(date string, temperature int) bool {
+			temperatures[date] = temperature
+			return true
+		})
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, temperatures, c.name)
+	}
+
+	temperatures, err := weatherMgr.GetWeather("vancouver", "2019-12-31", "2020-03-01")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"2020-01-01": 2, "2020-02-28": 3, "2020-02-29": 4}, temperatures, "GetWeather excludes both dates")
+}
+
+func testIterateInOrder(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-19": 16, "2020-04-17": 14, "2020-04-18": 15, "2020-03-31": 10}))
+
+	dates := []string{}
+	err := weatherMgr.IterateWeather("vancouver", "2020-03-01", "2020-04-30", func(date string, temperature int) bool {
+		dates = append(dates, date)
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2020-03-31", "2020-04-17", "2020-04-18", "2020-04-19"}, dates)
+
+	dates = []string{}
+	err = weatherMgr.IterateRange("vancouver", weathermanager.DateRange{}, func(date string, temperature int) bool {
+		dates = append(dates, date)
+		return len(dates) < 2
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2020-03-31", "2020-04-17"}, dates, "iteration stops when the callback returns false")
+}
+
+func testIterateLongRange(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	start := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	temperatures := map[string]int{}
+	for i := 0; i < 1500; i++ {
+		temperatures[start.AddDate(0, 0, i).Format("2006-01-02")] = i % 40
+	}
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", temperatures))
+
+	dates := []string{}
+	err := weatherMgr.IterateRange("vancouver", weathermanager.DateRange{}, func(date string, temperature int) bool {
+		assert.Equal(t, temperatures[date], temperature)
+		dates = append(dates, date)
+		return true
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, dates, 1500) {
+		assert.True(t, sort.StringsAreSorted(dates), "observations are iterated in order")
+	}
+
+	dates = []string{}
+	err = weatherMgr.IterateRange("vancouver", weathermanager.Between("2015-06-01", "2018-01-01"), func(date string, temperature int) bool {
+		dates = append(dates, date)
+		return len(dates) < 600
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, dates, 600, "iteration stops when the callback returns false") {
+		assert.Equal(t, "2015-06-02", dates[0])
+		assert.Equal(t, "2017-01-21", dates[599])
+	}
+}
+
+func testCaseInsensitivity(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("Vancouver", map[string]int{"2020-04-18": 15}))
+	require.NoError(t, weatherMgr.SaveWeather("São Paulo", map[string]int{"2020-04-18": 25}))
+
+	for _, name := range []string{"Vancouver", "vancouver", "VANCOUVER", " vancouver "} {
+		temperatures, err := weatherMgr.GetWeather(name, "2020-04-01", "2020-04-30")
+		assert.NoError(t, err, name)
+		assert.Equal(t, map[string]int{"2020-04-18": 15}, temperatures, name)
+	}
+	for _, name := range []string{"sao paulo", "SAO-PAULO", "são paulo"} {
+		temperature, ok := weatherMgr.GetObservation(name, "2020-04-18")
+		assert.True(t, ok, name)
+		assert.Equal(t, 25, temperature, name)
+	}
+
+	require.NoError(t, weatherMgr.SaveObservation("VANCOUVER", "2020-04-19", 16))
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-20": 17}))
+	temperatures, ok := weatherMgr.GetAllWeather("Vancouver")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int{"2020-04-20": 17}, temperatures, "every name saves to the same city")
+
+	require.NoError(t, weatherMgr.DeleteWeather("VANCOUVER"))
+	_, ok = weatherMgr.GetAllWeather("vancouver")
+	assert.False(t, ok)
+}
+
+func testErrors(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15}))
+
+	_, err := weatherMgr.GetWeather("", "2020-04-01", "2020-04-30")
+	assertKind(t, weathermanager.ErrValidation, err, "empty city")
+	_, err = weatherMgr.GetWeather("vancouver", "", "2020-04-30")
+	assertKind(t, weathermanager.ErrValidation, err, "empty initial date")
+	_, err = weatherMgr.GetWeather("vancouver", "2020-04-01", "")
+	assertKind(t, weathermanager.ErrValidation, err, "empty end date")
+	_, err = weatherMgr.GetWeather("vancouver", "2020-04-31", "2020-05-30")
+	assertKind(t, weathermanager.ErrValidation, err, "invalid initial date")
+	_, err = weatherMgr.GetWeather("vancouver", "2020-04-01", "tomorrow")
+	assertKind(t, weathermanager.ErrValidation, err, "invalid end date")
+	_, err = weatherMgr.GetWeather("vancouver", "2020-04-30", "2020-04-01")
+	assertKind(t, weathermanager.ErrValidation, err, "reversed range")
+	_, err = weatherMgr.GetWeather("vancouver", "2020-04-18", "2020-04-18")
+	assertKind(t, weathermanager.ErrValidation, err, "empty exclusive range")
+
+	_, err = weatherMgr.GetWeather("montreal", "2020-04-01", "2020-04-30")
+	assertKind(t, weathermanager.ErrNotFound, err, "unknown city")
+	err = weatherMgr.IterateRange("montreal", weathermanager.DateRange{}, func(string, int) bool { return true })
+	assertKind(t, weathermanager.ErrNotFound, err, "unknown city")
+	_, ok := weatherMgr.GetAllWeather("montreal")
+	assert.False(t, ok, "unknown city")
+}
+
+func testRejectInvalidWrites(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	require.NoError(t, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-18": 15}))
+
+	assertKind(t, weathermanager.ErrValidation, weatherMgr.SaveWeather("vancouver", map[string]int{"2020-04-19": 16, "2020-04-31": 17}))
+	assertKind(t, weathermanager.ErrValidation, weatherMgr.MergeWeather("vancouver", map[string]int{"2020-04-19": 16, "18/04/2020": 17}))
+	assertKind(t, weathermanager.ErrValidation, weatherMgr.SaveObservation("vancouver", "2020-13-01", 16))
+	assertKind(t, weathermanager.ErrValidation, weatherMgr.ImportWeather(map[string]map[string]int{
+		"vancouver": {"2020-04-19": 16},
+		"toronto":   {"never": 9},
+	}))
+
+	temperatures, ok := weatherMgr.GetAllWeather("vancouver")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int{"2020-04-18": 15}, temperatures, "rejected writes change nothing")
+	_, ok = weatherMgr.GetAllWeather("toronto")
+	assert.False(t, ok, "rejected imports create no city")
+}
+
+// testConcurrency runs writers and readers of the same and of different
+// cities at once; run it with -race.
+func testConcurrency(t *testing.T, weatherMgr weathermanager.WeatherManager) {
+	const workers = 8
+	const days = 10
+
+	require.NoError(t, weatherMgr.SaveWeather("shared", map[string]int{}))
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			city := fmt.Sprintf("city-%d", w)
+			for day := 1; day <= days; day++ {
+				date := fmt.Sprintf("2020-04-%02d", day)
+				assert.NoError(t, weatherMgr.SaveObservation(city, date, w*100+day))
+				assert.NoError(t, weatherMgr.MergeWeather("shared", map[string]int{fmt.Sprintf("2020-%02d-%02d", w+1, day): w}))
+
+				_, err := weatherMgr.GetWeather("shared", "2020-01-01", "2020-12-31")
+				assert.NoError(t, err)
+				_, err = weatherMgr.GetWeather(city, "2020-04-01", "2020-04-30")
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < workers; w++ {
+		temperatures, err := weatherMgr.GetWeather(fmt.Sprintf("city-%d", w), "2020-03-31", "2020-05-01")
+		assert.NoError(t, err)
+		assert.Equal(t, days, len(temperatures))
+	}
+	temperatures, ok := weatherMgr.GetAllWeather("shared")
+	assert.True(t, ok)
+	assert.Equal(t, workers*days, len(temperatures))
+}